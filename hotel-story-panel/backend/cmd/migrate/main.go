@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"hotel-story-panel/backend/internal/database"
+	"hotel-story-panel/backend/internal/migrations"
+)
+
+const usage = `Usage: migrate <command>
+
+Commands:
+  up          apply all pending migrations
+  down [n]    roll back the last n migrations (default 1)
+  status      list migrations and whether they are applied
+  redo        roll back the last migration and apply it again`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+
+	database.InitDB()
+	defer database.CloseDB()
+
+	switch os.Args[1] {
+	case "up":
+		n, err := migrations.Up(database.DB)
+		if err != nil {
+			log.Fatalln("Migration failed:", err)
+		}
+		fmt.Printf("Applied %d migration(s)\n", n)
+
+	case "down":
+		steps := 1
+		if len(os.Args) > 2 {
+			var err error
+			steps, err = strconv.Atoi(os.Args[2])
+			if err != nil || steps < 1 {
+				log.Fatalln("Invalid step count:", os.Args[2])
+			}
+		}
+		n, err := migrations.Down(database.DB, steps)
+		if err != nil {
+			log.Fatalln("Rollback failed:", err)
+		}
+		fmt.Printf("Rolled back %d migration(s)\n", n)
+
+	case "status":
+		statuses, err := migrations.GetStatus(database.DB)
+		if err != nil {
+			log.Fatalln("Failed to read migration status:", err)
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-30s %s\n", s.Version, s.Name, state)
+		}
+
+	case "redo":
+		if err := migrations.Redo(database.DB); err != nil {
+			log.Fatalln("Redo failed:", err)
+		}
+		fmt.Println("Redo complete")
+
+	default:
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+}
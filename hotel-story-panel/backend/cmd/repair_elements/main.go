@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+
+	"hotel-story-panel/backend/internal/database"
+	"hotel-story-panel/backend/internal/elements"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// repair_elements checks the elements stored on slides, in published
+// group versions and in approved drafts against the current schema. By
+// default it only reports; -fix writes the repaired payloads back.
+func main() {
+	fix := flag.Bool("fix", false, "write repaired elements back to the database")
+	flag.Parse()
+
+	database.InitDB()
+	defer database.CloseDB()
+	elements.Init()
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		log.Fatalln("Failed to begin transaction:", err)
+	}
+	defer tx.Rollback()
+
+	var checked, changed int
+	count := func(c, n int) { checked += c; changed += n }
+
+	count(repairSlides(tx))
+	count(repairContent(tx, "story_group_versions", "content"))
+	count(repairContent(tx, "story_groups", "approved_content"))
+
+	fmt.Printf("Checked %d payload(s), %d need repair\n", checked, changed)
+	if !*fix {
+		if changed > 0 {
+			fmt.Println("Dry run; run again with -fix to write the changes")
+		}
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Fatalln("Failed to commit repairs:", err)
+	}
+	fmt.Printf("Repaired %d payload(s)\n", changed)
+}
+
+// repairSlides repairs story_slides.elements.
+func repairSlides(tx *sqlx.Tx) (int, int) {
+	var slides []struct {
+		ID       int             `db:"id"`
+		Elements json.RawMessage `db:"elements"`
+	}
+	if err := tx.Select(&slides, "SELECT id, COALESCE(elements, '[]'::jsonb) AS elements FROM story_slides ORDER BY id"); err != nil {
+		log.Fatalln("Failed to read slides:", err)
+	}
+
+	changed := 0
+	for _, s := range slides {
+		fixed, notes, ok := elements.Repair(s.Elements)
+		if !ok {
+			continue
+		}
+		changed++
+		report(fmt.Sprintf("slide %d", s.ID), notes)
+		if _, err := tx.Exec("UPDATE story_slides SET elements = $1 WHERE id = $2", string(fixed), s.ID); err != nil {
+			log.Fatalf("Failed to update slide %d: %v", s.ID, err)
+		}
+	}
+	return len(slides), changed
+}
+
+// repairContent repairs the slides' elements inside a group content
+// snapshot column, leaving everything else in the snapshot as it is.
+func repairContent(tx *sqlx.Tx, table, column string) (int, int) {
+	var rows []struct {
+		ID      int             `db:"id"`
+		Content json.RawMessage `db:"content"`
+	}
+	query := fmt.Sprintf("SELECT id, %s AS content FROM %s WHERE %s IS NOT NULL ORDER BY id", column, table, column)
+	if err := tx.Select(&rows, query); err != nil {
+		log.Fatalf("Failed to read %s: %v", table, err)
+	}
+
+	checked, changed := 0, 0
+	for _, r := range rows {
+		var content map[string]json.RawMessage
+		var slides []map[string]json.RawMessage
+		if json.Unmarshal(r.Content, &content) != nil || json.Unmarshal(content["slides"], &slides) != nil {
+			fmt.Printf("%s %d: %s is not group content, skipped\n", table, r.ID, column)
+			continue
+		}
+
+		rowChanged := false
+		for i, slide := range slides {
+			checked++
+			raw := slide["elements"]
+			if raw == nil {
+				raw = json.RawMessage("[]")
+			}
+			fixed, notes, ok := elements.Repair(raw)
+			if !ok {
+				continue
+			}
+			changed++
+			rowChanged = true
+			report(fmt.Sprintf("%s %d slide %s", table, r.ID, slideLabel(slide, i)), notes)
+			slides[i]["elements"] = fixed
+		}
+		if !rowChanged {
+			continue
+		}
+
+		var err error
+		if content["slides"], err = json.Marshal(slides); err != nil {
+			log.Fatalf("Failed to encode %s %d: %v", table, r.ID, err)
+		}
+		updated, err := json.Marshal(content)
+		if err != nil {
+			log.Fatalf("Failed to encode %s %d: %v", table, r.ID, err)
+		}
+		query := fmt.Sprintf("UPDATE %s SET %s = $1 WHERE id = $2", table, column)
+		if _, err := tx.Exec(query, string(updated), r.ID); err != nil {
+			log.Fatalf("Failed to update %s %d: %v", table, r.ID, err)
+		}
+	}
+	return checked, changed
+}
+
+// slideLabel names a slide in a snapshot by its id, or its position when
+// it has none.
+func slideLabel(slide map[string]json.RawMessage, i int) string {
+	if id, ok := slide["id"]; ok {
+		return string(id)
+	}
+	return fmt.Sprintf("#%d", i)
+}
+
+func report(what string, notes []string) {
+	if len(notes) == 0 {
+		fmt.Printf("%s: upgraded to schema version %d\n", what, elements.SchemaVersion)
+		return
+	}
+	for _, n := range notes {
+		fmt.Printf("%s: %s\n", what, n)
+	}
+}
@@ -1,11 +1,27 @@
 package main
 
 import (
+	"context"
 	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"hotel-story-panel/backend/internal/database"
+	"hotel-story-panel/backend/internal/elements"
+	"hotel-story-panel/backend/internal/events"
 	"hotel-story-panel/backend/internal/handlers"
+	"hotel-story-panel/backend/internal/mailer"
 	"hotel-story-panel/backend/internal/middleware"
+	"hotel-story-panel/backend/internal/migrations"
+	"hotel-story-panel/backend/internal/ratelimit"
+	"hotel-story-panel/backend/internal/rollup"
+	"hotel-story-panel/backend/internal/scheduler"
+	"hotel-story-panel/backend/internal/storage"
 
 	"github.com/gin-gonic/gin"
 )
@@ -15,14 +31,64 @@ func main() {
 	database.InitDB()
 	defer database.CloseDB()
 
+	// Apply pending schema migrations on startup when enabled
+	if os.Getenv("AUTO_MIGRATE") == "true" {
+		n, err := migrations.Up(database.DB)
+		if err != nil {
+			log.Fatalln("Auto-migrate failed:", err)
+		}
+		log.Printf("Auto-migrate applied %d migration(s)", n)
+	}
+
+	// Initialize Media Storage
+	storage.InitStorage()
+
+	// Outgoing email (invitations, password resets)
+	mailer.InitMailer()
+
+	// Hosts that link elements on slides may point to
+	elements.Init()
+
+	// Rate-limit buckets, per process or shared through Postgres
+	ratelimit.Init(database.DB)
+
+	// Start the analytics event writer (flushed on shutdown below)
+	events.InitWriter(database.DB)
+
+	// Keep hourly/daily analytics rollups up to date
+	rollup.Start(database.DB)
+
+	// Announce campaign activation/expiry as publishing windows pass
+	scheduler.Start(database.DB)
+
 	r := gin.Default()
 
-	// CORS Setup (Allowing All for MVP)
+	// Client IPs key the rate limits, so X-Forwarded-For is only believed from
+	// the reverse proxies listed in TRUSTED_PROXIES
+	var proxies []string
+	if v := os.Getenv("TRUSTED_PROXIES"); v != "" {
+		proxies = strings.Split(v, ",")
+	}
+	if err := r.SetTrustedProxies(proxies); err != nil {
+		log.Fatalln("Invalid TRUSTED_PROXIES:", err)
+	}
+
+	// CORS Setup. Anyone may read the public API, but only the panel's own
+	// origins (CORS_ORIGINS, else APP_URL) get credentialed requests carrying
+	// the refresh cookie.
+	allowedOrigins := panelOrigins()
 	r.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+		origin := c.GetHeader("Origin")
+		c.Writer.Header().Set("Vary", "Origin")
+		if allowedOrigins[origin] {
+			c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+			c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+		} else {
+			c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+		}
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "Retry-After")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -31,45 +97,161 @@ func main() {
 		c.Next()
 	})
 
-	// Static Files (Uploads)
-	r.Static("/uploads", "./uploads")
+	// Static Files (Uploads) - only when media lives on local disk
+	if local, ok := storage.IsLocal(); ok {
+		r.Static("/uploads", local.Dir)
+	}
 
 	// Routes
 	api := r.Group("/api")
 	{
+		// Per-IP limits; Login, 2FA and password resets also limit per account
+		authLimit := middleware.RateLimit("auth", ratelimit.PerMinute(20))
+		refreshLimit := middleware.RateLimit("refresh", ratelimit.PerMinute(60))
+		countLimit := middleware.RateLimit("count", ratelimit.PerMinute(60))
+		eventsLimit := middleware.RateLimit("events", ratelimit.PerMinute(120))
+		// Responses are deduplicated on the viewer_id the browser sends, so
+		// this is the only bound on one client answering over and over
+		interactLimit := middleware.RateLimit("interact", ratelimit.PerMinute(30))
+
 		// Auth
 		auth := api.Group("/auth")
 		{
-			auth.POST("/signup", handlers.Signup)
-			auth.POST("/login", handlers.Login)
+			auth.POST("/signup", authLimit, handlers.Signup)
+			auth.POST("/login", authLimit, handlers.Login)
+			auth.POST("/refresh", refreshLimit, handlers.Refresh)
+			auth.POST("/logout", handlers.Logout)
+			auth.POST("/invitations/accept", authLimit, handlers.AcceptInvitation)
+			auth.POST("/password/forgot", authLimit, handlers.ForgotPassword)
+			auth.POST("/password/reset", authLimit, handlers.ResetPassword)
+			auth.POST("/mfa/verify", authLimit, handlers.VerifyMFA)
+			auth.POST("/mfa/enroll", authLimit, handlers.EnrollMFA)
+			auth.POST("/mfa/enroll/confirm", authLimit, handlers.ConfirmEnrollMFA)
 		}
 
 		// Public
 		public := api.Group("/public")
 		{
 			public.GET("/stories/:city_slug", handlers.GetPublicStories)
-			public.POST("/stories/open/:id", handlers.IncrementSlideOpen)
-			public.POST("/stories/group-open/:id", handlers.IncrementGroupOpen)
+			public.POST("/stories/open/:id", countLimit, handlers.IncrementSlideOpen)
+			public.POST("/stories/group-open/:id", countLimit, handlers.IncrementGroupOpen)
+			public.POST("/events", eventsLimit, handlers.IngestEvents)
+			public.POST("/slides/:id/poll/:element", interactLimit, handlers.VotePoll)
+			public.POST("/slides/:id/slider/:element", interactLimit, handlers.SubmitSlider)
+			public.POST("/slides/:id/quiz/:element", interactLimit, handlers.AnswerQuiz)
+			public.GET("/cities", handlers.GetPublicCities)
+			public.GET("/hotels/:hotel_slug/stories", handlers.GetHotelStories)
 		}
 
 		// Protected (Admin)
 		admin := api.Group("/admin")
 		admin.Use(middleware.AuthMiddleware())
 		{
-			admin.GET("/stats", handlers.GetDashboardStats)
-			admin.GET("/story-groups", handlers.GetGroups)
-			admin.GET("/story-groups/:id", handlers.GetGroup)
-			admin.POST("/story-groups", handlers.CreateGroup)
-			admin.PUT("/story-groups/:id", handlers.UpdateGroup)
-			admin.DELETE("/story-groups/:id", handlers.DeleteGroup)
-			admin.POST("/story-groups/:id/stories", handlers.AddSlide)
-			admin.PATCH("/story-groups/:id/status", handlers.ToggleGroupStatus)
-			admin.DELETE("/stories/:id", handlers.DeleteSlide)
-			admin.PUT("/stories/:id", handlers.UpdateSlide)
-			admin.POST("/upload", handlers.UploadImage)
+			canView := middleware.RequirePermission(middleware.ViewContent)
+			canEdit := middleware.RequirePermission(middleware.EditContent)
+			canReview := middleware.RequirePermission(middleware.ReviewContent)
+			canComment := middleware.RequirePermission(middleware.EditContent, middleware.ReviewContent)
+			canAnalyze := middleware.RequirePermission(middleware.ViewAnalytics)
+			canManageCities := middleware.RequirePermission(middleware.ManageCities)
+			canManageUsers := middleware.RequirePermission(middleware.ManageUsers)
+
+			admin.GET("/stats", canView, handlers.GetDashboardStats)
+			admin.GET("/events/metrics", canAnalyze, handlers.GetEventMetrics)
+			admin.GET("/story-groups", canView, handlers.GetGroups)
+			admin.GET("/story-groups/:id", canView, handlers.GetGroup)
+			admin.GET("/story-groups/:id/analytics", canAnalyze, handlers.GetGroupAnalytics)
+			admin.GET("/story-groups/:id/timeseries", canAnalyze, handlers.GetGroupTimeSeries)
+			admin.GET("/story-groups/:id/sliders", canAnalyze, handlers.GetGroupSliders)
+			admin.GET("/story-groups/:id/quizzes", canAnalyze, handlers.GetGroupQuizzes)
+			admin.GET("/analytics/timeseries", canAnalyze, handlers.GetTimeSeries)
+			admin.POST("/story-groups", canEdit, handlers.CreateGroup)
+			admin.PUT("/story-groups/:id", canEdit, handlers.UpdateGroup)
+			admin.DELETE("/story-groups/:id", canEdit, handlers.DeleteGroup)
+			admin.POST("/story-groups/:id/stories", canEdit, handlers.AddSlide)
+			admin.PATCH("/story-groups/:id/status", canEdit, handlers.ToggleGroupStatus)
+			admin.POST("/story-groups/:id/publish", canEdit, handlers.PublishGroup)
+			admin.GET("/story-groups/:id/versions", canView, handlers.GetGroupVersions)
+			admin.GET("/story-groups/:id/versions/:version", canView, handlers.GetGroupVersion)
+			admin.POST("/story-groups/:id/versions/:version/rollback", canEdit, handlers.RollbackGroup)
+			admin.POST("/story-groups/:id/submit", canEdit, handlers.SubmitGroup)
+			admin.POST("/story-groups/:id/withdraw", canEdit, handlers.WithdrawGroup)
+			admin.POST("/story-groups/:id/approve", canReview, handlers.ApproveGroup)
+			admin.POST("/story-groups/:id/reject", canReview, handlers.RejectGroup)
+			admin.PUT("/story-groups/:id/reviewer", canEdit, handlers.AssignReviewer)
+			admin.GET("/story-groups/:id/comments", canView, handlers.GetGroupComments)
+			admin.POST("/story-groups/:id/comments", canComment, handlers.AddGroupComment)
+			admin.GET("/reviewers", canEdit, handlers.GetReviewers)
+			admin.DELETE("/stories/:id", canEdit, handlers.DeleteSlide)
+			admin.PUT("/stories/:id", canEdit, handlers.UpdateSlide)
+			admin.POST("/upload", canEdit, handlers.UploadImage)
+			admin.GET("/cities", canView, handlers.GetCities)
+			admin.POST("/cities", canManageCities, handlers.CreateCity)
+			admin.PUT("/cities/:id", canManageCities, handlers.UpdateCity)
+			admin.DELETE("/cities/:id", canManageCities, handlers.DeleteCity)
+			admin.GET("/users", canManageUsers, handlers.GetUsers)
+			admin.PATCH("/users/:id/role", canManageUsers, handlers.UpdateUserRole)
+			admin.GET("/users/:id/scope", canManageUsers, handlers.GetUserScope)
+			admin.PUT("/users/:id/scope", canManageUsers, handlers.SetUserScope)
+			admin.DELETE("/users/:id/sessions", canManageUsers, handlers.RevokeUserSessions)
+			admin.GET("/invitations", canManageUsers, handlers.GetInvitations)
+			admin.POST("/invitations", canManageUsers, handlers.CreateInvitation)
+			admin.DELETE("/invitations/:id", canManageUsers, handlers.RevokeInvitation)
+			admin.DELETE("/users/:id/mfa", canManageUsers, handlers.ResetUserMFA)
+			admin.GET("/settings/security", canManageUsers, handlers.GetSecuritySettings)
+			admin.PUT("/settings/security", canManageUsers, handlers.UpdateSecuritySettings)
+			admin.GET("/audit", canManageUsers, handlers.GetAuditLog)
+
+			// Any signed-in user manages their own sessions and 2FA
+			admin.GET("/sessions", handlers.GetSessions)
+			admin.DELETE("/sessions/:id", handlers.RevokeSession)
+			admin.POST("/sessions/revoke-all", handlers.RevokeAllSessions)
+			admin.GET("/mfa", handlers.GetMFAStatus)
+			admin.POST("/mfa/setup", handlers.SetupMFA)
+			admin.POST("/mfa/enable", handlers.EnableMFA)
+			admin.POST("/mfa/disable", handlers.DisableMFA)
+			admin.POST("/mfa/recovery-codes", handlers.RegenerateRecoveryCodes)
+		}
+	}
+
+	srv := &http.Server{Addr: ":8080", Handler: r}
+	go func() {
+		log.Println("Server running on :8080")
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalln("Server error:", err)
 		}
+	}()
+
+	// Graceful shutdown so buffered analytics events are not lost
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	log.Println("Shutting down...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Println("Server shutdown error:", err)
 	}
+	events.CloseWriter()
+	rollup.Stop()
+	scheduler.Stop()
+}
 
-	log.Println("Server running on :8080")
-	r.Run(":8080")
+// panelOrigins lists the origins of the admin frontend: the comma-separated
+// CORS_ORIGINS, or else the origin of APP_URL.
+func panelOrigins() map[string]bool {
+	list := os.Getenv("CORS_ORIGINS")
+	if list == "" {
+		list = os.Getenv("APP_URL")
+	}
+	if list == "" {
+		list = "http://localhost:3000"
+	}
+	origins := make(map[string]bool)
+	for _, o := range strings.Split(list, ",") {
+		if u, err := url.Parse(strings.TrimSpace(o)); err == nil && u.Scheme != "" && u.Host != "" {
+			origins[u.Scheme+"://"+u.Host] = true
+		}
+	}
+	return origins
 }
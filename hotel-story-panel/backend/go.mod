@@ -8,6 +8,7 @@ require (
 	github.com/jmoiron/sqlx v1.4.0
 	github.com/lib/pq v1.11.2
 	golang.org/x/crypto v0.48.0
+	golang.org/x/image v0.33.0
 )
 
 require (
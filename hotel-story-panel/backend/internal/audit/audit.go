@@ -0,0 +1,82 @@
+// Package audit records who changed what in the admin panel.
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Entry is one change made by an admin user.
+type Entry struct {
+	UserID     int
+	Action     string // create, update, delete, ...
+	EntityType string // group, slide, city, ...
+	EntityID   string // empty when the change has no single entity
+	Changes    json.RawMessage
+	IP         string
+}
+
+// Change is one field's value before and after, null when absent.
+type Change struct {
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// Diff compares the JSON forms of before and after, either of which may be
+// nil, and returns the fields that differ as {"field": {"before", "after"}}.
+func Diff(before, after any) (json.RawMessage, error) {
+	b, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]Change{}
+	for k, av := range a {
+		if bv, ok := b[k]; !ok || !bytes.Equal(bv, av) {
+			changes[k] = Change{Before: b[k], After: av}
+		}
+	}
+	for k, bv := range b {
+		if _, ok := a[k]; !ok {
+			changes[k] = Change{Before: bv}
+		}
+	}
+	return json.Marshal(changes)
+}
+
+// fields returns the top-level fields of v's JSON object form.
+func fields(v any) (map[string]json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	// null stands for "absent", so it matches a missing field
+	for k, v := range m {
+		if string(v) == "null" {
+			delete(m, k)
+		}
+	}
+	return m, nil
+}
+
+// Record stores e.
+func Record(db sqlx.Execer, e Entry) error {
+	_, err := db.Exec(`
+		INSERT INTO audit_log (user_id, action, entity_type, entity_id, changes, ip)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6)`,
+		e.UserID, e.Action, e.EntityType, e.EntityID, e.Changes, e.IP)
+	return err
+}
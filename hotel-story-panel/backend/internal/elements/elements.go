@@ -0,0 +1,569 @@
+// Package elements defines the interactive layers the story builder places
+// on a slide, stored as a JSON array in story_slides.elements, and
+// validates them before they are saved.
+package elements
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"hotel-story-panel/backend/internal/timeutil"
+)
+
+// SchemaVersion is the element schema this code writes. Elements saved
+// before versioning have none and are upgraded by Repair.
+const SchemaVersion = 1
+
+// Element types the story builder emits.
+const (
+	TypeLink      = "link"
+	TypeSlider    = "slider"
+	TypeText      = "text"
+	TypePoll      = "poll"
+	TypeQuiz      = "quiz"
+	TypeCountdown = "countdown"
+)
+
+// UntilGroupEnd makes a countdown follow its group's end time.
+const UntilGroupEnd = "group_end"
+
+// Limits on a slide's elements.
+const (
+	MaxElements       = 20
+	MaxLinkText       = 40
+	MaxURLLength      = 2048
+	MaxTextContent    = 200
+	MaxEmoji          = 8 // runes; flags and skin tones take several
+	MaxIDLength       = 32
+	MaxPollText       = 80 // the question, for quizzes too
+	MaxPollOption     = 25
+	MinPollOptions    = 2
+	MaxPollOptions    = 4
+	MinSliderValue    = 0
+	MaxSliderValue    = 100
+	MaxCountdownLabel = 40
+	MaxCountdownAhead = 366 * 24 * time.Hour
+)
+
+// Base is what every element has: its type, the schema version it was
+// written with and its centre as percentages of the slide's width and
+// height. Elements viewers respond to also have an ID, unique on the
+// slide, that their responses are stored under.
+type Base struct {
+	Type    string  `json:"type"`
+	Version int     `json:"version"`
+	ID      string  `json:"id,omitempty"`
+	X       float64 `json:"x"`
+	Y       float64 `json:"y"`
+}
+
+// Link is a button that opens URL.
+type Link struct {
+	Base
+	Text string `json:"text"`
+	URL  string `json:"url"`
+}
+
+// Slider is an emoji slider viewers drag to react, from MinSliderValue to
+// MaxSliderValue.
+type Slider struct {
+	Base
+	Emoji string `json:"emoji"`
+}
+
+// Text is a static text layer.
+type Text struct {
+	Base
+	Content string `json:"content"`
+}
+
+// Poll asks a question with two to four options viewers vote on.
+type Poll struct {
+	Base
+	Question string   `json:"question"`
+	Options  []string `json:"options"`
+}
+
+// Quiz asks a question with two to four options, one of them correct.
+type Quiz struct {
+	Base
+	Question string   `json:"question"`
+	Options  []string `json:"options"`
+	Correct  *int     `json:"correct,omitempty"` // index into Options
+}
+
+// Countdown counts down to Target, or to the group's end time when Until
+// is UntilGroupEnd. Once it has passed viewers no longer see it, or the
+// whole slide when HideSlide is set.
+type Countdown struct {
+	Base
+	Label     string     `json:"label,omitempty"`
+	Target    *time.Time `json:"target,omitempty"`
+	Until     string     `json:"until,omitempty"`
+	HideSlide bool       `json:"hide_slide,omitempty"`
+}
+
+// Context is what checking and showing elements depends on besides the
+// payload: the time and the group's end time, if it has one. Stored holds
+// the slide's elements as saved before when an existing slide is edited.
+type Context struct {
+	Now         time.Time
+	GroupEndsAt *time.Time
+	Stored      json.RawMessage
+}
+
+// Element is one of the element types above.
+type Element interface {
+	base() *Base
+	// validate adds a FieldError for each problem, with fields under path.
+	validate(errs *ValidationError, path string, ctx Context)
+	// repair fixes what it can in place and reports whether the element
+	// is still worth keeping.
+	repair() bool
+}
+
+// types makes an empty element of each known type.
+var types = map[string]func() Element{
+	TypeLink:      func() Element { return &Link{} },
+	TypeSlider:    func() Element { return &Slider{} },
+	TypeText:      func() Element { return &Text{} },
+	TypePoll:      func() Element { return &Poll{} },
+	TypeQuiz:      func() Element { return &Quiz{} },
+	TypeCountdown: func() Element { return &Countdown{} },
+}
+
+// interactive types collect responses and are given an ID when saved
+// without one.
+var interactive = map[string]bool{
+	TypeSlider: true,
+	TypePoll:   true,
+	TypeQuiz:   true,
+}
+
+// idPattern is what an element ID may look like.
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// FieldError is a problem with one field, e.g. "elements[2].url".
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists everything wrong with an elements payload.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Fields) == 0 {
+		return "invalid elements"
+	}
+	msg := e.Fields[0].Field + ": " + e.Fields[0].Message
+	if n := len(e.Fields) - 1; n > 0 {
+		msg += fmt.Sprintf(" (and %d more)", n)
+	}
+	return msg
+}
+
+func (e *ValidationError) add(field, format string, args ...any) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Parse decodes and validates an elements payload as the builder posts
+// it, at ctx. An empty payload is no elements. Elements without a version are
+// taken to be the current schema, and interactive elements without an ID
+// are given one. Any problem is a *ValidationError.
+func Parse(data []byte, ctx Context) ([]Element, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return []Element{}, nil
+	}
+
+	errs := &ValidationError{}
+	var raws []json.RawMessage
+	if err := json.Unmarshal(data, &raws); err != nil {
+		errs.add("elements", "must be a JSON array of elements")
+		return nil, errs
+	}
+	if len(raws) > MaxElements {
+		errs.add("elements", "at most %d elements are allowed", MaxElements)
+		return nil, errs
+	}
+
+	elements := make([]Element, 0, len(raws))
+	sliders := 0
+	ids := map[string]bool{}
+	for i, raw := range raws {
+		path := fmt.Sprintf("elements[%d]", i)
+		el, field, err := decode(raw, true)
+		if err != nil {
+			errs.add(path+field, "%s", err)
+			continue
+		}
+		b := el.base()
+		if b.Version == 0 {
+			b.Version = SchemaVersion
+		} else if b.Version != SchemaVersion {
+			errs.add(path+".version", "unsupported schema version %d", b.Version)
+			continue
+		}
+		if b.ID == "" && interactive[b.Type] {
+			b.ID = NewID()
+		}
+		el.validate(errs, path, ctx)
+		if b.ID != "" {
+			if ids[b.ID] {
+				errs.add(path+".id", "is used by another element")
+			}
+			ids[b.ID] = true
+		}
+		if b.Type == TypeSlider {
+			if sliders++; sliders > 1 {
+				errs.add(path, "a slide can have only one slider")
+			}
+		}
+		elements = append(elements, el)
+	}
+	if len(errs.Fields) > 0 {
+		return nil, errs
+	}
+	return elements, nil
+}
+
+// Normalize validates a payload like Parse and returns it as it should be
+// stored: versioned and with only the known fields.
+func Normalize(data []byte, ctx Context) (json.RawMessage, error) {
+	elements, err := Parse(data, ctx)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(elements)
+}
+
+// Stored reads a payload as it was saved, skipping elements it can't
+// read rather than failing like Parse.
+func Stored(data []byte) []Element {
+	var raws []json.RawMessage
+	if json.Unmarshal(data, &raws) != nil {
+		return nil
+	}
+	els := make([]Element, 0, len(raws))
+	for _, raw := range raws {
+		if el, _, err := decode(raw, false); err == nil {
+			els = append(els, el)
+		}
+	}
+	return els
+}
+
+// Public returns a stored payload as it is shown to viewers at ctx:
+// without what they shouldn't see before responding, such as quiz
+// answers, with countdown targets resolved, and without countdowns that
+// have passed. hideSlide reports a passed countdown that hides the whole
+// slide. Elements that can't be read are left out.
+func Public(data []byte, ctx Context) (out json.RawMessage, hideSlide bool) {
+	els := Stored(data)
+	public := make([]any, 0, len(els))
+	for _, el := range els {
+		switch el := el.(type) {
+		case *Quiz:
+			q := *el
+			q.Correct = nil
+			public = append(public, &q)
+		case *Countdown:
+			target := el.target(ctx)
+			if target == nil || !target.After(ctx.Now) {
+				if el.HideSlide {
+					return json.RawMessage("[]"), true
+				}
+				continue
+			}
+			public = append(public, publicCountdown{
+				Base:         el.Base,
+				Label:        el.Label,
+				Target:       target.In(timeutil.Tehran),
+				TargetEpoch:  target.Unix(),
+				TargetJalali: timeutil.FormatJalali(*target),
+			})
+		default:
+			public = append(public, el)
+		}
+	}
+	out, err := json.Marshal(public)
+	if err != nil {
+		return json.RawMessage("[]"), false
+	}
+	return out, false
+}
+
+// publicCountdown is a countdown as viewers get it, with its target in
+// Unix seconds and as a Jalali date and Tehran time.
+type publicCountdown struct {
+	Base
+	Label        string    `json:"label,omitempty"`
+	Target       time.Time `json:"target"`
+	TargetEpoch  int64     `json:"target_epoch"`
+	TargetJalali string    `json:"target_jalali"`
+}
+
+// Find returns the element with the given ID in a stored payload, or nil.
+func Find(data []byte, id string) Element {
+	if id == "" {
+		return nil
+	}
+	for _, el := range Stored(data) {
+		if el.base().ID == id {
+			return el
+		}
+	}
+	return nil
+}
+
+// NewID makes a random element ID.
+func NewID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// decode reads one element of a known type. strict rejects fields the
+// type doesn't have. On failure field is the failing field's path suffix,
+// e.g. ".x", or empty when it is the element itself.
+func decode(raw json.RawMessage, strict bool) (el Element, field string, err error) {
+	var probe struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(raw, &probe); err != nil {
+		return nil, "", errors.New("must be an object with a type")
+	}
+	newElement, ok := types[probe.Type]
+	if !ok {
+		return nil, ".type", fmt.Errorf("unknown element type %q", probe.Type)
+	}
+	el = newElement()
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(el); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			kind := "string"
+			if typeErr.Type.Kind() != reflect.String {
+				kind = "number"
+			}
+			return nil, "." + typeErr.Field, errors.New("must be a " + kind)
+		}
+		// Countdown targets are the only times elements have
+		var timeErr *time.ParseError
+		if errors.As(err, &timeErr) {
+			return nil, ".target", errors.New("must be a time like 2006-01-02T15:04:05+03:30")
+		}
+		return nil, "", errors.New(strings.TrimPrefix(err.Error(), "json: "))
+	}
+	return el, "", nil
+}
+
+func (b *Base) base() *Base { return b }
+
+func (b *Base) validate(errs *ValidationError, path string, ctx Context) {
+	if b.ID != "" && (len(b.ID) > MaxIDLength || !idPattern.MatchString(b.ID)) {
+		errs.add(path+".id", "must be up to %d letters, digits, - or _", MaxIDLength)
+	}
+	if b.X < 0 || b.X > 100 {
+		errs.add(path+".x", "must be between 0 and 100")
+	}
+	if b.Y < 0 || b.Y > 100 {
+		errs.add(path+".y", "must be between 0 and 100")
+	}
+}
+
+func (b *Base) repair() bool {
+	b.Version = SchemaVersion
+	if b.ID != "" && (len(b.ID) > MaxIDLength || !idPattern.MatchString(b.ID)) {
+		b.ID = ""
+	}
+	b.X = min(max(b.X, 0), 100)
+	b.Y = min(max(b.Y, 0), 100)
+	return true
+}
+
+func (l *Link) validate(errs *ValidationError, path string, ctx Context) {
+	l.Base.validate(errs, path, ctx)
+	validateText(errs, path+".text", l.Text, MaxLinkText)
+	if msg := checkURL(l.URL); msg != "" {
+		errs.add(path+".url", "%s", msg)
+	}
+}
+
+func (l *Link) repair() bool {
+	l.Base.repair()
+	l.Text = truncate(strings.TrimSpace(l.Text), MaxLinkText)
+	l.URL = strings.TrimSpace(l.URL)
+	return l.Text != "" && checkURL(l.URL) == ""
+}
+
+func (s *Slider) validate(errs *ValidationError, path string, ctx Context) {
+	s.Base.validate(errs, path, ctx)
+	validateText(errs, path+".emoji", s.Emoji, MaxEmoji)
+}
+
+func (s *Slider) repair() bool {
+	s.Base.repair()
+	s.Emoji = strings.TrimSpace(s.Emoji)
+	return s.Emoji != "" && len([]rune(s.Emoji)) <= MaxEmoji
+}
+
+func (t *Text) validate(errs *ValidationError, path string, ctx Context) {
+	t.Base.validate(errs, path, ctx)
+	validateText(errs, path+".content", t.Content, MaxTextContent)
+}
+
+func (t *Text) repair() bool {
+	t.Base.repair()
+	t.Content = truncate(strings.TrimSpace(t.Content), MaxTextContent)
+	return t.Content != ""
+}
+
+func (p *Poll) validate(errs *ValidationError, path string, ctx Context) {
+	p.Base.validate(errs, path, ctx)
+	validateChoices(errs, path, p.Question, p.Options)
+}
+
+func (p *Poll) repair() bool {
+	p.Base.repair()
+	p.Question, p.Options, _ = repairChoices(p.Question, p.Options)
+	return p.Question != "" && len(p.Options) >= MinPollOptions
+}
+
+func (q *Quiz) validate(errs *ValidationError, path string, ctx Context) {
+	q.Base.validate(errs, path, ctx)
+	validateChoices(errs, path, q.Question, q.Options)
+	if q.Correct == nil {
+		errs.add(path+".correct", "is required")
+	} else if *q.Correct < 0 || *q.Correct >= len(q.Options) {
+		errs.add(path+".correct", "must be the index of one of the options")
+	}
+}
+
+func (q *Quiz) repair() bool {
+	q.Base.repair()
+	var moved []int
+	q.Question, q.Options, moved = repairChoices(q.Question, q.Options)
+	if q.Correct == nil || *q.Correct < 0 || *q.Correct >= len(moved) || moved[*q.Correct] < 0 {
+		return false
+	}
+	correct := moved[*q.Correct]
+	q.Correct = &correct
+	return q.Question != "" && len(q.Options) >= MinPollOptions
+}
+
+func (d *Countdown) validate(errs *ValidationError, path string, ctx Context) {
+	d.Base.validate(errs, path, ctx)
+	if n := len([]rune(d.Label)); n > MaxCountdownLabel {
+		errs.add(path+".label", "must be at most %d characters, got %d", MaxCountdownLabel, n)
+	}
+	switch {
+	case d.Until != "" && d.Until != UntilGroupEnd:
+		errs.add(path+".until", "must be %q", UntilGroupEnd)
+	case d.Until != "" && d.Target != nil:
+		errs.add(path+".target", "must be left out when until is set")
+	case d.Until == UntilGroupEnd && ctx.GroupEndsAt == nil:
+		errs.add(path+".until", "the group has no end time")
+	case d.Until == UntilGroupEnd && !ctx.GroupEndsAt.After(ctx.Now) && !d.saved(ctx):
+		errs.add(path+".until", "the group has already ended")
+	case d.Until == "" && d.Target == nil:
+		errs.add(path+".target", "is required unless until is set")
+	case d.Target != nil && !d.Target.After(ctx.Now) && !d.saved(ctx):
+		errs.add(path+".target", "has already passed")
+	case d.Target != nil && d.Target.Sub(ctx.Now) > MaxCountdownAhead:
+		errs.add(path+".target", "must be within %d days", int(MaxCountdownAhead/(24*time.Hour)))
+	}
+}
+
+// saved reports whether the slide already had this countdown, so one that
+// has run out since doesn't block editing the rest of the slide; viewers
+// stop seeing it either way.
+func (d *Countdown) saved(ctx Context) bool {
+	for _, el := range Stored(ctx.Stored) {
+		s, ok := el.(*Countdown)
+		if !ok || s.Until != d.Until || (s.Target == nil) != (d.Target == nil) {
+			continue
+		}
+		if s.Target == nil || s.Target.Equal(*d.Target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Countdown) repair() bool {
+	d.Base.repair()
+	d.Label = truncate(strings.TrimSpace(d.Label), MaxCountdownLabel)
+	if d.Until == UntilGroupEnd {
+		d.Target = nil
+	} else {
+		d.Until = ""
+	}
+	return d.Until != "" || d.Target != nil
+}
+
+// target is when the countdown ends at ctx, or nil if it can't.
+func (d *Countdown) target(ctx Context) *time.Time {
+	if d.Until == UntilGroupEnd {
+		return ctx.GroupEndsAt
+	}
+	return d.Target
+}
+
+// validateChoices checks the question and options of a poll or quiz.
+func validateChoices(errs *ValidationError, path, question string, options []string) {
+	validateText(errs, path+".question", question, MaxPollText)
+	if n := len(options); n < MinPollOptions || n > MaxPollOptions {
+		errs.add(path+".options", "must have %d to %d options, got %d", MinPollOptions, MaxPollOptions, n)
+	}
+	for i, o := range options {
+		validateText(errs, fmt.Sprintf("%s.options[%d]", path, i), o, MaxPollOption)
+	}
+}
+
+// repairChoices trims a poll or quiz question and drops blank and extra
+// options. moved maps each original option to its new index, or -1.
+func repairChoices(question string, options []string) (string, []string, []int) {
+	question = truncate(strings.TrimSpace(question), MaxPollText)
+	kept := []string{}
+	moved := make([]int, len(options))
+	for i, o := range options {
+		moved[i] = -1
+		if o = truncate(strings.TrimSpace(o), MaxPollOption); o != "" && len(kept) < MaxPollOptions {
+			moved[i] = len(kept)
+			kept = append(kept, o)
+		}
+	}
+	return question, kept, moved
+}
+
+// validateText requires a non-blank string of at most max characters.
+func validateText(errs *ValidationError, field, s string, max int) {
+	if strings.TrimSpace(s) == "" {
+		errs.add(field, "is required")
+	} else if n := len([]rune(s)); n > max {
+		errs.add(field, "must be at most %d characters, got %d", max, n)
+	}
+}
+
+// truncate cuts s to at most max characters.
+func truncate(s string, max int) string {
+	if r := []rune(s); len(r) > max {
+		return strings.TrimSpace(string(r[:max]))
+	}
+	return s
+}
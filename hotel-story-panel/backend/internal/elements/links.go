@@ -0,0 +1,68 @@
+package elements
+
+import (
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// allowedHosts are the hosts link elements may point to, with their
+// subdomains. Empty allows any host.
+var allowedHosts []string
+
+// Init reads LINK_ALLOWED_HOSTS, a comma-separated list of hosts that link
+// elements may point to (each also allows its subdomains). Without it any
+// host is allowed. Either way links must be http(s) URLs or paths on the
+// site itself.
+func Init() {
+	allowedHosts = nil
+	for _, h := range strings.Split(os.Getenv("LINK_ALLOWED_HOSTS"), ",") {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			allowedHosts = append(allowedHosts, h)
+		}
+	}
+	if len(allowedHosts) > 0 {
+		log.Println("Link elements limited to:", strings.Join(allowedHosts, ", "))
+	}
+}
+
+// checkURL returns what is wrong with a link URL, or "".
+func checkURL(raw string) string {
+	switch {
+	case strings.TrimSpace(raw) == "":
+		return "is required"
+	case len(raw) > MaxURLLength:
+		return "is too long"
+	case strings.ContainsFunc(raw, func(r rune) bool { return r == '\\' || unicode.IsControl(r) }):
+		// Browsers read \ as / and drop control characters, so "/\evil.com"
+		// would leave the site
+		return "must not contain backslashes or control characters"
+	}
+
+	u, err := url.Parse(raw)
+	if err == nil && strings.HasPrefix(raw, "/") && u.Scheme == "" && u.Host == "" {
+		return "" // a path on the site
+	}
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "must be an http(s) URL or a path starting with /"
+	}
+	if !hostAllowed(u.Hostname()) {
+		return "links to " + u.Hostname() + " are not allowed"
+	}
+	return ""
+}
+
+func hostAllowed(host string) bool {
+	if len(allowedHosts) == 0 {
+		return true
+	}
+	host = strings.ToLower(host)
+	for _, h := range allowedHosts {
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package elements
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Repair rewrites a stored elements payload to the current schema. What
+// can be fixed is: coordinates are clamped, long text is cut, unknown
+// fields are dropped and missing or clashing IDs are replaced. Elements that can't be fixed are removed: unknown
+// types, missing or disallowed values, extra sliders and any beyond
+// MaxElements. It returns the repaired payload, a note for each change
+// beyond the version upgrade, and whether anything changed at all.
+func Repair(data []byte) (json.RawMessage, []string, bool) {
+	var notes []string
+	var raws []json.RawMessage
+	if err := json.Unmarshal(bytes.TrimSpace(data), &raws); err != nil {
+		return json.RawMessage("[]"), []string{"not a JSON array; cleared"}, true
+	}
+
+	kept := []Element{}
+	sliders := 0
+	ids := map[string]bool{}
+	for i, raw := range raws {
+		path := fmt.Sprintf("elements[%d]", i)
+		el, field, err := decode(raw, false)
+		if err != nil {
+			notes = append(notes, path+": dropped, "+path+field+" "+err.Error())
+			continue
+		}
+		if v := el.base().Version; v > SchemaVersion {
+			notes = append(notes, fmt.Sprintf("%s: dropped, unsupported schema version %d", path, v))
+			continue
+		}
+		if !el.repair() {
+			notes = append(notes, path+": dropped, missing or disallowed values")
+			continue
+		}
+		// Missing IDs follow the element's position, so a slide's draft and
+		// its published copies get the same ones
+		if b := el.base(); b.ID != "" || interactive[b.Type] {
+			if b.ID == "" {
+				b.ID = fmt.Sprintf("%s-%d", b.Type, i)
+			}
+			if ids[b.ID] {
+				b.ID = NewID()
+			}
+			ids[b.ID] = true
+		}
+		if el.base().Type == TypeSlider {
+			if sliders++; sliders > 1 {
+				notes = append(notes, path+": dropped, a slide can have only one slider")
+				continue
+			}
+		}
+		if len(kept) == MaxElements {
+			notes = append(notes, fmt.Sprintf("%s: dropped, over the limit of %d elements", path, MaxElements))
+			continue
+		}
+		if fixed, _ := json.Marshal(el); !sameJSON(raw, fixed, "version") {
+			notes = append(notes, path+": fixed")
+		}
+		kept = append(kept, el)
+	}
+
+	fixed, err := json.Marshal(kept)
+	if err != nil {
+		return json.RawMessage("[]"), append(notes, "could not be encoded; cleared"), true
+	}
+	return fixed, notes, !sameJSON(data, fixed)
+}
+
+// sameJSON reports whether a and b hold the same JSON value, ignoring the
+// given top-level object keys.
+func sameJSON(a, b []byte, ignore ...string) bool {
+	var va, vb any
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	for _, key := range ignore {
+		if m, ok := va.(map[string]any); ok {
+			delete(m, key)
+		}
+		if m, ok := vb.(map[string]any); ok {
+			delete(m, key)
+		}
+	}
+	return reflect.DeepEqual(va, vb)
+}
@@ -0,0 +1,74 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Event types sent by the story viewer.
+const (
+	Impression    = "impression"     // story ring shown in search results
+	GroupOpen     = "group_open"     // ring tapped, viewer opened
+	SlideView     = "slide_view"     // slide became visible
+	SlideComplete = "slide_complete" // slide timer ran out
+	TapNext       = "tap_next"
+	TapBack       = "tap_back"
+	Exit          = "exit"       // viewer closed
+	LinkClick     = "link_click" // link element tapped
+)
+
+var validTypes = map[string]bool{
+	Impression: true, GroupOpen: true, SlideView: true, SlideComplete: true,
+	TapNext: true, TapBack: true, Exit: true, LinkClick: true,
+}
+
+// slideTypes must reference a slide.
+var slideTypes = map[string]bool{
+	SlideView: true, SlideComplete: true, TapNext: true, TapBack: true, LinkClick: true,
+}
+
+type Event struct {
+	Type       string          `json:"type"`
+	GroupID    int             `json:"group_id"`
+	SlideID    *int            `json:"slide_id"`
+	SessionID  string          `json:"session_id"`
+	ViewerID   string          `json:"viewer_id"`
+	WatchMs    *int            `json:"watch_ms"`
+	Meta       json.RawMessage `json:"meta"`
+	OccurredAt time.Time       `json:"occurred_at"`
+}
+
+// maxClockSkew bounds how far client timestamps may drift from the server's.
+const maxClockSkew = 24 * time.Hour
+
+// Validate checks a client-submitted event and normalizes its timestamp.
+func (e *Event) Validate(now time.Time) error {
+	if !validTypes[e.Type] {
+		return fmt.Errorf("unknown event type %q", e.Type)
+	}
+	if e.GroupID <= 0 {
+		return fmt.Errorf("%s: group_id is required", e.Type)
+	}
+	if slideTypes[e.Type] && (e.SlideID == nil || *e.SlideID <= 0) {
+		return fmt.Errorf("%s: slide_id is required", e.Type)
+	}
+	if len(e.SessionID) > 64 || len(e.ViewerID) > 64 {
+		return fmt.Errorf("%s: session_id and viewer_id are limited to 64 characters", e.Type)
+	}
+	if e.WatchMs != nil && (*e.WatchMs < 0 || *e.WatchMs > int(time.Hour/time.Millisecond)) {
+		return fmt.Errorf("%s: watch_ms out of range", e.Type)
+	}
+	if len(e.Meta) > 1024 {
+		return fmt.Errorf("%s: meta is limited to 1KB", e.Type)
+	}
+	if len(e.Meta) > 0 && !json.Valid(e.Meta) {
+		return fmt.Errorf("%s: meta must be valid JSON", e.Type)
+	}
+
+	// Trust the client clock only when it's plausible
+	if e.OccurredAt.IsZero() || e.OccurredAt.After(now.Add(5*time.Minute)) || e.OccurredAt.Before(now.Add(-maxClockSkew)) {
+		e.OccurredAt = now
+	}
+	return nil
+}
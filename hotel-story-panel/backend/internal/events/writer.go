@@ -0,0 +1,247 @@
+package events
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// Writer buffers events in memory and flushes them to story_events in
+// batches, so a burst of taps costs one COPY instead of one write per tap.
+// When the buffer is full new events are dropped rather than blocking the
+// request; drops are counted in Metrics.
+type Writer struct {
+	db        *sqlx.DB
+	queue     chan Event
+	batchSize int
+	interval  time.Duration
+
+	accepted    atomic.Uint64
+	dropped     atomic.Uint64
+	written     atomic.Uint64
+	failed      atomic.Uint64
+	lastFlushAt atomic.Int64
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+type Metrics struct {
+	Accepted    uint64     `json:"accepted"`
+	Dropped     uint64     `json:"dropped"`
+	Written     uint64     `json:"written"`
+	Failed      uint64     `json:"failed"`
+	Queued      int        `json:"queued"`
+	Capacity    int        `json:"capacity"`
+	LastFlushAt *time.Time `json:"last_flush_at"`
+}
+
+// Default is the process-wide writer started by InitWriter.
+var Default *Writer
+
+// InitWriter starts Default. EVENT_BUFFER_SIZE, EVENT_BATCH_SIZE and
+// EVENT_FLUSH_INTERVAL (e.g. "2s") override the defaults.
+func InitWriter(db *sqlx.DB) {
+	capacity := envInt("EVENT_BUFFER_SIZE", 10000)
+	batchSize := envInt("EVENT_BATCH_SIZE", 500)
+	interval := 2 * time.Second
+	if v, err := time.ParseDuration(os.Getenv("EVENT_FLUSH_INTERVAL")); err == nil && v > 0 {
+		interval = v
+	}
+
+	Default = NewWriter(db, capacity, batchSize, interval)
+	Default.Start()
+}
+
+// CloseWriter flushes whatever is still buffered. Call it on shutdown.
+func CloseWriter() {
+	if Default != nil {
+		Default.Close()
+	}
+}
+
+// Record enqueues e on Default, reporting false if it was dropped.
+func Record(e Event) bool {
+	return Default.Enqueue(e)
+}
+
+func NewWriter(db *sqlx.DB, capacity, batchSize int, interval time.Duration) *Writer {
+	return &Writer{
+		db:        db,
+		queue:     make(chan Event, capacity),
+		batchSize: batchSize,
+		interval:  interval,
+		stop:      make(chan struct{}),
+	}
+}
+
+func (w *Writer) Start() {
+	w.wg.Add(1)
+	go w.run()
+}
+
+// Close stops the writer after flushing the remaining buffer.
+func (w *Writer) Close() {
+	close(w.stop)
+	w.wg.Wait()
+}
+
+// Enqueue buffers e without blocking.
+func (w *Writer) Enqueue(e Event) bool {
+	select {
+	case w.queue <- e:
+		w.accepted.Add(1)
+		return true
+	default:
+		w.dropped.Add(1)
+		return false
+	}
+}
+
+func (w *Writer) Metrics() Metrics {
+	m := Metrics{
+		Accepted: w.accepted.Load(),
+		Dropped:  w.dropped.Load(),
+		Written:  w.written.Load(),
+		Failed:   w.failed.Load(),
+		Queued:   len(w.queue),
+		Capacity: cap(w.queue),
+	}
+	if ts := w.lastFlushAt.Load(); ts > 0 {
+		t := time.Unix(0, ts)
+		m.LastFlushAt = &t
+	}
+	return m
+}
+
+func (w *Writer) run() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	batch := make([]Event, 0, w.batchSize)
+	for {
+		select {
+		case e := <-w.queue:
+			batch = append(batch, e)
+			if len(batch) >= w.batchSize {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+		case <-w.stop:
+			// Drain what's left, then exit
+			for {
+				select {
+				case e := <-w.queue:
+					batch = append(batch, e)
+					if len(batch) >= w.batchSize {
+						w.flush(batch)
+						batch = batch[:0]
+					}
+				default:
+					if len(batch) > 0 {
+						w.flush(batch)
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+func (w *Writer) flush(batch []Event) {
+	if err := w.write(batch); err != nil {
+		w.failed.Add(uint64(len(batch)))
+		log.Printf("Event writer: failed to flush %d events: %v", len(batch), err)
+		return
+	}
+	w.written.Add(uint64(len(batch)))
+	w.lastFlushAt.Store(time.Now().UnixNano())
+}
+
+// write copies the batch into story_events and folds it into the legacy
+// view/open counters the dashboard reads, all in one transaction.
+func (w *Writer) write(batch []Event) error {
+	tx, err := w.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(pq.CopyIn("story_events",
+		"event_type", "group_id", "slide_id", "session_id", "viewer_id", "watch_ms", "meta", "occurred_at"))
+	if err != nil {
+		return err
+	}
+
+	groupViews := map[int]int{}
+	groupOpens := map[int]int{}
+	slideOpens := map[int]int{}
+
+	for _, e := range batch {
+		var groupID, meta any
+		if e.GroupID > 0 {
+			groupID = e.GroupID
+		}
+		if len(e.Meta) > 0 {
+			meta = string(e.Meta)
+		}
+		if _, err := stmt.Exec(e.Type, groupID, e.SlideID, e.SessionID, e.ViewerID, e.WatchMs, meta, e.OccurredAt); err != nil {
+			stmt.Close()
+			return err
+		}
+
+		switch e.Type {
+		case Impression:
+			groupViews[e.GroupID]++
+		case GroupOpen:
+			groupOpens[e.GroupID]++
+		case SlideView:
+			slideOpens[*e.SlideID]++
+		}
+	}
+	if _, err := stmt.Exec(); err != nil {
+		stmt.Close()
+		return err
+	}
+	if err := stmt.Close(); err != nil {
+		return err
+	}
+
+	for id, n := range groupViews {
+		if _, err := tx.Exec("UPDATE story_groups SET view_count = view_count + $1 WHERE id = $2", n, id); err != nil {
+			return err
+		}
+	}
+	for id, n := range groupOpens {
+		if _, err := tx.Exec("UPDATE story_groups SET open_count = open_count + $1 WHERE id = $2", n, id); err != nil {
+			return err
+		}
+	}
+	for id, n := range slideOpens {
+		if _, err := tx.Exec("UPDATE story_slides SET open_count = open_count + $1 WHERE id = $2", n, id); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func envInt(name string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(name)); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
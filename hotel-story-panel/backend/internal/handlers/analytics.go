@@ -0,0 +1,505 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"hotel-story-panel/backend/internal/database"
+	"hotel-story-panel/backend/internal/elements"
+	"hotel-story-panel/backend/internal/models"
+	"hotel-story-panel/backend/internal/timeutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+// watchEvents end a slide and carry the time spent on it. link_click is
+// excluded because the slide keeps playing afterwards.
+const watchEvents = `('slide_complete', 'tap_next', 'tap_back', 'exit')`
+
+// parseDateRange reads ?from=YYYY-MM-DD&to=YYYY-MM-DD as Tehran calendar
+// days (to is inclusive) and returns the half-open range [from, to+1 day).
+// It defaults to the last 30 days.
+func parseDateRange(c *gin.Context) (time.Time, time.Time, error) {
+	today := timeutil.StartOfDay(time.Now())
+	from := today.AddDate(0, 0, -29)
+	to := today
+
+	if v := c.Query("from"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, timeutil.Tehran)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("from must be YYYY-MM-DD")
+		}
+		from = t
+	}
+	if v := c.Query("to"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, timeutil.Tehran)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("to must be YYYY-MM-DD")
+		}
+		to = t
+	}
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, errors.New("to must not be before from")
+	}
+	if to.Sub(from) > 366*24*time.Hour {
+		return time.Time{}, time.Time{}, errors.New("date range is limited to one year")
+	}
+	return from, to.AddDate(0, 0, 1), nil
+}
+
+func percent(part, whole int) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return math.Round(float64(part)/float64(whole)*1000) / 10
+}
+
+func GetGroupAnalytics(c *gin.Context) {
+	id := c.Param("id")
+	if !groupInScope(c, id) {
+		return
+	}
+	from, to, err := parseDateRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report := models.GroupAnalytics{From: from, To: to}
+	err = database.DB.Get(&report.GroupID, "SELECT id FROM story_groups WHERE id = $1", id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	// Funnel top: impressions and opens
+	var top struct {
+		Impressions int `db:"impressions"`
+		Opens       int `db:"opens"`
+	}
+	err = database.DB.Get(&top, `
+		SELECT
+			COUNT(*) FILTER (WHERE event_type = 'impression') AS impressions,
+			COUNT(*) FILTER (WHERE event_type = 'group_open') AS opens
+		FROM story_events
+		WHERE group_id = $1 AND occurred_at >= $2 AND occurred_at < $3`, report.GroupID, from, to)
+	if err != nil {
+		log.Printf("GetGroupAnalytics DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch analytics"})
+		return
+	}
+	report.Impressions, report.Opens = top.Impressions, top.Opens
+	report.CTR = percent(top.Opens, top.Impressions)
+
+	// Per-session depth and watch time
+	var sessions struct {
+		Count           int     `db:"sessions"`
+		AvgSlidesViewed float64 `db:"avg_slides_viewed"`
+		AvgWatchMs      float64 `db:"avg_watch_ms"`
+	}
+	err = database.DB.Get(&sessions, `
+		SELECT
+			COUNT(*) AS sessions,
+			COALESCE(AVG(slides_viewed), 0) AS avg_slides_viewed,
+			COALESCE(AVG(watch_ms), 0) AS avg_watch_ms
+		FROM (
+			SELECT
+				session_id,
+				COUNT(DISTINCT slide_id) FILTER (WHERE event_type = 'slide_view') AS slides_viewed,
+				COALESCE(SUM(watch_ms) FILTER (WHERE event_type IN `+watchEvents+`), 0) AS watch_ms
+			FROM story_events
+			WHERE group_id = $1 AND session_id <> '' AND occurred_at >= $2 AND occurred_at < $3
+			GROUP BY session_id
+			HAVING COUNT(*) FILTER (WHERE event_type = 'slide_view') > 0
+		) s`, report.GroupID, from, to)
+	if err != nil {
+		log.Printf("GetGroupAnalytics DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch analytics"})
+		return
+	}
+	report.Sessions = sessions.Count
+	report.AvgSlidesViewed = math.Round(sessions.AvgSlidesViewed*100) / 100
+	report.AvgWatchMs = math.Round(sessions.AvgWatchMs)
+
+	// Per-slide reach and completion
+	stats := []models.SlideAnalytics{}
+	err = database.DB.Select(&stats, `
+		SELECT
+			slide_id,
+			COUNT(*) FILTER (WHERE event_type = 'slide_view') AS views,
+			COUNT(DISTINCT session_id) FILTER (WHERE event_type = 'slide_view') AS reach,
+			COUNT(DISTINCT session_id) FILTER (WHERE event_type = 'slide_complete') AS completions,
+			COUNT(DISTINCT session_id) FILTER (WHERE event_type = 'exit') AS exits,
+			COALESCE(AVG(watch_ms) FILTER (WHERE event_type IN `+watchEvents+`), 0) AS avg_watch_ms
+		FROM story_events
+		WHERE group_id = $1 AND slide_id IS NOT NULL AND session_id <> ''
+			AND occurred_at >= $2 AND occurred_at < $3
+		GROUP BY slide_id`, report.GroupID, from, to)
+	if err != nil {
+		log.Printf("GetGroupAnalytics DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch analytics"})
+		return
+	}
+	bySlide := make(map[int]models.SlideAnalytics, len(stats))
+	for _, s := range stats {
+		bySlide[s.SlideID] = s
+	}
+
+	// Poll votes cast in the range
+	var votes []voteCount
+	err = database.DB.Select(&votes, `
+		SELECT slide_id, element_id, option_index, COUNT(*) AS votes
+		FROM poll_votes
+		WHERE group_id = $1 AND created_at >= $2 AND created_at < $3
+		GROUP BY slide_id, element_id, option_index`, report.GroupID, from, to)
+	if err != nil {
+		log.Printf("GetGroupAnalytics DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch analytics"})
+		return
+	}
+
+	// Lay the stats over the published slide order so the funnel follows
+	// what viewers actually step through
+	slides, err := reportSlides(report.GroupID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch slides"})
+		return
+	}
+
+	report.Slides = make([]models.SlideAnalytics, 0, len(slides))
+	prevReach := report.Sessions
+	for i, slide := range slides {
+		slideID := slide.ID
+		s := bySlide[slideID]
+		s.SlideID = slideID
+		s.Position = i + 1
+		s.CompletionRate = percent(s.Completions, s.Reach)
+		s.AvgWatchMs = math.Round(s.AvgWatchMs)
+		if prevReach > 0 && s.Reach < prevReach {
+			s.DropOff = percent(prevReach-s.Reach, prevReach)
+		}
+		prevReach = s.Reach
+		s.Polls = slidePolls(slideID, slide.Elements, votes)
+		report.Slides = append(report.Slides, s)
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// reportSlide is a slide's id and elements.
+type reportSlide struct {
+	ID       int             `db:"id"`
+	Elements json.RawMessage `db:"elements"`
+}
+
+// reportSlides lists the slides of a group's published version in the
+// order viewers step through them, since that is what their responses
+// were given to. Groups never published fall back to the draft.
+func reportSlides(groupID int) ([]reportSlide, error) {
+	var slides []reportSlide
+	err := database.DB.Select(&slides, `
+		SELECT (e.s->>'id')::int AS id, COALESCE(e.s->'elements', '[]'::jsonb) AS elements
+		FROM story_groups g
+		JOIN story_group_versions v ON v.group_id = g.id AND v.version = g.published_version
+		CROSS JOIN LATERAL jsonb_array_elements(v.content->'slides') WITH ORDINALITY AS e(s, ord)
+		WHERE g.id = $1
+		ORDER BY e.ord`, groupID)
+	if err != nil || len(slides) > 0 {
+		return slides, err
+	}
+	err = database.DB.Select(&slides, "SELECT id, COALESCE(elements, '[]'::jsonb) AS elements FROM story_slides WHERE group_id = $1 ORDER BY sort_order ASC, id ASC", groupID)
+	return slides, err
+}
+
+// slidePolls tallies the votes on each poll element of a slide.
+func slidePolls(slideID int, data json.RawMessage, votes []voteCount) []models.PollResults {
+	var polls []models.PollResults
+	for _, el := range elements.Stored(data) {
+		if poll, ok := el.(*elements.Poll); ok {
+			polls = append(polls, tallyPoll(slideID, poll, votes))
+		}
+	}
+	return polls
+}
+
+// GetGroupSliders summarises the responses to each emoji slider on the
+// group's slides: count, average and a histogram, for ?from/?to.
+func GetGroupSliders(c *gin.Context) {
+	id := c.Param("id")
+	if !groupInScope(c, id) {
+		return
+	}
+	from, to, err := parseDateRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var groupID int
+	if err := database.DB.Get(&groupID, "SELECT id FROM story_groups WHERE id = $1", id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	var buckets []struct {
+		SlideID   int    `db:"slide_id"`
+		ElementID string `db:"element_id"`
+		Bucket    int    `db:"bucket"`
+		Responses int    `db:"responses"`
+		Total     int    `db:"total"`
+	}
+	err = database.DB.Select(&buckets, `
+		SELECT slide_id, element_id, LEAST(value / 10, 9) AS bucket,
+			COUNT(*) AS responses, SUM(value) AS total
+		FROM slider_responses
+		WHERE group_id = $1 AND created_at >= $2 AND created_at < $3
+		GROUP BY 1, 2, 3`, groupID, from, to)
+	if err != nil {
+		log.Printf("GetGroupSliders DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch slider responses"})
+		return
+	}
+
+	slides, err := reportSlides(groupID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch slides"})
+		return
+	}
+
+	sliders := []models.SliderResults{}
+	for i, slide := range slides {
+		for _, el := range elements.Stored(slide.Elements) {
+			slider, ok := el.(*elements.Slider)
+			if !ok || slider.ID == "" {
+				continue
+			}
+			r := models.SliderResults{
+				SlideID:   slide.ID,
+				Position:  i + 1,
+				ElementID: slider.ID,
+				Emoji:     slider.Emoji,
+				Histogram: make([]int, 10),
+			}
+			sum := 0
+			for _, b := range buckets {
+				if b.SlideID == slide.ID && b.ElementID == slider.ID {
+					r.Histogram[b.Bucket] += b.Responses
+					r.Count += b.Responses
+					sum += b.Total
+				}
+			}
+			if r.Count > 0 {
+				r.Average = math.Round(float64(sum)/float64(r.Count)*10) / 10
+			}
+			sliders = append(sliders, r)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"from": from, "to": to, "sliders": sliders})
+}
+
+// GetGroupQuizzes reports the answers to each quiz on the group's slides:
+// how many were correct and how they spread over the options, for
+// ?from/?to.
+func GetGroupQuizzes(c *gin.Context) {
+	id := c.Param("id")
+	if !groupInScope(c, id) {
+		return
+	}
+	from, to, err := parseDateRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var groupID int
+	if err := database.DB.Get(&groupID, "SELECT id FROM story_groups WHERE id = $1", id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	var counts []struct {
+		SlideID   int    `db:"slide_id"`
+		ElementID string `db:"element_id"`
+		Option    int    `db:"option_index"`
+		Answers   int    `db:"answers"`
+		Correct   int    `db:"correct"`
+	}
+	err = database.DB.Select(&counts, `
+		SELECT slide_id, element_id, option_index,
+			COUNT(*) AS answers, COUNT(*) FILTER (WHERE correct) AS correct
+		FROM quiz_answers
+		WHERE group_id = $1 AND created_at >= $2 AND created_at < $3
+		GROUP BY 1, 2, 3`, groupID, from, to)
+	if err != nil {
+		log.Printf("GetGroupQuizzes DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch quiz answers"})
+		return
+	}
+
+	slides, err := reportSlides(groupID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch slides"})
+		return
+	}
+
+	quizzes := []models.QuizResults{}
+	for i, slide := range slides {
+		for _, el := range elements.Stored(slide.Elements) {
+			quiz, ok := el.(*elements.Quiz)
+			if !ok || quiz.ID == "" {
+				continue
+			}
+			r := models.QuizResults{
+				SlideID:   slide.ID,
+				Position:  i + 1,
+				ElementID: quiz.ID,
+				Question:  quiz.Question,
+				Options:   make([]models.QuizOption, len(quiz.Options)),
+			}
+			for oi, text := range quiz.Options {
+				r.Options[oi] = models.QuizOption{Text: text, Correct: quiz.Correct != nil && *quiz.Correct == oi}
+			}
+			// Correctness was judged when answering; answers to options
+			// since removed still count towards the totals
+			for _, n := range counts {
+				if n.SlideID != slide.ID || n.ElementID != quiz.ID {
+					continue
+				}
+				r.Total += n.Answers
+				r.CorrectAnswers += n.Correct
+				if n.Option >= 0 && n.Option < len(r.Options) {
+					r.Options[n.Option].Answers += n.Answers
+				}
+			}
+			r.PercentCorrect = percent(r.CorrectAnswers, r.Total)
+			for oi := range r.Options {
+				r.Options[oi].Percent = percent(r.Options[oi].Answers, r.Total)
+			}
+			quizzes = append(quizzes, r)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"from": from, "to": to, "quizzes": quizzes})
+}
+
+// GetTimeSeries returns impressions/opens/CTR per bucket from the rollup
+// tables, overall or filtered by ?group_id= and/or ?city_slug=.
+// ?granularity is "day" (default) or "hour".
+func GetTimeSeries(c *gin.Context) {
+	groupID, citySlug := c.Query("group_id"), c.Query("city_slug")
+
+	// Callers limited to some cities/hotels must ask for something in scope
+	scope, ok := callerScope(c)
+	if !ok {
+		return
+	}
+	if scope.limited {
+		switch {
+		case groupID != "":
+			if !groupInScope(c, groupID) {
+				return
+			}
+		case citySlug != "" && scope.covers(citySlug, nil):
+		default:
+			c.JSON(http.StatusForbidden, gin.H{"error": "Choose a group or city within your permissions"})
+			return
+		}
+	}
+
+	timeSeries(c, groupID, citySlug)
+}
+
+// GetGroupTimeSeries is GetTimeSeries scoped to one group.
+func GetGroupTimeSeries(c *gin.Context) {
+	if !groupInScope(c, c.Param("id")) {
+		return
+	}
+	timeSeries(c, c.Param("id"), "")
+}
+
+func timeSeries(c *gin.Context, groupID, citySlug string) {
+	from, to, err := parseDateRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	granularity := c.DefaultQuery("granularity", "day")
+	var query string
+	var step func(time.Time) time.Time
+	switch granularity {
+	case "hour":
+		if to.Sub(from) > 31*24*time.Hour {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Hourly series are limited to 31 days"})
+			return
+		}
+		query = `SELECT bucket, SUM(impressions) AS impressions, SUM(opens) AS opens,
+				SUM(slide_views) AS slide_views, SUM(completions) AS completions, SUM(link_clicks) AS link_clicks
+			FROM story_stats_hourly WHERE bucket >= $1 AND bucket < $2`
+		step = func(t time.Time) time.Time { return t.Add(time.Hour) }
+	case "day":
+		query = `SELECT day::timestamp AS bucket, SUM(impressions) AS impressions, SUM(opens) AS opens,
+				SUM(slide_views) AS slide_views, SUM(completions) AS completions, SUM(link_clicks) AS link_clicks
+			FROM story_stats_daily WHERE day >= $1::date AND day < $2::date`
+		step = func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "granularity must be hour or day"})
+		return
+	}
+
+	args := []any{from, to}
+	if granularity == "day" {
+		args = []any{from.Format("2006-01-02"), to.Format("2006-01-02")}
+	}
+	if groupID != "" {
+		args = append(args, groupID)
+		query += fmt.Sprintf(" AND group_id = $%d", len(args))
+	}
+	if citySlug != "" {
+		args = append(args, citySlug)
+		query += fmt.Sprintf(" AND city_slug = $%d", len(args))
+	}
+	query += " GROUP BY 1 ORDER BY 1"
+
+	rows := []models.TimeSeriesPoint{}
+	if err := database.DB.Select(&rows, query, args...); err != nil {
+		log.Printf("TimeSeries DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch time series"})
+		return
+	}
+
+	byBucket := make(map[string]models.TimeSeriesPoint, len(rows))
+	for _, r := range rows {
+		key := r.Bucket.UTC().Format(time.RFC3339)
+		if granularity == "day" {
+			key = r.Bucket.Format("2006-01-02")
+		}
+		byBucket[key] = r
+	}
+
+	// Zero-fill so charts get one point per bucket
+	points := []models.TimeSeriesPoint{}
+	for t := from; t.Before(to); t = step(t) {
+		key := t.UTC().Format(time.RFC3339)
+		if granularity == "day" {
+			key = t.Format("2006-01-02")
+		}
+		p := byBucket[key]
+		p.Bucket = t
+		p.CTR = percent(p.Opens, p.Impressions)
+		points = append(points, p)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"granularity": granularity,
+		"from":        from,
+		"to":          to,
+		"points":      points,
+	})
+}
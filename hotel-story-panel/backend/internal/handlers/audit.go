@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"hotel-story-panel/backend/internal/audit"
+	"hotel-story-panel/backend/internal/database"
+	"hotel-story-panel/backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Audited entity types.
+const (
+	auditGroup      = "group"
+	auditSlide      = "slide"
+	auditMedia      = "media"
+	auditCity       = "city"
+	auditUser       = "user"
+	auditInvitation = "invitation"
+	auditSettings   = "settings"
+	auditComment    = "comment"
+)
+
+// groupAudit is what the audit log keeps of a story group; counters and
+// computed fields are left out so they don't show up as changes.
+type groupAudit struct {
+	CitySlug  string         `db:"city_slug" json:"city_slug"`
+	TitleFa   string         `db:"title_fa" json:"title_fa"`
+	Caption   string         `db:"caption" json:"caption"`
+	CoverURL  string         `db:"cover_url" json:"cover_url"`
+	ShortCode string         `db:"short_code" json:"short_code"`
+	Active    bool           `db:"active" json:"active"`
+	StartsAt  *time.Time     `db:"starts_at" json:"starts_at"`
+	EndsAt    *time.Time     `db:"ends_at" json:"ends_at"`
+	Hotels    pq.StringArray `db:"hotels" json:"hotels"`
+}
+
+// slideAudit is what the audit log keeps of a slide. Rendition URLs follow
+// from image_url and are left out.
+type slideAudit struct {
+	GroupID         int             `db:"group_id" json:"group_id"`
+	MediaType       string          `db:"media_type" json:"media_type"`
+	ImageURL        string          `db:"image_url" json:"image_url"`
+	VideoURL        *string         `db:"video_url" json:"video_url"`
+	CaptionFa       string          `db:"caption_fa" json:"caption_fa"`
+	Elements        json.RawMessage `db:"elements" json:"elements"`
+	Duration        int             `db:"duration" json:"duration"`
+	BackgroundColor *string         `db:"background_color" json:"background_color"`
+	SortOrder       int             `db:"sort_order" json:"sort_order"`
+	HotelSlugs      pq.StringArray  `db:"hotel_slugs" json:"hotel_slugs"`
+}
+
+// citySnapshot loads a city for the audit log, or nil if it can't.
+func citySnapshot(id any) *models.City {
+	var city models.City
+	if err := database.DB.Get(&city, "SELECT id, slug, name_fa, aliases, active, created_at FROM cities WHERE id = $1", id); err != nil {
+		return nil
+	}
+	return &city
+}
+
+// groupSnapshot loads a group for the audit log, or nil if it can't.
+func groupSnapshot(id any) *groupAudit {
+	var g groupAudit
+	err := database.DB.Get(&g, `
+		SELECT city_slug, title_fa, caption, cover_url, short_code, active, starts_at, ends_at,
+			COALESCE((SELECT array_agg(hotel_slug ORDER BY hotel_slug) FROM story_group_hotels WHERE group_id = story_groups.id), '{}') AS hotels
+		FROM story_groups WHERE id = $1`, id)
+	if err != nil {
+		return nil
+	}
+	return &g
+}
+
+// slideSnapshot loads a slide for the audit log, or nil if it can't.
+func slideSnapshot(id any) *slideAudit {
+	var s slideAudit
+	err := database.DB.Get(&s, `
+		SELECT group_id, media_type, image_url, video_url, caption_fa, elements, duration, background_color, sort_order, hotel_slugs
+		FROM story_slides WHERE id = $1`, id)
+	if err != nil {
+		return nil
+	}
+	return &s
+}
+
+// recordAudit logs a change made by the caller. before and after are
+// diffed field by field; pass nil for the side that doesn't exist. The
+// change has already happened, so a failure here is logged rather than
+// returned.
+func recordAudit(c *gin.Context, action, entityType string, entityID any, before, after any) {
+	changes, err := audit.Diff(before, after)
+	if err == nil {
+		id := ""
+		if entityID != nil {
+			id = fmt.Sprint(entityID)
+		}
+		err = audit.Record(database.DB, audit.Entry{
+			UserID:     callerID(c),
+			Action:     action,
+			EntityType: entityType,
+			EntityID:   id,
+			Changes:    changes,
+			IP:         c.ClientIP(),
+		})
+	}
+	if err != nil {
+		log.Printf("Audit log error (%s %s %v): %v", action, entityType, entityID, err)
+	}
+}
+
+// GetAuditLog lists audit entries, newest first. Filters: user_id, entity
+// (with optional entity_id), action and from/to dates as in the analytics
+// endpoints; paged with limit (default 50, at most 200) and offset.
+func GetAuditLog(c *gin.Context) {
+	from, to, err := parseDateRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var userID *int
+	if v := c.Query("user_id"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "user_id must be a number"})
+			return
+		}
+		userID = &n
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 200"})
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "offset must not be negative"})
+		return
+	}
+
+	entries := []models.AuditEntry{}
+	err = database.DB.Select(&entries, `
+		SELECT a.id, a.user_id, u.email AS user_email, a.action, a.entity_type, a.entity_id, a.changes, a.ip, a.created_at
+		FROM audit_log a
+		LEFT JOIN users u ON u.id = a.user_id
+		WHERE a.created_at >= $1 AND a.created_at < $2
+			AND ($3::int IS NULL OR a.user_id = $3)
+			AND ($4 = '' OR a.entity_type = $4)
+			AND ($5 = '' OR a.entity_id = $5)
+			AND ($6 = '' OR a.action = $6)
+		ORDER BY a.created_at DESC, a.id DESC
+		LIMIT $7 OFFSET $8`,
+		from, to, userID, c.Query("entity"), c.Query("entity_id"), c.Query("action"), limit, offset)
+	if err != nil {
+		log.Printf("GetAuditLog DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
@@ -2,15 +2,64 @@ package handlers
 
 import (
 	"database/sql"
+	"log"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
 	"golang.org/x/crypto/bcrypt"
 	"hotel-story-panel/backend/internal/database"
 	"hotel-story-panel/backend/internal/middleware"
 	"hotel-story-panel/backend/internal/models"
+	"hotel-story-panel/backend/internal/ratelimit"
 )
 
+// After lockoutThreshold failed password or 2FA attempts in a row an account
+// is locked for lockoutBase, doubling with every further failure up to
+// lockoutMax.
+const (
+	lockoutThreshold = 5
+	lockoutBase      = time.Minute
+	lockoutMax       = time.Hour
+)
+
+// loginLimit caps attempts per account on top of the per-IP route limit, so
+// spreading a guessing attack over many addresses doesn't help.
+var loginLimit = ratelimit.PerMinute(10)
+
+// lockedOut answers 429 if user is locked out after failed logins.
+func lockedOut(c *gin.Context, user *models.User) bool {
+	if user.LockedUntil == nil || !user.LockedUntil.After(time.Now()) {
+		return false
+	}
+	middleware.TooManyRequests(c, time.Until(*user.LockedUntil), "account_locked")
+	return true
+}
+
+// recordLoginFailure counts a failed attempt and locks the account once
+// there have been too many. The count starts over after a day without
+// failures.
+func recordLoginFailure(db sqlx.Execer, userID int) {
+	_, err := db.Exec(`
+		UPDATE users u SET
+			failed_logins = f.n,
+			last_failed_login_at = NOW(),
+			locked_until = CASE WHEN f.n >= $2
+				THEN NOW() + LEAST($3 * POWER(2, f.n - $2), $4) * INTERVAL '1 second'
+				ELSE NULL END
+		FROM (
+			SELECT CASE WHEN last_failed_login_at > NOW() - INTERVAL '1 day' THEN failed_logins + 1 ELSE 1 END AS n
+			FROM users WHERE id = $1 FOR UPDATE
+		) f
+		WHERE u.id = $1`, userID, lockoutThreshold, lockoutBase.Seconds(), lockoutMax.Seconds())
+	if err != nil {
+		log.Printf("recordLoginFailure DB Error: %v", err)
+	}
+}
+
 func Signup(c *gin.Context) {
 	var input struct {
 		Email    string `json:"email" binding:"required,email"`
@@ -28,24 +77,46 @@ func Signup(c *gin.Context) {
 		return
 	}
 
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	// The very first account bootstraps the panel as its owner; after that
+	// open signup only yields viewers, and is off unless ALLOW_SIGNUP=true.
+	// The lock keeps two concurrent first signups from both becoming owner.
+	if _, err := tx.Exec("LOCK TABLE users IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
 	user := models.User{
 		Email:        input.Email,
 		PasswordHash: string(hashedPassword),
 	}
-
-	query := `INSERT INTO users (email, password_hash) VALUES (:email, :password_hash) RETURNING id`
-	rows, err := database.DB.NamedQuery(query, user)
+	err = tx.QueryRowx(`
+		INSERT INTO users (email, password_hash, role)
+		SELECT $1, $2, CASE WHEN EXISTS (SELECT 1 FROM users) THEN $3 ELSE $4 END
+		WHERE $5 OR NOT EXISTS (SELECT 1 FROM users)
+		RETURNING id, role`,
+		user.Email, user.PasswordHash, models.RoleViewer, models.RoleOwner, os.Getenv("ALLOW_SIGNUP") == "true",
+	).Scan(&user.ID, &user.Role)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Signup is disabled; ask an owner for an invitation"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user (email might be taken)"})
 		return
 	}
-	defer rows.Close()
-
-	if rows.Next() {
-		rows.Scan(&user.ID)
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "User created", "user_id": user.ID})
+	c.JSON(http.StatusCreated, gin.H{"message": "User created", "user_id": user.ID, "role": user.Role})
 }
 
 func Login(c *gin.Context) {
@@ -59,6 +130,10 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	if !middleware.Throttle(c, "login:account:"+strings.ToLower(strings.TrimSpace(input.Email)), loginLimit) {
+		return
+	}
+
 	var user models.User
 	err := database.DB.Get(&user, "SELECT * FROM users WHERE email = $1", input.Email)
 	if err == sql.ErrNoRows {
@@ -69,11 +144,15 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	if lockedOut(c, &user) {
+		return
+	}
+
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(input.Password)); err != nil {
+		recordLoginFailure(database.DB, user.ID)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
-	token, _ := middleware.GenerateToken(user.ID)
-	c.JSON(http.StatusOK, gin.H{"token": token})
+	completeLogin(c, &user)
 }
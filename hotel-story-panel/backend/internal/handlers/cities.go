@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"hotel-story-panel/backend/internal/database"
+	"hotel-story-panel/backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// Arabic keyboard variants of Persian letters would otherwise make
+// identical-looking names differ.
+var persianLetters = strings.NewReplacer("ي", "ی", "ى", "ی", "ك", "ک")
+
+// normalizeSlug folds a slug, alias or Persian name to the form cities and
+// hotels are matched on: trimmed, lower case, Persian letter variants unified and runs
+// of spaces, zero-width non-joiners, underscores and dashes collapsed to a
+// single dash.
+func normalizeSlug(s string) string {
+	s = strings.ToLower(persianLetters.Replace(s))
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '\u200c' || r == '_' || r == '-'
+	})
+	return strings.Join(fields, "-")
+}
+
+// resolveCity finds the city a slug, alias or Persian name refers to. It
+// returns sql.ErrNoRows when nothing matches.
+func resolveCity(input string) (*models.City, error) {
+	key := normalizeSlug(input)
+	if key == "" {
+		return nil, sql.ErrNoRows
+	}
+	var city models.City
+	err := database.DB.Get(&city, `
+		SELECT id, slug, name_fa, aliases, active, created_at FROM cities
+		WHERE slug = $1 OR $1 = ANY(aliases) OR name_fa = $2
+		ORDER BY slug = $1 DESC
+		LIMIT 1`, key, persianLetters.Replace(strings.TrimSpace(input)))
+	if err != nil {
+		return nil, err
+	}
+	return &city, nil
+}
+
+// cityInput is the body of CreateCity and UpdateCity.
+type cityInput struct {
+	Slug    string   `json:"slug"`
+	NameFa  string   `json:"name_fa"`
+	Aliases []string `json:"aliases"`
+	Active  *bool    `json:"active"`
+}
+
+// normalize canonicalizes the slug and aliases in place and drops aliases
+// that are empty, repeated or the slug itself.
+func (in *cityInput) normalize() error {
+	in.Slug = normalizeSlug(in.Slug)
+	in.NameFa = strings.TrimSpace(persianLetters.Replace(in.NameFa))
+	if !slugPattern.MatchString(in.Slug) {
+		return errors.New("slug must contain only English letters, digits and dashes")
+	}
+	if in.NameFa == "" {
+		return errors.New("name_fa is required")
+	}
+
+	seen := map[string]bool{in.Slug: true}
+	aliases := []string{}
+	for _, a := range in.Aliases {
+		a = normalizeSlug(a)
+		if a == "" || seen[a] {
+			continue
+		}
+		seen[a] = true
+		aliases = append(aliases, a)
+	}
+	in.Aliases = aliases
+	return nil
+}
+
+// cityConflict reports the slug or alias of in that another city already
+// answers to, so a lookup can never be ambiguous.
+func cityConflict(in *cityInput, excludeID int) (string, error) {
+	keys := append(pq.StringArray{in.Slug}, in.Aliases...)
+	var taken []string
+	err := database.DB.Select(&taken, `
+		SELECT k FROM cities, unnest($1::text[]) AS k
+		WHERE id <> $2 AND (slug = k OR k = ANY(aliases))
+		LIMIT 1`, keys, excludeID)
+	if err != nil || len(taken) == 0 {
+		return "", err
+	}
+	return taken[0], nil
+}
+
+func GetCities(c *gin.Context) {
+	cities := []models.City{}
+	query := `
+		SELECT c.id, c.slug, c.name_fa, c.aliases, c.active, c.created_at, COUNT(g.id) AS group_count
+		FROM cities c
+		LEFT JOIN story_groups g ON g.city_slug = c.slug
+		GROUP BY c.id
+		ORDER BY c.slug`
+
+	if err := database.DB.Select(&cities, query); err != nil {
+		log.Printf("GetCities DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cities"})
+		return
+	}
+	c.JSON(http.StatusOK, cities)
+}
+
+func CreateCity(c *gin.Context) {
+	var input cityInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := input.normalize(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !respondCityConflict(c, &input, 0) {
+		return
+	}
+
+	active := true
+	if input.Active != nil {
+		active = *input.Active
+	}
+
+	var id int
+	err := database.DB.Get(&id, `INSERT INTO cities (slug, name_fa, aliases, active) VALUES ($1, $2, $3, $4) RETURNING id`,
+		input.Slug, input.NameFa, pq.StringArray(input.Aliases), active)
+	if err != nil {
+		log.Printf("CreateCity DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create city"})
+		return
+	}
+
+	recordAudit(c, "create", auditCity, id, nil, citySnapshot(id))
+	c.JSON(http.StatusCreated, gin.H{"id": id, "slug": input.Slug})
+}
+
+// UpdateCity edits a city. Renaming the slug carries over to its story
+// groups through the foreign key.
+func UpdateCity(c *gin.Context) {
+	var city models.City
+	if err := database.DB.Get(&city, "SELECT id, active FROM cities WHERE id = $1", c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "City not found"})
+		return
+	}
+
+	var input cityInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := input.normalize(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !respondCityConflict(c, &input, city.ID) {
+		return
+	}
+
+	active := city.Active
+	if input.Active != nil {
+		active = *input.Active
+	}
+
+	before := citySnapshot(city.ID)
+	_, err := database.DB.Exec(`UPDATE cities SET slug = $1, name_fa = $2, aliases = $3, active = $4 WHERE id = $5`,
+		input.Slug, input.NameFa, pq.StringArray(input.Aliases), active, city.ID)
+	if err != nil {
+		log.Printf("UpdateCity DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update city"})
+		return
+	}
+
+	recordAudit(c, "update", auditCity, city.ID, before, citySnapshot(city.ID))
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// DeleteCity removes a city that no story group or permission grant uses;
+// cities in use should be deactivated instead.
+func DeleteCity(c *gin.Context) {
+	before := citySnapshot(c.Param("id"))
+	res, err := database.DB.Exec("DELETE FROM cities WHERE id = $1", c.Param("id"))
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" { // foreign_key_violation
+			c.JSON(http.StatusConflict, gin.H{"error": "City is still used by story groups or user permissions; deactivate it instead"})
+			return
+		}
+		log.Printf("DeleteCity DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete city"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "City not found"})
+		return
+	}
+
+	recordAudit(c, "delete", auditCity, c.Param("id"), before, nil)
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// respondCityConflict writes a 409 and returns false when the slug or an
+// alias already belongs to another city.
+func respondCityConflict(c *gin.Context, input *cityInput, excludeID int) bool {
+	taken, err := cityConflict(input, excludeID)
+	if err != nil {
+		log.Printf("City conflict check failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if taken != "" {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("%q is already used by another city", taken)})
+		return false
+	}
+	return true
+}
+
+// GetPublicCities lists active cities that currently have at least one live
+// story group with slides.
+func GetPublicCities(c *gin.Context) {
+	cities := []models.PublicCity{}
+	query := `
+		SELECT c.slug, c.name_fa, COUNT(g.id) AS group_count
+		FROM cities c
+		JOIN story_groups g ON g.city_slug = c.slug
+		WHERE c.active = TRUE AND g.active = TRUE
+			AND (g.starts_at IS NULL OR g.starts_at <= NOW())
+			AND (g.ends_at IS NULL OR g.ends_at > NOW())
+			AND EXISTS (SELECT 1 FROM story_group_versions v, jsonb_array_elements(v.content->'slides') s
+				WHERE v.group_id = g.id AND v.version = g.published_version AND s->'hotel_slugs' = '[]'::jsonb)
+		GROUP BY c.id
+		ORDER BY group_count DESC, c.slug`
+
+	if err := database.DB.Select(&cities, query); err != nil {
+		log.Printf("GetPublicCities DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, cities)
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"hotel-story-panel/backend/internal/events"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxEventBatch caps how many events one POST /events call may carry.
+const maxEventBatch = 100
+
+// IngestEvents accepts a batch of viewer events and hands them to the
+// buffered writer. Invalid events are rejected individually; if the buffer
+// is full the client is told to back off and retry.
+func IngestEvents(c *gin.Context) {
+	var input struct {
+		Events []events.Event `json:"events" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(input.Events) > maxEventBatch {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Too many events in one batch (max " + strconv.Itoa(maxEventBatch) + ")"})
+		return
+	}
+
+	now := time.Now()
+	accepted, dropped := 0, 0
+	rejected := []gin.H{}
+	for i := range input.Events {
+		e := input.Events[i]
+		if err := e.Validate(now); err != nil {
+			rejected = append(rejected, gin.H{"index": i, "error": err.Error()})
+			continue
+		}
+		if events.Record(e) {
+			accepted++
+		} else {
+			dropped++
+		}
+	}
+
+	if dropped > 0 && accepted == 0 {
+		c.Header("Retry-After", "5")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Event buffer is full", "dropped": dropped})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"accepted": accepted, "dropped": dropped, "rejected": rejected})
+}
+
+func GetEventMetrics(c *gin.Context) {
+	c.JSON(http.StatusOK, events.Default.Metrics())
+}
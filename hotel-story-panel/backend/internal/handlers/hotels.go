@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"hotel-story-panel/backend/internal/database"
+	"hotel-story-panel/backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Hotels have no table of their own; they are identified by the slug the
+// site uses in /hotel-booking/:city_slug/:hotel_slug, normalized like city
+// slugs so spacing and letter variants don't matter.
+
+// normalizeSlugs normalizes, de-duplicates and drops empty hotel slugs. It
+// never returns nil, so the result can be stored in a NOT NULL array column.
+func normalizeSlugs(slugs []string) pq.StringArray {
+	seen := map[string]bool{}
+	out := pq.StringArray{}
+	for _, s := range slugs {
+		s = normalizeSlug(s)
+		if s == "" || seen[s] {
+			continue
+		}
+		seen[s] = true
+		out = append(out, s)
+	}
+	return out
+}
+
+// formSlugs reads a comma-separated list of hotel slugs from a form field,
+// reporting whether the field was sent at all.
+func formSlugs(c *gin.Context, key string) (pq.StringArray, bool) {
+	v, ok := c.GetPostForm(key)
+	if !ok {
+		return nil, false
+	}
+	return normalizeSlugs(strings.Split(v, ",")), true
+}
+
+// setGroupHotels replaces the hotels a group is attached to.
+func setGroupHotels(groupID int, hotels pq.StringArray) error {
+	hotels = normalizeSlugs(hotels)
+	if _, err := database.DB.Exec("DELETE FROM story_group_hotels WHERE group_id = $1 AND hotel_slug <> ALL($2)", groupID, hotels); err != nil {
+		return err
+	}
+	_, err := database.DB.Exec(`
+		INSERT INTO story_group_hotels (group_id, hotel_slug)
+		SELECT $1, unnest($2::text[])
+		ON CONFLICT DO NOTHING`, groupID, hotels)
+	return err
+}
+
+// GetHotelStories returns the live groups for a hotel page. A group appears
+// if it is attached to the hotel or has slides tagged for it. Its slides are
+// those tagged for the hotel plus, when the group itself is attached, the
+// untagged ones.
+func GetHotelStories(c *gin.Context) {
+	hotel := normalizeSlug(c.Param("hotel_slug"))
+	if hotel == "" {
+		c.JSON(http.StatusOK, []models.StoryGroup{})
+		return
+	}
+
+	var groups []publishedGroup
+	query := `
+		SELECT
+			g.id, g.city_slug, g.short_code, g.active, g.view_count, g.open_count, g.created_at,
+			g.starts_at, g.ends_at, g.published_version, v.content,
+			COALESCE((SELECT array_agg(h.hotel_slug ORDER BY h.hotel_slug) FROM story_group_hotels h WHERE h.group_id = g.id), '{}') AS hotels
+		FROM story_groups g
+		JOIN cities c ON c.slug = g.city_slug
+		JOIN story_group_versions v ON v.group_id = g.id AND v.version = g.published_version
+		WHERE g.active = TRUE AND c.active = TRUE
+			AND (g.starts_at IS NULL OR g.starts_at <= NOW())
+			AND (g.ends_at IS NULL OR g.ends_at > NOW())
+			AND (EXISTS (SELECT 1 FROM story_group_hotels h WHERE h.group_id = g.id AND h.hotel_slug = $1)
+				OR EXISTS (SELECT 1 FROM jsonb_array_elements(v.content->'slides') s
+					WHERE s->'hotel_slugs' @> jsonb_build_array($1::text)))
+		ORDER BY g.created_at DESC`
+
+	if err := database.DB.Select(&groups, query, hotel); err != nil {
+		log.Println("GetHotelStories:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	validGroups := []models.StoryGroup{}
+	now := time.Now()
+	for i := range groups {
+		attached := slices.Contains(groups[i].Hotels, hotel)
+		group, err := groups[i].published(now, func(s *models.StorySlide) bool {
+			return slices.Contains(s.HotelSlugs, hotel) || (len(s.HotelSlugs) == 0 && attached)
+		})
+		if err != nil {
+			log.Printf("Group %d: reading published content: %v", groups[i].ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read stories"})
+			return
+		}
+		prepareGroup(&group, now)
+
+		if len(group.Slides) > 0 {
+			validGroups = append(validGroups, group)
+		}
+	}
+
+	c.JSON(http.StatusOK, validGroups)
+}
@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"hotel-story-panel/backend/internal/database"
+	"hotel-story-panel/backend/internal/elements"
+	"hotel-story-panel/backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// liveElementSQL finds a slide's elements in the published content of a
+// group customers can currently see. The slide is looked up in that content
+// rather than the draft, so it keeps taking responses until a version
+// without it is published.
+const liveElementSQL = `
+	SELECT g.id AS group_id, s->'elements' AS elements
+	FROM story_groups g
+	JOIN cities c ON c.slug = g.city_slug AND c.active = TRUE
+	JOIN story_group_versions v ON v.group_id = g.id AND v.version = g.published_version
+	CROSS JOIN LATERAL jsonb_array_elements(v.content->'slides') s
+	WHERE g.active = TRUE
+		AND (g.starts_at IS NULL OR g.starts_at <= NOW())
+		AND (g.ends_at IS NULL OR g.ends_at > NOW())
+		AND v.content->'slides' @> jsonb_build_array(jsonb_build_object('id', $1::int))
+		AND (s->>'id')::int = $1`
+
+// liveElement looks up an element on a slide as customers see it,
+// answering 404 itself when the slide or element isn't live.
+func liveElement(c *gin.Context) (int, int, elements.Element, bool) {
+	slideID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid slide id"})
+		return 0, 0, nil, false
+	}
+
+	var row struct {
+		GroupID  int             `db:"group_id"`
+		Elements json.RawMessage `db:"elements"`
+	}
+	err = database.DB.Get(&row, liveElementSQL, slideID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Slide not found"})
+		return 0, 0, nil, false
+	}
+	if err != nil {
+		log.Printf("Live element lookup error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return 0, 0, nil, false
+	}
+
+	el := elements.Find(row.Elements, c.Param("element"))
+	if el == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Element not found"})
+		return 0, 0, nil, false
+	}
+	return row.GroupID, slideID, el, true
+}
+
+// VotePoll records a viewer's vote on a poll element and returns the
+// results. Each viewer votes once; voting again returns their original
+// choice with already_voted set.
+func VotePoll(c *gin.Context) {
+	var input struct {
+		Option   *int   `json:"option" binding:"required"`
+		ViewerID string `json:"viewer_id" binding:"required,max=64"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	groupID, slideID, el, ok := liveElement(c)
+	if !ok {
+		return
+	}
+	poll, ok := el.(*elements.Poll)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Poll not found"})
+		return
+	}
+	if *input.Option < 0 || *input.Option >= len(poll.Options) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("option must be between 0 and %d", len(poll.Options)-1)})
+		return
+	}
+
+	res, err := database.DB.Exec(`
+		INSERT INTO poll_votes (group_id, slide_id, element_id, viewer_id, option_index)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (slide_id, element_id, viewer_id) DO NOTHING`,
+		groupID, slideID, poll.ID, input.ViewerID, *input.Option)
+	if err != nil {
+		log.Printf("VotePoll DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record vote"})
+		return
+	}
+
+	option := *input.Option
+	n, _ := res.RowsAffected()
+	alreadyVoted := n == 0
+	if alreadyVoted {
+		err = database.DB.Get(&option, "SELECT option_index FROM poll_votes WHERE slide_id = $1 AND element_id = $2 AND viewer_id = $3",
+			slideID, poll.ID, input.ViewerID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read vote"})
+			return
+		}
+	}
+
+	var counts []voteCount
+	err = database.DB.Select(&counts, `
+		SELECT slide_id, element_id, option_index, COUNT(*) AS votes
+		FROM poll_votes WHERE slide_id = $1 AND element_id = $2
+		GROUP BY slide_id, element_id, option_index`, slideID, poll.ID)
+	if err != nil {
+		log.Printf("VotePoll DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch results"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"option":        option,
+		"already_voted": alreadyVoted,
+		"results":       tallyPoll(slideID, poll, counts),
+	})
+}
+
+// SubmitSlider records a viewer's emoji slider value and returns the
+// average so far. Each viewer responds once; responding again returns
+// their original value with already_responded set.
+func SubmitSlider(c *gin.Context) {
+	var input struct {
+		Value    *int   `json:"value" binding:"required"`
+		ViewerID string `json:"viewer_id" binding:"required,max=64"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if *input.Value < elements.MinSliderValue || *input.Value > elements.MaxSliderValue {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("value must be between %d and %d", elements.MinSliderValue, elements.MaxSliderValue)})
+		return
+	}
+
+	groupID, slideID, el, ok := liveElement(c)
+	if !ok {
+		return
+	}
+	slider, ok := el.(*elements.Slider)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Slider not found"})
+		return
+	}
+
+	res, err := database.DB.Exec(`
+		INSERT INTO slider_responses (group_id, slide_id, element_id, viewer_id, value)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (slide_id, element_id, viewer_id) DO NOTHING`,
+		groupID, slideID, slider.ID, input.ViewerID, *input.Value)
+	if err != nil {
+		log.Printf("SubmitSlider DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record response"})
+		return
+	}
+
+	value := *input.Value
+	n, _ := res.RowsAffected()
+	alreadyResponded := n == 0
+	if alreadyResponded {
+		err = database.DB.Get(&value, "SELECT value FROM slider_responses WHERE slide_id = $1 AND element_id = $2 AND viewer_id = $3",
+			slideID, slider.ID, input.ViewerID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read response"})
+			return
+		}
+	}
+
+	var summary struct {
+		Count   int     `db:"count"`
+		Average float64 `db:"average"`
+	}
+	err = database.DB.Get(&summary, `
+		SELECT COUNT(*) AS count, COALESCE(AVG(value), 0) AS average
+		FROM slider_responses WHERE slide_id = $1 AND element_id = $2`, slideID, slider.ID)
+	if err != nil {
+		log.Printf("SubmitSlider DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch results"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"value":             value,
+		"already_responded": alreadyResponded,
+		"count":             summary.Count,
+		"average":           math.Round(summary.Average*10) / 10,
+	})
+}
+
+// AnswerQuiz records a viewer's answer to a quiz element and tells them
+// whether it was correct and which option was. Each viewer answers once;
+// answering again returns their original answer with already_answered set.
+func AnswerQuiz(c *gin.Context) {
+	var input struct {
+		Option   *int   `json:"option" binding:"required"`
+		ViewerID string `json:"viewer_id" binding:"required,max=64"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	groupID, slideID, el, ok := liveElement(c)
+	if !ok {
+		return
+	}
+	quiz, ok := el.(*elements.Quiz)
+	if !ok || quiz.Correct == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Quiz not found"})
+		return
+	}
+	if *input.Option < 0 || *input.Option >= len(quiz.Options) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("option must be between 0 and %d", len(quiz.Options)-1)})
+		return
+	}
+
+	answer := struct {
+		Option  int  `db:"option_index"`
+		Correct bool `db:"correct"`
+	}{*input.Option, *input.Option == *quiz.Correct}
+	res, err := database.DB.Exec(`
+		INSERT INTO quiz_answers (group_id, slide_id, element_id, viewer_id, option_index, correct)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (slide_id, element_id, viewer_id) DO NOTHING`,
+		groupID, slideID, quiz.ID, input.ViewerID, answer.Option, answer.Correct)
+	if err != nil {
+		log.Printf("AnswerQuiz DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record answer"})
+		return
+	}
+
+	n, _ := res.RowsAffected()
+	alreadyAnswered := n == 0
+	if alreadyAnswered {
+		err = database.DB.Get(&answer, "SELECT option_index, correct FROM quiz_answers WHERE slide_id = $1 AND element_id = $2 AND viewer_id = $3",
+			slideID, quiz.ID, input.ViewerID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read answer"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"option":           answer.Option,
+		"correct":          answer.Correct,
+		"correct_option":   *quiz.Correct,
+		"already_answered": alreadyAnswered,
+	})
+}
+
+// voteCount is the number of votes for one option of one poll.
+type voteCount struct {
+	SlideID   int    `db:"slide_id"`
+	ElementID string `db:"element_id"`
+	Option    int    `db:"option_index"`
+	Votes     int    `db:"votes"`
+}
+
+// tallyPoll lays vote counts over a poll's options. Counts for other
+// polls, or for options the poll no longer has, are ignored.
+func tallyPoll(slideID int, poll *elements.Poll, counts []voteCount) models.PollResults {
+	r := models.PollResults{
+		SlideID:   slideID,
+		ElementID: poll.ID,
+		Question:  poll.Question,
+		Options:   make([]models.PollOption, len(poll.Options)),
+	}
+	for i, text := range poll.Options {
+		r.Options[i].Text = text
+	}
+	for _, vc := range counts {
+		if vc.SlideID == slideID && vc.ElementID == poll.ID && vc.Option >= 0 && vc.Option < len(r.Options) {
+			r.Options[vc.Option].Votes += vc.Votes
+			r.Total += vc.Votes
+		}
+	}
+	for i := range r.Options {
+		r.Options[i].Percent = percent(r.Options[i].Votes, r.Total)
+	}
+	return r
+}
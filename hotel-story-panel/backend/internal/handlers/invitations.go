@@ -0,0 +1,358 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"hotel-story-panel/backend/internal/database"
+	"hotel-story-panel/backend/internal/mailer"
+	"hotel-story-panel/backend/internal/middleware"
+	"hotel-story-panel/backend/internal/models"
+	"hotel-story-panel/backend/internal/ratelimit"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	purposeInvite        = "invite"
+	purposePasswordReset = "password_reset"
+
+	invitationTTL    = 7 * 24 * time.Hour
+	passwordResetTTL = time.Hour
+
+	// resetMailTimeout bounds a reset email sent after the response
+	resetMailTimeout = 30 * time.Second
+)
+
+// resetLimit caps reset emails per address: three at once, then one a
+// minute.
+var resetLimit = ratelimit.Limit{Rate: 1.0 / 60, Burst: 3}
+
+var roleNamesFa = map[string]string{
+	models.RoleOwner:    "مالک",
+	models.RoleEditor:   "ویرایشگر",
+	models.RoleReviewer: "بازبین",
+	models.RoleAnalyst:  "تحلیلگر",
+	models.RoleViewer:   "بیننده",
+}
+
+var persianDigits = strings.NewReplacer("0", "۰", "1", "۱", "2", "۲", "3", "۳", "4", "۴", "5", "۵", "6", "۶", "7", "۷", "8", "۸", "9", "۹")
+
+// validForFa spells out a token lifetime for the emails, e.g. "۷ روز".
+func validForFa(d time.Duration) string {
+	if d >= 24*time.Hour {
+		return persianDigits.Replace(fmt.Sprint(int(d/(24*time.Hour)))) + " روز"
+	}
+	if d >= time.Hour {
+		return persianDigits.Replace(fmt.Sprint(int(d/time.Hour))) + " ساعت"
+	}
+	return persianDigits.Replace(fmt.Sprint(int(d/time.Minute))) + " دقیقه"
+}
+
+// panelURL builds a link to path in the admin frontend at APP_URL.
+func panelURL(path string) string {
+	base := os.Getenv("APP_URL")
+	if base == "" {
+		base = "http://localhost:3000"
+	}
+	return strings.TrimRight(base, "/") + path
+}
+
+// panelLink is panelURL with a token in the query string.
+func panelLink(path, param, token string) string {
+	return panelURL(path) + "?" + param + "=" + url.QueryEscape(token)
+}
+
+type userToken struct {
+	Email  string  `db:"email"`
+	Role   *string `db:"role"`
+	UserID *int    `db:"user_id"`
+}
+
+// consumeToken marks an unexpired, unused token of the given purpose as used
+// within tx and returns it, or sql.ErrNoRows.
+func consumeToken(tx *sqlx.Tx, purpose, token string) (*userToken, error) {
+	var t userToken
+	err := tx.Get(&t, `
+		UPDATE user_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING email, role, user_id`, hashToken(token), purpose)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func CreateInvitation(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required,email"`
+		Role  string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !models.ValidRole(input.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be owner, editor, reviewer, analyst or viewer"})
+		return
+	}
+	input.Email = strings.ToLower(strings.TrimSpace(input.Email))
+
+	var exists bool
+	if err := database.DB.Get(&exists, "SELECT EXISTS (SELECT 1 FROM users WHERE lower(email) = $1)", input.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": "A user with this email already exists"})
+		return
+	}
+
+	token, hash, err := newToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invitation"})
+		return
+	}
+
+	// A new invitation replaces any pending one for the same address
+	if _, err := database.DB.Exec("DELETE FROM user_tokens WHERE purpose = $1 AND email = $2 AND used_at IS NULL", purposeInvite, input.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var inv models.Invitation
+	err = database.DB.Get(&inv, `
+		INSERT INTO user_tokens (purpose, token_hash, email, role, created_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, email, role, created_by, created_at, expires_at`,
+		purposeInvite, hash, input.Email, input.Role, callerID(c), time.Now().Add(invitationTTL))
+	if err != nil {
+		log.Printf("CreateInvitation DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invitation"})
+		return
+	}
+
+	msg, err := mailer.Render("invitation", inv.Email, gin.H{
+		"Link":     panelLink("/set-password", "invite", token),
+		"RoleFa":   roleNamesFa[inv.Role],
+		"ValidFor": validForFa(invitationTTL),
+	})
+	if err == nil {
+		err = mailer.Send(c.Request.Context(), msg)
+	}
+	if err != nil {
+		log.Printf("Invitation email failed: %v", err)
+		database.DB.Exec("DELETE FROM user_tokens WHERE id = $1", inv.ID)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to send invitation email"})
+		return
+	}
+
+	recordAudit(c, "create", auditInvitation, inv.ID, nil, gin.H{"email": inv.Email, "role": inv.Role, "expires_at": inv.ExpiresAt})
+	c.JSON(http.StatusCreated, inv)
+}
+
+// GetInvitations lists invitations that can still be accepted.
+func GetInvitations(c *gin.Context) {
+	invitations := []models.Invitation{}
+	err := database.DB.Select(&invitations, `
+		SELECT id, email, role, created_by, created_at, expires_at FROM user_tokens
+		WHERE purpose = $1 AND used_at IS NULL AND expires_at > NOW()
+		ORDER BY created_at DESC`, purposeInvite)
+	if err != nil {
+		log.Printf("GetInvitations DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invitations"})
+		return
+	}
+	c.JSON(http.StatusOK, invitations)
+}
+
+func RevokeInvitation(c *gin.Context) {
+	var inv models.Invitation
+	err := database.DB.Get(&inv, `
+		DELETE FROM user_tokens WHERE id = $1 AND purpose = $2 AND used_at IS NULL
+		RETURNING id, email, role, created_by, created_at, expires_at`, c.Param("id"), purposeInvite)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke invitation"})
+		return
+	}
+	recordAudit(c, "delete", auditInvitation, inv.ID, gin.H{"email": inv.Email, "role": inv.Role, "expires_at": inv.ExpiresAt}, nil)
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// AcceptInvitation creates the invited user with the chosen password and
+// signs them in, via 2FA enrolment if owners require it.
+func AcceptInvitation(c *gin.Context) {
+	var input struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required,min=6"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	invite, err := consumeToken(tx, purposeInvite, input.Token)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invitation is invalid or has expired"})
+		return
+	} else if err != nil || invite.Role == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	user := models.User{Email: invite.Email, PasswordHash: string(hashedPassword), Role: *invite.Role}
+	err = tx.Get(&user.ID, "INSERT INTO users (email, password_hash, role) VALUES ($1, $2, $3) RETURNING id",
+		user.Email, user.PasswordHash, user.Role)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Failed to create user (email might be taken)"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	completeLogin(c, &user)
+}
+
+// ForgotPassword emails a reset link if the address belongs to a user. It
+// answers the same either way so it can't be used to discover accounts.
+func ForgotPassword(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	response := gin.H{"message": "If the address is registered, a reset link has been sent"}
+
+	// Applied whether or not the account exists, so it reveals nothing
+	if !middleware.Throttle(c, "reset:account:"+strings.ToLower(strings.TrimSpace(input.Email)), resetLimit) {
+		return
+	}
+
+	var user models.User
+	err := database.DB.Get(&user, "SELECT id, email, role, created_at FROM users WHERE lower(email) = lower($1)", strings.TrimSpace(input.Email))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("ForgotPassword DB Error: %v", err)
+		}
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	token, hash, err := newToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reset link"})
+		return
+	}
+	_, err = database.DB.Exec("DELETE FROM user_tokens WHERE purpose = $1 AND user_id = $2 AND used_at IS NULL", purposePasswordReset, user.ID)
+	if err == nil {
+		_, err = database.DB.Exec(`
+			INSERT INTO user_tokens (purpose, token_hash, email, user_id, expires_at)
+			VALUES ($1, $2, $3, $4, $5)`, purposePasswordReset, hash, user.Email, user.ID, time.Now().Add(passwordResetTTL))
+	}
+	if err != nil {
+		log.Printf("ForgotPassword DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reset link"})
+		return
+	}
+
+	msg, err := mailer.Render("password_reset", user.Email, gin.H{
+		"Link":     panelLink("/set-password", "reset", token),
+		"ValidFor": validForFa(passwordResetTTL),
+	})
+	if err != nil {
+		log.Printf("Password reset email failed: %v", err)
+	} else {
+		// Sent in the background: waiting on the mail server only for
+		// registered addresses would give them away by the response time
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), resetMailTimeout)
+			defer cancel()
+			if err := mailer.Send(ctx, msg); err != nil {
+				log.Printf("Password reset email failed: %v", err)
+			}
+		}()
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ResetPassword sets a new password from a reset link, signs the user out
+// of every existing session and lifts any lockout from failed logins.
+func ResetPassword(c *gin.Context) {
+	var input struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required,min=6"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	reset, err := consumeToken(tx, purposePasswordReset, input.Token)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reset link is invalid or has expired"})
+		return
+	} else if err != nil || reset.UserID == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	userID := *reset.UserID
+
+	// Whoever was guessing the old password is locked out no longer
+	if _, err := tx.Exec("UPDATE users SET password_hash = $1, failed_logins = 0, locked_until = NULL WHERE id = $2", string(hashedPassword), userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+	if _, err := tx.Exec("UPDATE user_sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL", userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"os"
+
+	"hotel-story-panel/backend/internal/media"
+	"hotel-story-panel/backend/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// slideRenditions are stored for every slide image: image_url, thumbnail_url
+// and preview_url respectively.
+var slideRenditions = []media.Rendition{media.StoryRendition, media.ThumbnailRendition, media.PreviewRendition}
+
+// saveImageRenditions validates an uploaded image against policy, decodes it
+// (auto-oriented, EXIF stripped), stores each rendition under a
+// content-addressed key and returns their public URLs keyed by rendition name.
+// The client-supplied filename is never used.
+func saveImageRenditions(c *gin.Context, file *multipart.FileHeader, policy media.ImagePolicy, renditions ...media.Rendition) (map[string]string, error) {
+	if file.Size > policy.MaxBytes {
+		return nil, &media.ValidationError{
+			Code:    media.CodeFileTooLarge,
+			Message: fmt.Sprintf("File size exceeds %dMB limit", policy.MaxBytes/(1024*1024)),
+		}
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(io.LimitReader(src, policy.MaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := media.ValidateImage(data, policy); err != nil {
+		return nil, err
+	}
+
+	return storeRenditions(c, data, renditions...)
+}
+
+// storeRenditions decodes already-validated image bytes and stores each
+// rendition, keyed by the digest of the source bytes. Every rendition is a
+// JPEG under its name; when cwebp is installed a WebP copy is stored too,
+// under the name plus ".webp".
+func storeRenditions(c *gin.Context, data []byte, renditions ...media.Rendition) (map[string]string, error) {
+	img, err := media.DecodeImage(data)
+	if err != nil {
+		return nil, &media.ValidationError{Code: media.CodeInvalidImage, Message: "File is not a valid image"}
+	}
+
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:16])
+
+	ctx := c.Request.Context()
+	urls := make(map[string]string, 2*len(renditions))
+	webp := true
+	for _, r := range renditions {
+		scaled := media.Scale(img, r)
+		encoded, err := media.EncodeJPEG(scaled)
+		if err != nil {
+			return nil, err
+		}
+		key := fmt.Sprintf("%s_%s.jpg", digest, r.Name)
+		if err := storage.Media.Put(ctx, key, bytes.NewReader(encoded), int64(len(encoded)), "image/jpeg"); err != nil {
+			return nil, err
+		}
+		urls[r.Name] = storage.Media.URL(key)
+
+		if !webp {
+			continue
+		}
+		encoded, err = media.EncodeWebP(ctx, scaled)
+		if err != nil {
+			// The JPEG is enough for every browser
+			if !errors.Is(err, media.ErrNoWebP) {
+				log.Printf("WebP encoding failed: %v", err)
+			}
+			webp = false
+			continue
+		}
+		key = fmt.Sprintf("%s_%s.webp", digest, r.Name)
+		if err := storage.Media.Put(ctx, key, bytes.NewReader(encoded), int64(len(encoded)), "image/webp"); err != nil {
+			return nil, err
+		}
+		urls[r.Name+".webp"] = storage.Media.URL(key)
+	}
+	if !webp {
+		for _, r := range renditions {
+			delete(urls, r.Name+".webp")
+		}
+	}
+	return urls, nil
+}
+
+// videoUpload is a stored video slide and its poster renditions.
+type videoUpload struct {
+	VideoURL string
+	Duration int // whole seconds, rounded up
+	Poster   map[string]string
+}
+
+// saveVideo validates and stores an uploaded MP4/WebM under a content-addressed
+// key. The poster comes from the optional "poster" form file, or is extracted
+// with ffmpeg when available; otherwise the slide has no poster.
+func saveVideo(c *gin.Context, file *multipart.FileHeader) (*videoUpload, error) {
+	policy := media.SlideVideoPolicy
+	if file.Size > policy.MaxBytes {
+		return nil, &media.ValidationError{
+			Code:    media.CodeFileTooLarge,
+			Message: fmt.Sprintf("File size exceeds %dMB limit", policy.MaxBytes/(1024*1024)),
+		}
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	// Spool to a temp file so the container can be probed and hashed
+	// without holding the whole video in memory
+	tmp, err := os.CreateTemp("", "slide-video-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(src, policy.MaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := media.ProbeVideo(tmp, size, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	ext := ".mp4"
+	if info.MIMEType == "video/webm" {
+		ext = ".webm"
+	}
+	key := hex.EncodeToString(hash.Sum(nil)[:16]) + "_video" + ext
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err := storage.Media.Put(c.Request.Context(), key, tmp, size, info.MIMEType); err != nil {
+		return nil, err
+	}
+
+	upload := &videoUpload{
+		VideoURL: storage.Media.URL(key),
+		Duration: int(math.Ceil(info.Duration.Seconds())),
+	}
+
+	if poster, err := c.FormFile("poster"); err == nil {
+		upload.Poster, err = saveImageRenditions(c, poster, media.SlidePolicy, slideRenditions...)
+		if err != nil {
+			return nil, err
+		}
+	} else if frame, err := media.ExtractPoster(c.Request.Context(), tmp.Name()); err == nil {
+		upload.Poster, err = storeRenditions(c, frame, slideRenditions...)
+		if err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, media.ErrNoFFmpeg) {
+		log.Printf("Poster extraction failed: %v", err)
+	}
+
+	return upload, nil
+}
+
+// respondUploadError reports validation failures with their error code and
+// anything else as a storage failure.
+func respondUploadError(c *gin.Context, err error) {
+	var verr *media.ValidationError
+	if errors.As(err, &verr) {
+		c.JSON(verr.HTTPStatus(), gin.H{"error": verr.Message, "code": verr.Code})
+		return
+	}
+	log.Printf("Upload Save Error: %v", err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+}
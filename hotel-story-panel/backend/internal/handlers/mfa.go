@@ -0,0 +1,599 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"hotel-story-panel/backend/internal/database"
+	"hotel-story-panel/backend/internal/middleware"
+	"hotel-story-panel/backend/internal/models"
+	"hotel-story-panel/backend/internal/ratelimit"
+	"hotel-story-panel/backend/internal/totp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	mfaIssuer         = "Trip Story"
+	recoveryCodeCount = 10
+
+	settingRequireMFA = "require_mfa"
+)
+
+// mfaLimit caps second-factor attempts per account; a 6-digit code would
+// otherwise fall to guessing well within a pending token's lifetime.
+var mfaLimit = ratelimit.PerMinute(5)
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// mfaRequired reports whether owners have made 2FA mandatory for everyone.
+func mfaRequired() (bool, error) {
+	var value string
+	err := database.DB.Get(&value, "SELECT value FROM settings WHERE key = $1", settingRequireMFA)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return value == "true", err
+}
+
+// completeLogin is called once a user has proven their password. Users with
+// 2FA get a pending-MFA token to exchange at /auth/mfa/verify; if 2FA is
+// required and they have none, the token is for enrolling first. Everyone
+// else gets a session straight away.
+func completeLogin(c *gin.Context, user *models.User) {
+	enrolled := user.TOTPEnabledAt != nil
+	if !enrolled {
+		required, err := mfaRequired()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if !required {
+			startSession(c, user, nil)
+			return
+		}
+	}
+
+	token, err := middleware.GenerateMFAToken(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue token"})
+		return
+	}
+	if enrolled {
+		c.JSON(http.StatusOK, gin.H{"mfa_required": true, "mfa_token": token})
+	} else {
+		c.JSON(http.StatusOK, gin.H{"mfa_enrollment_required": true, "mfa_token": token})
+	}
+}
+
+// pendingUser loads the user named by a pending-MFA token, locked in tx.
+func pendingUser(c *gin.Context, tx *sqlx.Tx, mfaToken string) (*models.User, bool) {
+	userID, err := middleware.ParseMFAToken(mfaToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login has expired; sign in again"})
+		return nil, false
+	}
+	if !middleware.Throttle(c, fmt.Sprintf("mfa:account:%d", userID), mfaLimit) {
+		return nil, false
+	}
+	user, err := lockUser(tx, userID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return user, true
+}
+
+// signedInUser loads the caller to check a second factor, locked in tx. It is
+// held to the same per-account limit and lockout as VerifyMFA, so a stolen
+// session can't be used to guess codes.
+func signedInUser(c *gin.Context, tx *sqlx.Tx) (*models.User, bool) {
+	userID := callerID(c)
+	if !middleware.Throttle(c, fmt.Sprintf("mfa:account:%d", userID), mfaLimit) {
+		return nil, false
+	}
+	user, err := lockUser(tx, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return user, !lockedOut(c, user)
+}
+
+func lockUser(tx *sqlx.Tx, userID int) (*models.User, error) {
+	var user models.User
+	err := tx.Get(&user, `
+		SELECT id, email, role, created_at, totp_secret, totp_enabled_at, totp_last_step, locked_until
+		FROM users WHERE id = $1 FOR UPDATE`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// checkSecondFactor accepts either a current TOTP code or an unused recovery
+// code for an enrolled user, and uses it up.
+func checkSecondFactor(tx *sqlx.Tx, user *models.User, code, recoveryCode string) (bool, error) {
+	if user.TOTPEnabledAt == nil || user.TOTPSecret == nil {
+		return false, nil
+	}
+	if code != "" {
+		step, ok := totp.Validate(*user.TOTPSecret, code, time.Now(), user.TOTPLastStep)
+		if !ok {
+			return false, nil
+		}
+		_, err := tx.Exec("UPDATE users SET totp_last_step = $1 WHERE id = $2", step, user.ID)
+		return err == nil, err
+	}
+	if recoveryCode != "" {
+		res, err := tx.Exec(`
+			UPDATE user_recovery_codes SET used_at = NOW()
+			WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`,
+			user.ID, hashToken(normalizeRecoveryCode(recoveryCode)))
+		if err != nil {
+			return false, err
+		}
+		n, _ := res.RowsAffected()
+		return n == 1, nil
+	}
+	return false, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// newRecoveryCodes replaces the user's recovery codes and returns the new
+// ones, formatted xxxx-xxxx-xxxx-xxxx. Only their hashes are kept.
+func newRecoveryCodes(tx *sqlx.Tx, userID int) ([]string, error) {
+	if _, err := tx.Exec("DELETE FROM user_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(recoveryEncoding.EncodeToString(b))
+		if _, err := tx.Exec("INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)", userID, hashToken(raw)); err != nil {
+			return nil, err
+		}
+		codes = append(codes, raw[0:4]+"-"+raw[4:8]+"-"+raw[8:12]+"-"+raw[12:16])
+	}
+	return codes, nil
+}
+
+// beginEnrolment stores a fresh, not yet active secret for user and returns
+// what the authenticator app needs.
+func beginEnrolment(tx *sqlx.Tx, user *models.User) (gin.H, error) {
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("UPDATE users SET totp_secret = $1, totp_last_step = 0 WHERE id = $2", secret, user.ID); err != nil {
+		return nil, err
+	}
+	return gin.H{"secret": secret, "otpauth_uri": totp.URI(mfaIssuer, user.Email, secret)}, nil
+}
+
+// confirmEnrolment activates the pending secret once the user proves their
+// app produces matching codes, and issues recovery codes.
+func confirmEnrolment(tx *sqlx.Tx, user *models.User, code string) ([]string, bool, error) {
+	if user.TOTPSecret == nil {
+		return nil, false, nil
+	}
+	step, ok := totp.Validate(*user.TOTPSecret, code, time.Now(), 0)
+	if !ok {
+		return nil, false, nil
+	}
+	if _, err := tx.Exec("UPDATE users SET totp_enabled_at = NOW(), totp_last_step = $1 WHERE id = $2", step, user.ID); err != nil {
+		return nil, false, err
+	}
+	codes, err := newRecoveryCodes(tx, user.ID)
+	return codes, err == nil, err
+}
+
+// VerifyMFA completes a two-step login with a TOTP or recovery code.
+func VerifyMFA(c *gin.Context) {
+	var input struct {
+		MFAToken     string `json:"mfa_token" binding:"required"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	user, ok := pendingUser(c, tx, input.MFAToken)
+	if !ok || lockedOut(c, user) {
+		return
+	}
+	valid, err := checkSecondFactor(tx, user, input.Code, input.RecoveryCode)
+	if err != nil {
+		log.Printf("VerifyMFA DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !valid {
+		// The row is locked by tx, so the failure is recorded through it
+		recordLoginFailure(tx, user.ID)
+		tx.Commit()
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication code", "code": "invalid_mfa_code"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	startSession(c, user, nil)
+}
+
+// EnrollMFA starts enrolment during login, for users who must set up 2FA
+// before they get a session.
+func EnrollMFA(c *gin.Context) {
+	var input struct {
+		MFAToken string `json:"mfa_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	user, ok := pendingUser(c, tx, input.MFAToken)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabledAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	setup, err := beginEnrolment(tx, user)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("EnrollMFA DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start enrolment"})
+		return
+	}
+	c.JSON(http.StatusOK, setup)
+}
+
+// ConfirmEnrollMFA finishes enrolment during login and starts the session.
+// The recovery codes are only ever shown in this response.
+func ConfirmEnrollMFA(c *gin.Context) {
+	var input struct {
+		MFAToken string `json:"mfa_token" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	user, ok := pendingUser(c, tx, input.MFAToken)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabledAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	codes, valid, err := confirmEnrolment(tx, user, input.Code)
+	if err != nil {
+		log.Printf("ConfirmEnrollMFA DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+	if !valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication code", "code": "invalid_mfa_code"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	startSession(c, user, gin.H{"recovery_codes": codes})
+}
+
+// GetMFAStatus reports the caller's 2FA state.
+func GetMFAStatus(c *gin.Context) {
+	var status struct {
+		Enabled   bool `db:"enabled" json:"enabled"`
+		Remaining int  `db:"remaining" json:"recovery_codes_remaining"`
+	}
+	err := database.DB.Get(&status, `
+		SELECT u.totp_enabled_at IS NOT NULL AS enabled,
+			(SELECT COUNT(*) FROM user_recovery_codes r WHERE r.user_id = u.id AND r.used_at IS NULL) AS remaining
+		FROM users u WHERE u.id = $1`, callerID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	required, err := mfaRequired()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": status.Enabled, "required": required, "recovery_codes_remaining": status.Remaining})
+}
+
+// SetupMFA starts enrolment for a signed-in user. Calling it again replaces
+// the pending secret.
+func SetupMFA(c *gin.Context) {
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	user, err := lockUser(tx, callerID(c))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if user.TOTPEnabledAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	setup, err := beginEnrolment(tx, user)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("SetupMFA DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start enrolment"})
+		return
+	}
+	c.JSON(http.StatusOK, setup)
+}
+
+// EnableMFA activates the secret from SetupMFA and returns recovery codes.
+func EnableMFA(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	user, err := lockUser(tx, callerID(c))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if user.TOTPEnabledAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	codes, valid, err := confirmEnrolment(tx, user, input.Code)
+	if err != nil {
+		log.Printf("EnableMFA DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authentication code", "code": "invalid_mfa_code"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// DisableMFA turns 2FA off for the caller, given a current code. It is
+// refused while owners require 2FA.
+func DisableMFA(c *gin.Context) {
+	var input struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	required, err := mfaRequired()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if required {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required for all users"})
+		return
+	}
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	user, ok := signedInUser(c, tx)
+	if !ok {
+		return
+	}
+	valid, err := checkSecondFactor(tx, user, input.Code, input.RecoveryCode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !valid {
+		recordLoginFailure(tx, user.ID)
+		tx.Commit()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authentication code", "code": "invalid_mfa_code"})
+		return
+	}
+	if err := resetMFA(tx, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// RegenerateRecoveryCodes replaces the caller's recovery codes, given a
+// current TOTP code.
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	user, ok := signedInUser(c, tx)
+	if !ok {
+		return
+	}
+	valid, err := checkSecondFactor(tx, user, input.Code, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !valid {
+		recordLoginFailure(tx, user.ID)
+		tx.Commit()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authentication code", "code": "invalid_mfa_code"})
+		return
+	}
+	codes, err := newRecoveryCodes(tx, user.ID)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("RegenerateRecoveryCodes DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create recovery codes"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+func resetMFA(tx *sqlx.Tx, userID int) error {
+	if _, err := tx.Exec("UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0 WHERE id = $1", userID); err != nil {
+		return err
+	}
+	_, err := tx.Exec("DELETE FROM user_recovery_codes WHERE user_id = $1", userID)
+	return err
+}
+
+// ResetUserMFA lets an owner remove 2FA from a user who lost their device.
+// If 2FA is required they will be asked to enrol again at their next login.
+func ResetUserMFA(c *gin.Context) {
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var userID int
+	if err := tx.Get(&userID, "SELECT id FROM users WHERE id = $1", c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err := resetMFA(tx, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset two-factor authentication"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset two-factor authentication"})
+		return
+	}
+	recordAudit(c, "reset_mfa", auditUser, userID, nil, nil)
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+func GetSecuritySettings(c *gin.Context) {
+	required, err := mfaRequired()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"require_mfa": required})
+}
+
+// UpdateSecuritySettings sets the panel-wide 2FA policy. When required,
+// users without 2FA must enrol at their next login, and their existing
+// sessions stop refreshing.
+func UpdateSecuritySettings(c *gin.Context) {
+	var input struct {
+		RequireMFA *bool `json:"require_mfa" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	before, err := mfaRequired()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	_, err = database.DB.Exec(`
+		INSERT INTO settings (key, value) VALUES ($1, $2)
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, updated_at = NOW()`,
+		settingRequireMFA, fmt.Sprint(*input.RequireMFA))
+	if err != nil {
+		log.Printf("UpdateSecuritySettings DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update settings"})
+		return
+	}
+	recordAudit(c, "update", auditSettings, settingRequireMFA, gin.H{"require_mfa": before}, gin.H{"require_mfa": *input.RequireMFA})
+	c.JSON(http.StatusOK, gin.H{"require_mfa": *input.RequireMFA})
+}
@@ -0,0 +1,394 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"hotel-story-panel/backend/internal/database"
+	"hotel-story-panel/backend/internal/mailer"
+	"hotel-story-panel/backend/internal/middleware"
+	"hotel-story-panel/backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// reviewFrom lists the review states each transition may start from.
+// Publishing (approved to published) goes through PublishGroup.
+var reviewFrom = map[string][]string{
+	"submit":   {models.ReviewDraft, models.ReviewRejected, models.ReviewPublished},
+	"withdraw": {models.ReviewInReview, models.ReviewApproved},
+	"approve":  {models.ReviewInReview},
+	"reject":   {models.ReviewInReview, models.ReviewApproved},
+}
+
+// groupReview is the review state of a group locked for a transition.
+type groupReview struct {
+	ID          int    `db:"id"`
+	TitleFa     string `db:"title_fa"`
+	State       string `db:"review_state"`
+	ReviewerID  *int   `db:"reviewer_id"`
+	SubmittedBy *int   `db:"submitted_by"`
+	Changed     bool   `db:"changed"`
+	Slides      int    `db:"slides"`
+}
+
+type reviewInput struct {
+	Comment    string `json:"comment"`
+	ReviewerID *int   `json:"reviewer_id"` // submit only
+}
+
+// beginReview starts a review transition on group :id: it binds the input,
+// locks the group and checks that action may start from its current state.
+// On failure it writes the response and returns ok false.
+func beginReview(c *gin.Context, action string) (tx *sqlx.Tx, g *groupReview, input reviewInput, ok bool) {
+	id := c.Param("id")
+	if !groupInScope(c, id) {
+		return nil, nil, input, false
+	}
+	// The body is optional for transitions without a required comment
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return nil, nil, input, false
+		}
+	}
+	input.Comment = strings.TrimSpace(input.Comment)
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return nil, nil, input, false
+	}
+	if _, err := lockGroup(tx, id); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return nil, nil, input, false
+	}
+	g = &groupReview{}
+	err = tx.Get(g, `
+		SELECT g.id, g.title_fa, g.review_state, g.reviewer_id, g.submitted_by, `+draftChangedSQL+` AS changed,
+			(SELECT COUNT(*) FROM story_slides WHERE group_id = g.id) AS slides
+		FROM story_groups g WHERE g.id = $1`, id)
+	if err != nil {
+		tx.Rollback()
+		log.Printf("Review %s DB Error: %v", action, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, nil, input, false
+	}
+	if !slices.Contains(reviewFrom[action], g.State) {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{
+			"error": fmt.Sprintf("Cannot %s a group that is %s", action, g.State),
+			"code":  "invalid_transition",
+		})
+		return nil, nil, input, false
+	}
+	return tx, g, input, true
+}
+
+// finishReview moves the locked group to state with the extra assignments
+// in set, posts the transition to the group's comments and commits.
+func finishReview(c *gin.Context, tx *sqlx.Tx, g *groupReview, action, state, comment, set string, args ...any) bool {
+	args = append([]any{state, g.ID}, args...)
+	_, err := tx.Exec("UPDATE story_groups g SET review_state = $1"+set+" WHERE g.id = $2", args...)
+	if err == nil {
+		_, err = tx.Exec(`
+			INSERT INTO story_group_comments (group_id, user_id, body, transition)
+			VALUES ($1, NULLIF($2, 0), $3, $4)`, g.ID, callerID(c), comment, action)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("Review %s DB Error: %v", action, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update review"})
+		return false
+	}
+	recordAudit(c, action, auditGroup, g.ID, gin.H{"review_state": g.State}, gin.H{"review_state": state})
+	return true
+}
+
+// mayDecide checks that the caller may approve or reject g: a group
+// assigned to a reviewer is decided by them, and nobody approves their own
+// submission. Owners may do both.
+func mayDecide(c *gin.Context, g *groupReview, approving bool) bool {
+	if c.GetString("role") == models.RoleOwner {
+		return true
+	}
+	caller := callerID(c)
+	if g.ReviewerID != nil && *g.ReviewerID != caller {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This group is assigned to another reviewer", "code": "not_assigned"})
+		return false
+	}
+	if approving && g.SubmittedBy != nil && *g.SubmittedBy == caller {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can't approve your own submission", "code": "own_submission"})
+		return false
+	}
+	return true
+}
+
+// validReviewer reports whether user id exists and may review content.
+func validReviewer(id int) (bool, error) {
+	var ok bool
+	err := database.DB.Get(&ok, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND role = ANY($2))",
+		id, pq.StringArray(middleware.RolesWith(middleware.ReviewContent)))
+	return ok, err
+}
+
+// notifyAuthor emails the submitter of g about a review decision. The
+// decision has already been made, so a failure is only logged.
+func notifyAuthor(c *gin.Context, g *groupReview, template, comment string) {
+	if g.SubmittedBy == nil || *g.SubmittedBy == callerID(c) {
+		return
+	}
+	var emails struct {
+		Author   string `db:"author"`
+		Reviewer string `db:"reviewer"`
+	}
+	err := database.DB.Get(&emails, `
+		SELECT a.email AS author, COALESCE((SELECT email FROM users WHERE id = $2), '') AS reviewer
+		FROM users a WHERE a.id = $1`, *g.SubmittedBy, callerID(c))
+	if err != nil {
+		log.Printf("Review notification for group %d: %v", g.ID, err)
+		return
+	}
+	msg, err := mailer.Render(template, emails.Author, gin.H{
+		"Title":    g.TitleFa,
+		"Reviewer": emails.Reviewer,
+		"Comment":  comment,
+		"Link":     panelURL(fmt.Sprintf("/dashboard/group/%d", g.ID)),
+	})
+	if err == nil {
+		err = mailer.Send(c.Request.Context(), msg)
+	}
+	if err != nil {
+		log.Printf("Review notification for group %d: %v", g.ID, err)
+	}
+}
+
+// SubmitGroup sends the group's draft for review, optionally assigning a
+// reviewer.
+func SubmitGroup(c *gin.Context) {
+	tx, g, input, ok := beginReview(c, "submit")
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	if !g.Changed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Nothing to review: the draft matches the published version", "code": "no_changes"})
+		return
+	}
+	if g.Slides == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Add at least one slide before submitting", "code": "empty_draft"})
+		return
+	}
+	if input.ReviewerID != nil {
+		valid, err := validReviewer(*input.ReviewerID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if !valid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "reviewer_id must be a user who can review content"})
+			return
+		}
+	}
+
+	if finishReview(c, tx, g, "submit", models.ReviewInReview, input.Comment,
+		", submitted_by = NULLIF($3, 0), submitted_at = NOW(), approved_content = NULL, reviewer_id = COALESCE($4, g.reviewer_id)",
+		callerID(c), input.ReviewerID) {
+		c.JSON(http.StatusOK, gin.H{"review_state": models.ReviewInReview})
+	}
+}
+
+// WithdrawGroup takes a submitted or approved draft back for editing.
+func WithdrawGroup(c *gin.Context) {
+	tx, g, input, ok := beginReview(c, "withdraw")
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	if finishReview(c, tx, g, "withdraw", models.ReviewDraft, input.Comment, ", approved_content = NULL") {
+		c.JSON(http.StatusOK, gin.H{"review_state": models.ReviewDraft})
+	}
+}
+
+// ApproveGroup approves the draft under review as it is now. Publishing
+// requires the draft to be unchanged since.
+func ApproveGroup(c *gin.Context) {
+	tx, g, input, ok := beginReview(c, "approve")
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+	if !mayDecide(c, g, true) {
+		return
+	}
+
+	if finishReview(c, tx, g, "approve", models.ReviewApproved, input.Comment,
+		", approved_content = "+draftContentSQL) {
+		notifyAuthor(c, g, "review_approved", input.Comment)
+		c.JSON(http.StatusOK, gin.H{"review_state": models.ReviewApproved})
+	}
+}
+
+// RejectGroup sends the draft back to its author with a required comment.
+func RejectGroup(c *gin.Context) {
+	tx, g, input, ok := beginReview(c, "reject")
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+	if !mayDecide(c, g, false) {
+		return
+	}
+	if input.Comment == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Explain what needs to change in comment"})
+		return
+	}
+
+	if finishReview(c, tx, g, "reject", models.ReviewRejected, input.Comment, ", approved_content = NULL") {
+		notifyAuthor(c, g, "review_rejected", input.Comment)
+		c.JSON(http.StatusOK, gin.H{"review_state": models.ReviewRejected})
+	}
+}
+
+// AssignReviewer sets or, with a null reviewer_id, clears the reviewer who
+// decides on the group.
+func AssignReviewer(c *gin.Context) {
+	id := c.Param("id")
+	if !groupInScope(c, id) {
+		return
+	}
+	var input struct {
+		ReviewerID *int `json:"reviewer_id"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.ReviewerID != nil {
+		valid, err := validReviewer(*input.ReviewerID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if !valid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "reviewer_id must be a user who can review content"})
+			return
+		}
+	}
+
+	var before *int
+	database.DB.Get(&before, "SELECT reviewer_id FROM story_groups WHERE id = $1", id)
+	_, err := database.DB.Exec("UPDATE story_groups SET reviewer_id = $1 WHERE id = $2", input.ReviewerID, id)
+	if err != nil {
+		log.Printf("AssignReviewer DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign reviewer"})
+		return
+	}
+
+	recordAudit(c, "assign_reviewer", auditGroup, id, gin.H{"reviewer_id": before}, gin.H{"reviewer_id": input.ReviewerID})
+	c.JSON(http.StatusOK, gin.H{"reviewer_id": input.ReviewerID})
+}
+
+// GetReviewers lists the users who can be assigned as reviewers.
+func GetReviewers(c *gin.Context) {
+	reviewers := []models.User{}
+	err := database.DB.Select(&reviewers, "SELECT id, email, role, created_at FROM users WHERE role = ANY($1) ORDER BY email",
+		pq.StringArray(middleware.RolesWith(middleware.ReviewContent)))
+	if err != nil {
+		log.Printf("GetReviewers DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reviewers"})
+		return
+	}
+	c.JSON(http.StatusOK, reviewers)
+}
+
+// GetGroupComments lists a group's review comments and transitions, oldest
+// first; ?slide_id= narrows them to one slide.
+func GetGroupComments(c *gin.Context) {
+	id := c.Param("id")
+	if !groupInScope(c, id) {
+		return
+	}
+	var slideID *int
+	if v := c.Query("slide_id"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "slide_id must be a number"})
+			return
+		}
+		slideID = &n
+	}
+
+	comments := []models.GroupComment{}
+	err := database.DB.Select(&comments, `
+		SELECT cm.id, cm.group_id, cm.slide_id, cm.user_id, u.email AS user_email, cm.body, cm.transition, cm.created_at
+		FROM story_group_comments cm
+		LEFT JOIN users u ON u.id = cm.user_id
+		WHERE cm.group_id = $1 AND ($2::int IS NULL OR cm.slide_id = $2)
+		ORDER BY cm.created_at, cm.id`, id, slideID)
+	if err != nil {
+		log.Printf("GetGroupComments DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch comments"})
+		return
+	}
+	c.JSON(http.StatusOK, comments)
+}
+
+// AddGroupComment comments on a group, or on one of its slides with
+// slide_id.
+func AddGroupComment(c *gin.Context) {
+	id := c.Param("id")
+	if !groupInScope(c, id) {
+		return
+	}
+	var input struct {
+		Body    string `json:"body"`
+		SlideID *int   `json:"slide_id"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.Body = strings.TrimSpace(input.Body)
+	if input.Body == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "body is required"})
+		return
+	}
+	if input.SlideID != nil {
+		var exists bool
+		database.DB.Get(&exists, "SELECT EXISTS (SELECT 1 FROM story_slides WHERE id = $1 AND group_id = $2)", *input.SlideID, id)
+		if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "slide_id must be a slide of this group"})
+			return
+		}
+	}
+
+	var comment models.GroupComment
+	err := database.DB.Get(&comment, `
+		WITH cm AS (
+			INSERT INTO story_group_comments (group_id, slide_id, user_id, body)
+			VALUES ($1, $2, NULLIF($3, 0), $4)
+			RETURNING *
+		)
+		SELECT cm.id, cm.group_id, cm.slide_id, cm.user_id, u.email AS user_email, cm.body, cm.transition, cm.created_at
+		FROM cm LEFT JOIN users u ON u.id = cm.user_id`, id, input.SlideID, callerID(c), input.Body)
+	if err != nil {
+		log.Printf("AddGroupComment DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add comment"})
+		return
+	}
+
+	recordAudit(c, "create", auditComment, comment.ID, nil, gin.H{"group_id": comment.GroupID, "slide_id": comment.SlideID, "body": comment.Body})
+	c.JSON(http.StatusCreated, comment)
+}
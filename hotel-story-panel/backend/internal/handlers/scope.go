@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"slices"
+
+	"hotel-story-panel/backend/internal/database"
+	"hotel-story-panel/backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// accessScope is what part of the content a caller may see and change.
+type accessScope struct {
+	limited bool
+	cities  pq.StringArray
+	hotels  pq.StringArray
+}
+
+// callerID returns the user id AuthMiddleware put in the context. JWT
+// numbers decode as float64.
+func callerID(c *gin.Context) int {
+	if id, ok := c.Get("userID"); ok {
+		if f, ok := id.(float64); ok {
+			return int(f)
+		}
+	}
+	return 0
+}
+
+func loadScope(userID int) (*models.UserScope, error) {
+	scope := &models.UserScope{Cities: []string{}, Hotels: []string{}}
+	if err := database.DB.Get(&scope.All, "SELECT unrestricted FROM users WHERE id = $1", userID); err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		CitySlug  *string `db:"city_slug"`
+		HotelSlug *string `db:"hotel_slug"`
+	}
+	err := database.DB.Select(&rows, "SELECT city_slug, hotel_slug FROM user_scopes WHERE user_id = $1 ORDER BY city_slug, hotel_slug", userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		if r.CitySlug != nil {
+			scope.Cities = append(scope.Cities, *r.CitySlug)
+		} else if r.HotelSlug != nil {
+			scope.Hotels = append(scope.Hotels, *r.HotelSlug)
+		}
+	}
+	return scope, nil
+}
+
+// callerScope loads the caller's scope, writing a 500 and returning false
+// if it can't.
+func callerScope(c *gin.Context) (*accessScope, bool) {
+	if c.GetString("role") == models.RoleOwner {
+		return &accessScope{}, true
+	}
+	grants, err := loadScope(callerID(c))
+	if err != nil {
+		log.Printf("Scope lookup error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, false
+	}
+	return &accessScope{
+		limited: !grants.All,
+		cities:  grants.Cities,
+		hotels:  grants.Hotels,
+	}, true
+}
+
+// covers reports whether a group in city, attached to hotels, is in scope:
+// its city is granted or it is attached to a granted hotel.
+func (s *accessScope) covers(city string, hotels []string) bool {
+	if !s.limited || slices.Contains(s.cities, city) {
+		return true
+	}
+	for _, h := range hotels {
+		if slices.Contains(s.hotels, h) {
+			return true
+		}
+	}
+	return false
+}
+
+// groupInScope checks that group id exists and is in the caller's scope,
+// writing a 404 otherwise so out-of-scope groups are indistinguishable from
+// missing ones.
+func groupInScope(c *gin.Context, id any) bool {
+	scope, ok := callerScope(c)
+	if !ok {
+		return false
+	}
+	var group struct {
+		CitySlug string         `db:"city_slug"`
+		Hotels   pq.StringArray `db:"hotels"`
+	}
+	err := database.DB.Get(&group, `
+		SELECT city_slug,
+			COALESCE((SELECT array_agg(hotel_slug) FROM story_group_hotels WHERE group_id = story_groups.id), '{}') AS hotels
+		FROM story_groups WHERE id = $1`, id)
+	if err != nil || !scope.covers(group.CitySlug, group.Hotels) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return false
+	}
+	return true
+}
+
+// slideInScope is groupInScope for the group of slide id.
+func slideInScope(c *gin.Context, id string) bool {
+	var groupID int
+	if err := database.DB.Get(&groupID, "SELECT group_id FROM story_slides WHERE id = $1", id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Slide not found"})
+		return false
+	}
+	return groupInScope(c, groupID)
+}
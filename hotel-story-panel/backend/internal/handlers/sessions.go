@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"hotel-story-panel/backend/internal/database"
+	"hotel-story-panel/backend/internal/middleware"
+	"hotel-story-panel/backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const refreshCookie = "refresh_token"
+
+// refreshTokenTTL is how long a session survives without being refreshed;
+// every refresh extends it. REFRESH_TOKEN_TTL overrides it (e.g. "168h").
+var refreshTokenTTL = 30 * 24 * time.Hour
+
+// reuseGrace is how long after a rotation the replaced refresh token is
+// merely refused rather than treated as stolen, so two tabs refreshing at
+// once don't end the session.
+const reuseGrace = 30 * time.Second
+
+func init() {
+	if v, err := time.ParseDuration(os.Getenv("REFRESH_TOKEN_TTL")); err == nil && v > 0 {
+		refreshTokenTTL = v
+	}
+}
+
+// newToken returns a random secret token (refresh, invitation or reset) and
+// the hash stored for it; the token itself is never stored.
+func newToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// refreshTokenFrom reads the refresh token from its cookie; it is never
+// handed to scripts, so that is the only place it can come from.
+func refreshTokenFrom(c *gin.Context) string {
+	v, _ := c.Cookie(refreshCookie)
+	return v
+}
+
+// respondTokens sends a fresh access token, and the refresh token as an
+// HttpOnly cookie scoped to the auth endpoints. Fields in extra
+// are added to the response.
+func respondTokens(c *gin.Context, user *models.User, sessionID int64, refreshToken string, extra gin.H) {
+	token, err := middleware.GenerateToken(user.ID, user.Role, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue token"})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(refreshCookie, refreshToken, int(refreshTokenTTL.Seconds()), "/api/auth", "", os.Getenv("COOKIE_SECURE") == "true", true)
+	response := gin.H{
+		"token":      token,
+		"expires_in": int(middleware.AccessTokenTTL.Seconds()),
+		"role":       user.Role,
+	}
+	for k, v := range extra {
+		response[k] = v
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// startSession records a new login for user and responds with its tokens.
+// Logins go through completeLogin, which asks for the second factor first.
+func startSession(c *gin.Context, user *models.User, extra gin.H) {
+	refreshToken, hash, err := newToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start session"})
+		return
+	}
+
+	// A completed login clears any run of failed attempts
+	if _, err := database.DB.Exec("UPDATE users SET failed_logins = 0, locked_until = NULL WHERE id = $1 AND failed_logins > 0", user.ID); err != nil {
+		log.Printf("startSession DB Error: %v", err)
+	}
+
+	var sessionID int64
+	err = database.DB.Get(&sessionID, `
+		INSERT INTO user_sessions (user_id, refresh_hash, user_agent, ip, expires_at)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		user.ID, hash, c.Request.UserAgent(), c.ClientIP(), time.Now().Add(refreshTokenTTL))
+	if err != nil {
+		log.Printf("startSession DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start session"})
+		return
+	}
+
+	respondTokens(c, user, sessionID, refreshToken, extra)
+}
+
+// Refresh exchanges a refresh token for a new access token and a new
+// refresh token. Presenting a refresh token that was already rotated away
+// means it leaked, so the whole session is revoked.
+func Refresh(c *gin.Context) {
+	presented := refreshTokenFrom(c)
+	if presented == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token required"})
+		return
+	}
+	hash := hashToken(presented)
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var session struct {
+		ID          int64      `db:"id"`
+		UserID      int        `db:"user_id"`
+		RefreshHash string     `db:"refresh_hash"`
+		RotatedAt   *time.Time `db:"rotated_at"`
+		ExpiresAt   time.Time  `db:"expires_at"`
+		RevokedAt   *time.Time `db:"revoked_at"`
+	}
+	err = tx.Get(&session, `
+		SELECT id, user_id, refresh_hash, rotated_at, expires_at, revoked_at FROM user_sessions
+		WHERE refresh_hash = $1 OR previous_hash = $1
+		FOR UPDATE`, hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if session.RevokedAt != nil || !session.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has ended"})
+		return
+	}
+	if session.RefreshHash != hash {
+		if session.RotatedAt != nil && time.Since(*session.RotatedAt) < reuseGrace {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token was already used"})
+			return
+		}
+		if _, err := tx.Exec("UPDATE user_sessions SET revoked_at = NOW() WHERE id = $1", session.ID); err == nil {
+			tx.Commit()
+		}
+		log.Printf("Refresh token reuse, revoked session %d of user %d", session.ID, session.UserID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token reuse detected; session revoked"})
+		return
+	}
+
+	// The role is re-read so role changes take effect at the next refresh
+	var user models.User
+	if err := tx.Get(&user, "SELECT id, email, role, created_at, totp_enabled_at FROM users WHERE id = $1", session.UserID); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	// Once 2FA is required, sessions of users without it are not renewed, so
+	// they sign in again and enrol
+	if user.TOTPEnabledAt == nil {
+		required, err := mfaRequired()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if required {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Two-factor authentication is required; sign in again", "code": "mfa_enrollment_required"})
+			return
+		}
+	}
+
+	refreshToken, newHash, err := newToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+	_, err = tx.Exec(`
+		UPDATE user_sessions SET
+			previous_hash = refresh_hash,
+			refresh_hash = $1,
+			rotated_at = NOW(),
+			last_used_at = NOW(),
+			expires_at = $2,
+			ip = $3
+		WHERE id = $4`, newHash, time.Now().Add(refreshTokenTTL), c.ClientIP(), session.ID)
+	if err != nil {
+		log.Printf("Refresh DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+
+	respondTokens(c, &user, session.ID, refreshToken, nil)
+}
+
+// Logout revokes the session of the presented refresh token and clears the
+// cookie. It succeeds even if the session is already gone.
+func Logout(c *gin.Context) {
+	if presented := refreshTokenFrom(c); presented != "" {
+		_, err := database.DB.Exec("UPDATE user_sessions SET revoked_at = NOW() WHERE refresh_hash = $1 AND revoked_at IS NULL", hashToken(presented))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+			return
+		}
+	}
+	c.SetCookie(refreshCookie, "", -1, "/api/auth", "", os.Getenv("COOKIE_SECURE") == "true", true)
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// GetSessions lists the caller's active sessions.
+func GetSessions(c *gin.Context) {
+	sessions := []models.Session{}
+	err := database.DB.Select(&sessions, `
+		SELECT id, user_agent, ip, created_at, last_used_at, expires_at FROM user_sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_used_at DESC`, callerID(c))
+	if err != nil {
+		log.Printf("GetSessions DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+	current := c.GetInt64("sessionID")
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+	c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSession ends one of the caller's own sessions.
+func RevokeSession(c *gin.Context) {
+	res, err := database.DB.Exec("UPDATE user_sessions SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL", c.Param("id"), callerID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// RevokeAllSessions ends every session of the caller, including this one.
+func RevokeAllSessions(c *gin.Context) {
+	revokeUserSessions(c, callerID(c))
+}
+
+// RevokeUserSessions lets an owner sign another user out everywhere.
+func RevokeUserSessions(c *gin.Context) {
+	var userID int
+	if err := database.DB.Get(&userID, "SELECT id FROM users WHERE id = $1", c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if revokeUserSessions(c, userID) {
+		recordAudit(c, "revoke_sessions", auditUser, userID, nil, nil)
+	}
+}
+
+func revokeUserSessions(c *gin.Context, userID int) bool {
+	res, err := database.DB.Exec("UPDATE user_sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL", userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return false
+	}
+	n, _ := res.RowsAffected()
+	c.JSON(http.StatusOK, gin.H{"success": true, "revoked": n})
+	return true
+}
@@ -1,17 +1,23 @@
 package handlers
 
 import (
-	"encoding/json"
+	"database/sql"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
-	"os"
-	"path/filepath"
+	"strconv"
 	"time"
 
 	"hotel-story-panel/backend/internal/database"
+	"hotel-story-panel/backend/internal/elements"
+	"hotel-story-panel/backend/internal/events"
+	"hotel-story-panel/backend/internal/media"
 	"hotel-story-panel/backend/internal/models"
+	"hotel-story-panel/backend/internal/timeutil"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
 )
 
 // --- Stats ---
@@ -58,23 +64,45 @@ func GetDashboardStats(c *gin.Context) {
 
 // --- Groups ---
 
+// GetGroups lists the groups in the caller's scope; ?hotel=slug narrows it
+// to groups attached to that hotel or with slides tagged for it.
 func GetGroups(c *gin.Context) {
+	scope, ok := callerScope(c)
+	if !ok {
+		return
+	}
+
 	groups := []models.StoryGroup{}
 	query := `
 		SELECT 
 			g.id, g.city_slug, g.title_fa, g.caption, g.cover_url, g.short_code, g.active, g.view_count, g.open_count, g.created_at,
+			g.starts_at, g.ends_at, g.published_version, ` + draftChangedSQL + ` AS has_draft_changes,
+			g.review_state, g.reviewer_id, g.submitted_by, g.submitted_at,
+			COALESCE((SELECT array_agg(h.hotel_slug ORDER BY h.hotel_slug) FROM story_group_hotels h WHERE h.group_id = g.id), '{}') AS hotels,
 			COUNT(s.id) as story_count
 		FROM story_groups g
 		LEFT JOIN story_slides s ON s.group_id = g.id
-		GROUP BY g.id, g.city_slug, g.title_fa, g.caption, g.cover_url, g.short_code, g.active, g.view_count, g.open_count, g.created_at
+		WHERE ($1 = ''
+				OR EXISTS (SELECT 1 FROM story_group_hotels h WHERE h.group_id = g.id AND h.hotel_slug = $1)
+				OR EXISTS (SELECT 1 FROM story_slides hs WHERE hs.group_id = g.id AND $1 = ANY(hs.hotel_slugs)))
+			AND (NOT $2
+				OR g.city_slug = ANY($3)
+				OR EXISTS (SELECT 1 FROM story_group_hotels h WHERE h.group_id = g.id AND h.hotel_slug = ANY($4)))
+		GROUP BY g.id, g.city_slug, g.title_fa, g.caption, g.cover_url, g.short_code, g.active, g.view_count, g.open_count, g.created_at,
+			g.starts_at, g.ends_at, g.published_version, g.review_state, g.reviewer_id, g.submitted_by, g.submitted_at
 		ORDER BY g.created_at DESC`
 
-	err := database.DB.Select(&groups, query)
+	err := database.DB.Select(&groups, query, normalizeSlug(c.Query("hotel")), scope.limited, scope.cities, scope.hotels)
 	if err != nil {
 		fmt.Printf("DEBUG: GetGroups DB Error: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch groups"})
 		return
 	}
+
+	now := time.Now()
+	for i := range groups {
+		prepareGroup(&groups[i], now)
+	}
 	c.JSON(http.StatusOK, groups)
 }
 
@@ -83,15 +111,28 @@ func GetGroup(c *gin.Context) {
 	var group models.StoryGroup
 	query := `
 		SELECT 
-			id, city_slug, title_fa, caption, cover_url, short_code, active, view_count, open_count, created_at,
-			(SELECT COUNT(*) FROM story_slides WHERE group_id = story_groups.id) as story_count
-		FROM story_groups 
-		WHERE id = $1`
+			g.id, g.city_slug, g.title_fa, g.caption, g.cover_url, g.short_code, g.active, g.view_count, g.open_count, g.created_at,
+			g.starts_at, g.ends_at, g.published_version, ` + draftChangedSQL + ` AS has_draft_changes,
+			g.review_state, g.reviewer_id, (SELECT email FROM users WHERE id = g.reviewer_id) AS reviewer_email,
+			g.submitted_by, g.submitted_at,
+			COALESCE((SELECT array_agg(h.hotel_slug ORDER BY h.hotel_slug) FROM story_group_hotels h WHERE h.group_id = g.id), '{}') AS hotels,
+			(SELECT COUNT(*) FROM story_slides s WHERE s.group_id = g.id) as story_count
+		FROM story_groups g
+		WHERE g.id = $1`
 	err := database.DB.Get(&group, query, id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
 		return
 	}
+	scope, ok := callerScope(c)
+	if !ok {
+		return
+	}
+	if !scope.covers(group.CitySlug, group.Hotels) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+	prepareGroup(&group, time.Now())
 
 	var slides []models.StorySlide
 	err = database.DB.Select(&slides, "SELECT * FROM story_slides WHERE group_id = $1 ORDER BY sort_order ASC", id)
@@ -116,13 +157,32 @@ func CreateGroup(c *gin.Context) {
 		return
 	}
 
+	if err := validateWindow(&input, true); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !canonicalCity(c, &input) {
+		return
+	}
+
+	input.Hotels = normalizeSlugs(input.Hotels)
+	scope, ok := callerScope(c)
+	if !ok {
+		return
+	}
+	if !scope.covers(input.CitySlug, input.Hotels) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "City and hotels are outside your permissions"})
+		return
+	}
+
 	// Generate short_code if not provided (simple logic for MVP)
 	if input.ShortCode == "" {
 		input.ShortCode = fmt.Sprintf("%s-%d", input.CitySlug, time.Now().Unix())
 	}
 
-	query := `INSERT INTO story_groups (city_slug, title_fa, caption, cover_url, short_code, active) 
-              VALUES (:city_slug, :title_fa, :caption, :cover_url, :short_code, :active) RETURNING id`
+	query := `INSERT INTO story_groups (city_slug, title_fa, caption, cover_url, short_code, active, starts_at, ends_at) 
+              VALUES (:city_slug, :title_fa, :caption, :cover_url, :short_code, :active, :starts_at, :ends_at) RETURNING id`
 
 	rows, err := database.DB.NamedQuery(query, input)
 	if err != nil {
@@ -136,11 +196,24 @@ func CreateGroup(c *gin.Context) {
 		rows.Scan(&input.ID)
 	}
 
+	if err := setGroupHotels(input.ID, input.Hotels); err != nil {
+		log.Printf("CreateGroup hotels Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save group hotels"})
+		return
+	}
+
+	recordAudit(c, "create", auditGroup, input.ID, nil, groupSnapshot(input.ID))
+
+	prepareGroup(&input, time.Now())
 	c.JSON(http.StatusCreated, input)
 }
 
 func UpdateGroup(c *gin.Context) {
 	id := c.Param("id")
+	if !groupInScope(c, id) {
+		return
+	}
+
 	var input models.StoryGroup
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -152,105 +225,203 @@ func UpdateGroup(c *gin.Context) {
 		return
 	}
 
+	if err := validateWindow(&input, false); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !canonicalCity(c, &input) {
+		return
+	}
+
+	// The group must stay within the caller's scope after the change too
+	hotels := input.Hotels
+	if hotels == nil {
+		if err := database.DB.Select(&hotels, "SELECT hotel_slug FROM story_group_hotels WHERE group_id = $1", id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+	scope, ok := callerScope(c)
+	if !ok {
+		return
+	}
+	if !scope.covers(input.CitySlug, normalizeSlugs(hotels)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "City and hotels are outside your permissions"})
+		return
+	}
+
+	before := groupSnapshot(id)
+
 	query := `UPDATE story_groups SET 
 				city_slug = $1, 
 				title_fa = $2, 
 				caption = $3, 
 				cover_url = $4, 
-				active = $5 
-			  WHERE id = $6`
+				active = $5,
+				starts_at = $6,
+				ends_at = $7
+			  WHERE id = $8`
 
-	_, err := database.DB.Exec(query, input.CitySlug, input.TitleFa, input.Caption, input.CoverURL, input.Active, id)
+	_, err := database.DB.Exec(query, input.CitySlug, input.TitleFa, input.Caption, input.CoverURL, input.Active, input.StartsAt, input.EndsAt, id)
 	if err != nil {
 		fmt.Printf("DEBUG: UpdateGroup DB Error: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update group"})
 		return
 	}
 
+	// Clients that don't send hotels leave the attachments alone
+	if input.Hotels != nil {
+		groupID, _ := strconv.Atoi(id)
+		if err := setGroupHotels(groupID, input.Hotels); err != nil {
+			log.Printf("UpdateGroup hotels Error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save group hotels"})
+			return
+		}
+	}
+
+	recordAudit(c, "update", auditGroup, id, before, groupSnapshot(id))
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
 
+// validateWindow checks the optional publishing window. New groups may not
+// be created already expired.
+func validateWindow(g *models.StoryGroup, creating bool) error {
+	if g.StartsAt != nil && g.EndsAt != nil && !g.EndsAt.After(*g.StartsAt) {
+		return errors.New("ends_at must be after starts_at")
+	}
+	if creating && g.EndsAt != nil && !g.EndsAt.After(time.Now()) {
+		return errors.New("ends_at must be in the future")
+	}
+	return nil
+}
+
+// canonicalCity replaces the group's city_slug with the registered city it
+// refers to, writing a 400 and returning false when there is none.
+func canonicalCity(c *gin.Context, g *models.StoryGroup) bool {
+	city, err := resolveCity(g.CitySlug)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown city", "code": "unknown_city"})
+		return false
+	}
+	if err != nil {
+		log.Printf("City lookup error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	g.CitySlug = city.Slug
+	return true
+}
+
+// prepareGroup computes the display status and presents window times in
+// Tehran local time.
+func prepareGroup(g *models.StoryGroup, now time.Time) {
+	if g.StartsAt != nil {
+		t := g.StartsAt.In(timeutil.Tehran)
+		g.StartsAt = &t
+	}
+	if g.EndsAt != nil {
+		t := g.EndsAt.In(timeutil.Tehran)
+		g.EndsAt = &t
+	}
+	g.ComputeStatus(now)
+}
+
 func UploadImage(c *gin.Context) {
 	fmt.Println("DEBUG: UploadImage handler hit")
 	file, err := c.FormFile("image")
 	if err != nil {
 		fmt.Printf("DEBUG: UploadImage FormFile error: %v\n", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No image provided"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No image provided", "code": media.CodeFileMissing})
 		return
 	}
 
-	// 2MB Limit
-	const maxSize = 2 * 1024 * 1024
-	if file.Size > maxSize {
-		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File size exceeds 2MB limit"})
-		return
-	}
-
-	uploadDir := "./uploads"
-	if _, err := os.Stat(uploadDir); os.IsNotExist(err) {
-		os.Mkdir(uploadDir, 0755)
-	}
-
-	filename := fmt.Sprintf("%d_%s", time.Now().UnixNano(), filepath.Base(file.Filename))
-	dst := filepath.Join(uploadDir, filename)
-
-	if err := c.SaveUploadedFile(file, dst); err != nil {
-		fmt.Printf("DEBUG: UploadImage Save Error: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+	urls, err := saveImageRenditions(c, file, media.CoverPolicy, media.DisplayRendition, media.ThumbnailRendition)
+	if err != nil {
+		respondUploadError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"url": "/uploads/" + filename})
+	recordAudit(c, "upload", auditMedia, nil, nil, gin.H{"filename": file.Filename, "size": file.Size, "url": urls["display"]})
+	c.JSON(http.StatusOK, gin.H{"url": urls["display"], "thumbnail_url": urls["thumb"]})
 }
 
 // --- Slides ---
 
 func AddSlide(c *gin.Context) {
 	groupID := c.Param("id")
+	if !groupInScope(c, groupID) {
+		return
+	}
 	caption := c.PostForm("caption_fa")
 	durationStr := c.PostForm("duration")
 	bgColor := c.PostForm("background_color")
 
+	// Elements are checked before any upload is stored
+	ctx, err := elementContext(groupID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+	slideElements, err := elements.Normalize([]byte(c.PostForm("elements")), ctx)
+	if err != nil {
+		respondElementsError(c, err)
+		return
+	}
+
 	// Duration (default 7)
 	duration := 7
 	if durationStr != "" {
 		fmt.Sscanf(durationStr, "%d", &duration)
 	}
 
-	// Image Upload (Partial Optional if bgColor is set)
+	// Media Upload: a video, an image, or neither if bgColor is set
+	mediaType := "color"
 	var imageURL string
-	file, err := c.FormFile("image")
-	if err == nil {
-		// Valid image file provided
-		uploadDir := "./uploads"
-		if _, err := os.Stat(uploadDir); os.IsNotExist(err) {
-			os.Mkdir(uploadDir, 0755)
+	var thumbnailURL, previewURL, videoURL *string
+	var imageWebP, thumbnailWebP, previewWebP *string
+	if file, err := c.FormFile("video"); err == nil {
+		upload, err := saveVideo(c, file)
+		if err != nil {
+			respondUploadError(c, err)
+			return
 		}
-		filename := fmt.Sprintf("%d_%s", time.Now().UnixNano(), filepath.Base(file.Filename))
-		dst := filepath.Join(uploadDir, filename)
-		if err := c.SaveUploadedFile(file, dst); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+		mediaType = "video"
+		videoURL = &upload.VideoURL
+		duration = upload.Duration // the real length wins over the form value
+		imageURL, thumbnailURL, previewURL = renditionURLs(upload.Poster)
+		imageWebP, thumbnailWebP, previewWebP = webpURLs(upload.Poster)
+	} else if file, err := c.FormFile("image"); err == nil {
+		// Valid image file provided
+		urls, err := saveImageRenditions(c, file, media.SlidePolicy, slideRenditions...)
+		if err != nil {
+			respondUploadError(c, err)
 			return
 		}
-		imageURL = "/uploads/" + filename
+		mediaType = "image"
+		imageURL, thumbnailURL, previewURL = renditionURLs(urls)
+		imageWebP, thumbnailWebP, previewWebP = webpURLs(urls)
 	} else if bgColor == "" {
-		// No image AND no background color -> Error
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Image file OR background color is required"})
+		// No media AND no background color -> Error
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Image or video file OR background color is required", "code": media.CodeFileMissing})
 		return
 	}
 
-	elements := c.PostForm("elements")
-	// fmt.Println("DEBUG ELEMENTS:", elements)
-	if elements == "" {
-		elements = "[]"
-	}
-
 	slide := models.StorySlide{
-		GroupID:   0, // set below
-		ImageURL:  imageURL,
-		CaptionFa: caption,
-		Elements:  json.RawMessage(elements),
-		Duration:  duration,
+		GroupID:      0, // set below
+		ImageURL:     imageURL,
+		ThumbnailURL: thumbnailURL,
+		PreviewURL:   previewURL,
+		MediaType:    mediaType,
+		VideoURL:     videoURL,
+		CaptionFa:    caption,
+		Elements:     slideElements,
+		Duration:     duration,
+		HotelSlugs:   pq.StringArray{},
+	}
+	slide.ImageWebPURL, slide.ThumbnailWebPURL, slide.PreviewWebPURL = imageWebP, thumbnailWebP, previewWebP
+	if hotels, ok := formSlugs(c, "hotel_slugs"); ok {
+		slide.HotelSlugs = hotels
 	}
 	if bgColor != "" {
 		slide.BackgroundColor = &bgColor
@@ -258,8 +429,8 @@ func AddSlide(c *gin.Context) {
 	// Parse groupID to int
 	fmt.Sscanf(groupID, "%d", &slide.GroupID)
 
-	query := `INSERT INTO story_slides (group_id, image_url, caption_fa, elements, duration, background_color) 
-              VALUES (:group_id, :image_url, :caption_fa, :elements, :duration, :background_color) RETURNING id`
+	query := `INSERT INTO story_slides (group_id, image_url, thumbnail_url, preview_url, image_webp_url, thumbnail_webp_url, preview_webp_url, media_type, video_url, caption_fa, elements, duration, background_color, hotel_slugs) 
+              VALUES (:group_id, :image_url, :thumbnail_url, :preview_url, :image_webp_url, :thumbnail_webp_url, :preview_webp_url, :media_type, :video_url, :caption_fa, :elements, :duration, :background_color, :hotel_slugs) RETURNING id`
 
 	rows, err := database.DB.NamedQuery(query, slide)
 	if err != nil {
@@ -273,6 +444,7 @@ func AddSlide(c *gin.Context) {
 		rows.Scan(&slide.ID)
 	}
 
+	recordAudit(c, "create", auditSlide, slide.ID, nil, slideSnapshot(slide.ID))
 	c.JSON(http.StatusCreated, slide)
 }
 
@@ -281,33 +453,35 @@ func AddSlide(c *gin.Context) {
 func GetPublicStories(c *gin.Context) {
 	citySlug := c.Param("city_slug")
 
-	// Map English slugs to Persian for DB lookup if needed
-	cityMap := map[string]string{
-		"tehran":  "تهران",
-		"shiraz":  "شیراز",
-		"mashhad": "مشهد",
-		"isfahan": "اصفهان",
-		"kish":    "کیش",
-		"tabriz":  "تبریز",
-		"yazd":    "یزد",
-		"qeshm":   "قشم",
-		"qom":     "قم",
+	// The site links cities by English slug or Persian name; unknown and
+	// inactive cities simply have no stories
+	city, err := resolveCity(citySlug)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !city.Active) {
+		c.JSON(http.StatusOK, []models.StoryGroup{})
+		return
 	}
-
-	if persian, ok := cityMap[citySlug]; ok {
-		citySlug = persian
+	if err != nil {
+		log.Println("City lookup error:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
 	}
+	citySlug = city.Slug
 
-	var groups []models.StoryGroup
+	var groups []publishedGroup
 	fmt.Println("DEBUG: GetPublicStories for city:", citySlug)
+	// Customers see the published version; the rows hold the draft
 	query := `
 		SELECT 
-			id, city_slug, title_fa, caption, cover_url, short_code, active, view_count, open_count, created_at,
-			(SELECT COUNT(*) FROM story_slides WHERE group_id = story_groups.id) as story_count
-		FROM story_groups 
-		WHERE city_slug = $1 AND active = TRUE`
+			g.id, g.city_slug, g.short_code, g.active, g.view_count, g.open_count, g.created_at,
+			g.starts_at, g.ends_at, g.published_version, v.content,
+			COALESCE((SELECT array_agg(h.hotel_slug ORDER BY h.hotel_slug) FROM story_group_hotels h WHERE h.group_id = g.id), '{}') AS hotels
+		FROM story_groups g
+		JOIN story_group_versions v ON v.group_id = g.id AND v.version = g.published_version
+		WHERE g.city_slug = $1 AND g.active = TRUE
+			AND (g.starts_at IS NULL OR g.starts_at <= NOW())
+			AND (g.ends_at IS NULL OR g.ends_at > NOW())`
 
-	err := database.DB.Select(&groups, query, citySlug)
+	err = database.DB.Select(&groups, query, citySlug)
 	if err != nil {
 		fmt.Println("DEBUG: DB Error:", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -318,48 +492,51 @@ func GetPublicStories(c *gin.Context) {
 	fmt.Printf("DEBUG: Found %d groups for city: %s\n", len(groups), citySlug)
 
 	validGroups := []models.StoryGroup{}
+	now := time.Now()
 	for i := range groups {
-		slides := []models.StorySlide{} // Initialize as empty slice
-		err := database.DB.Select(&slides, "SELECT * FROM story_slides WHERE group_id = $1 ORDER BY sort_order ASC", groups[i].ID)
+		// Hotel-tagged slides only appear on their hotel pages
+		group, err := groups[i].published(now, func(s *models.StorySlide) bool {
+			return len(s.HotelSlugs) == 0
+		})
 		if err != nil {
-			fmt.Println("DEBUG: Error fetching slides:", err)
+			log.Printf("Group %d: reading published content: %v", groups[i].ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read stories"})
+			return
 		}
-		groups[i].Slides = slides
-
-		fmt.Printf("DEBUG: Group ID %d has %d slides\n", groups[i].ID, len(slides))
+		prepareGroup(&group, now)
 
-		if len(slides) > 0 {
-			validGroups = append(validGroups, groups[i])
+		if len(group.Slides) > 0 {
+			validGroups = append(validGroups, group)
 		}
 	}
 
-	// Increment view count for the group (async/fire-and-forget for MVP)
-	if len(validGroups) > 0 {
-		go func() {
-			for _, g := range validGroups {
-				database.DB.Exec("UPDATE story_groups SET view_count = view_count + 1 WHERE id = $1", g.ID)
-			}
-		}()
-	}
+	// Impressions are reported by the client through /events once the
+	// rings are actually shown
 
 	c.JSON(http.StatusOK, validGroups)
 }
 
+// IncrementSlideOpen is kept for older clients; new clients send a
+// slide_view through IngestEvents instead.
 func IncrementSlideOpen(c *gin.Context) {
-	slideID := c.Param("id")
-	// Async increment
-	go func() {
-		database.DB.Exec("UPDATE story_slides SET open_count = open_count + 1 WHERE id = $1", slideID)
-	}()
+	slideID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid slide id"})
+		return
+	}
+	events.Record(events.Event{Type: events.SlideView, SlideID: &slideID, OccurredAt: time.Now()})
 	c.Status(http.StatusOK)
 }
 
+// IncrementGroupOpen is kept for older clients; new clients send a
+// group_open through IngestEvents instead.
 func IncrementGroupOpen(c *gin.Context) {
-	groupID := c.Param("id")
-	// Async increment
-	go func() {
-		database.DB.Exec("UPDATE story_groups SET open_count = open_count + 1 WHERE id = $1", groupID)
-	}()
+	groupID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group id"})
+		return
+	}
+	events.Record(events.Event{Type: events.GroupOpen, GroupID: groupID, OccurredAt: time.Now()})
 	c.Status(http.StatusOK)
 }
 
@@ -367,6 +544,9 @@ func IncrementGroupOpen(c *gin.Context) {
 
 func ToggleGroupStatus(c *gin.Context) {
 	id := c.Param("id")
+	if !groupInScope(c, id) {
+		return
+	}
 	var input struct {
 		Active bool `json:"active"`
 	}
@@ -375,17 +555,22 @@ func ToggleGroupStatus(c *gin.Context) {
 		return
 	}
 
+	before := groupSnapshot(id)
 	_, err := database.DB.Exec("UPDATE story_groups SET active = $1 WHERE id = $2", input.Active, id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update status"})
 		return
 	}
 
+	recordAudit(c, "toggle_status", auditGroup, id, before, groupSnapshot(id))
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
 
 func DeleteGroup(c *gin.Context) {
 	id := c.Param("id")
+	if !groupInScope(c, id) {
+		return
+	}
 
 	// Check if group is active
 	var isActive bool
@@ -400,6 +585,8 @@ func DeleteGroup(c *gin.Context) {
 		return
 	}
 
+	before := groupSnapshot(id)
+
 	// Start a transaction to ensure both group and slides are deleted
 	tx, err := database.DB.Beginx()
 	if err != nil {
@@ -427,28 +614,37 @@ func DeleteGroup(c *gin.Context) {
 		return
 	}
 
+	recordAudit(c, "delete", auditGroup, id, before, nil)
 	c.Status(http.StatusOK)
 }
 
 func DeleteSlide(c *gin.Context) {
 	id := c.Param("id")
+	if !slideInScope(c, id) {
+		return
+	}
 
 	// Optional: Delete image file from disk (skipped for MVP brevity, but recommended)
 	// var imageUrl string
 	// database.DB.Get(&imageUrl, "SELECT image_url FROM story_slides WHERE id = $1", id)
 	// ... os.Remove ...
 
+	before := slideSnapshot(id)
 	_, err := database.DB.Exec("DELETE FROM story_slides WHERE id = $1", id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete slide"})
 		return
 	}
 
+	recordAudit(c, "delete", auditSlide, id, before, nil)
 	c.Status(http.StatusOK)
 }
 
 func UpdateSlide(c *gin.Context) {
 	id := c.Param("id")
+	if !slideInScope(c, id) {
+		return
+	}
 
 	// Check if slide exists and get current image
 	var currentSlide models.StorySlide
@@ -461,9 +657,25 @@ func UpdateSlide(c *gin.Context) {
 	caption := c.PostForm("caption_fa")
 	durationStr := c.PostForm("duration")
 	bgColor := c.PostForm("background_color")
-	elements := c.PostForm("elements")
 	sortOrderStr := c.PostForm("sort_order")
 
+	// Slides saved before validation keep their elements until they are
+	// posted again
+	slideElements := currentSlide.Elements
+	if posted := c.PostForm("elements"); posted != "" {
+		ctx, err := elementContext(currentSlide.GroupID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+			return
+		}
+		ctx.Stored = currentSlide.Elements
+		slideElements, err = elements.Normalize([]byte(posted), ctx)
+		if err != nil {
+			respondElementsError(c, err)
+			return
+		}
+	}
+
 	// Duration
 	duration := currentSlide.Duration
 	if durationStr != "" {
@@ -476,21 +688,46 @@ func UpdateSlide(c *gin.Context) {
 		fmt.Sscanf(sortOrderStr, "%d", &sortOrder)
 	}
 
-	// Image Upload
+	// Media Upload
+	mediaType, videoURL := currentSlide.MediaType, currentSlide.VideoURL
 	imageURL := currentSlide.ImageURL
-	file, err := c.FormFile("image")
-	if err == nil {
-		uploadDir := "./uploads"
-		filename := fmt.Sprintf("%d_%s", time.Now().UnixNano(), filepath.Base(file.Filename))
-		dst := filepath.Join(uploadDir, filename)
-		if err := c.SaveUploadedFile(file, dst); err == nil {
-			imageURL = "/uploads/" + filename
-			// Optional: delete old image file (best practice)
+	thumbnailURL, previewURL := currentSlide.ThumbnailURL, currentSlide.PreviewURL
+	imageWebP, thumbnailWebP, previewWebP := currentSlide.ImageWebPURL, currentSlide.ThumbnailWebPURL, currentSlide.PreviewWebPURL
+	if file, err := c.FormFile("video"); err == nil {
+		upload, err := saveVideo(c, file)
+		if err != nil {
+			respondUploadError(c, err)
+			return
+		}
+		mediaType = "video"
+		videoURL = &upload.VideoURL
+		duration = upload.Duration
+		imageURL, thumbnailURL, previewURL = renditionURLs(upload.Poster)
+		imageWebP, thumbnailWebP, previewWebP = webpURLs(upload.Poster)
+	} else if file, err := c.FormFile("image"); err == nil {
+		urls, err := saveImageRenditions(c, file, media.SlidePolicy, slideRenditions...)
+		if err != nil {
+			respondUploadError(c, err)
+			return
+		}
+		mediaType, videoURL = "image", nil
+		imageURL, thumbnailURL, previewURL = renditionURLs(urls)
+		imageWebP, thumbnailWebP, previewWebP = webpURLs(urls)
+		// Optional: delete old image file (best practice)
+	} else if mediaType == "video" {
+		// The slide stays a video, whose length is authoritative; the
+		// builder always posts a duration
+		duration = currentSlide.Duration
+		if file, err := c.FormFile("poster"); err == nil {
+			// Replace just the poster of an existing video slide
+			urls, err := saveImageRenditions(c, file, media.SlidePolicy, slideRenditions...)
+			if err != nil {
+				respondUploadError(c, err)
+				return
+			}
+			imageURL, thumbnailURL, previewURL = renditionURLs(urls)
+			imageWebP, thumbnailWebP, previewWebP = webpURLs(urls)
 		}
-	}
-
-	if elements == "" {
-		elements = string(currentSlide.Elements)
 	}
 
 	finalBgColor := bgColor
@@ -498,21 +735,76 @@ func UpdateSlide(c *gin.Context) {
 		finalBgColor = *currentSlide.BackgroundColor
 	}
 
+	hotelSlugs := currentSlide.HotelSlugs
+	if hotels, ok := formSlugs(c, "hotel_slugs"); ok {
+		hotelSlugs = hotels
+	}
+
 	query := `UPDATE story_slides SET 
 				image_url = $1, 
 				caption_fa = $2, 
 				elements = $3, 
 				duration = $4, 
 				background_color = $5,
-				sort_order = $6
-			  WHERE id = $7`
-
-	_, err = database.DB.Exec(query, imageURL, caption, elements, duration, finalBgColor, sortOrder, id)
+				sort_order = $6,
+				thumbnail_url = $7,
+				preview_url = $8,
+				media_type = $9,
+				video_url = $10,
+				hotel_slugs = $11,
+				image_webp_url = $12,
+				thumbnail_webp_url = $13,
+				preview_webp_url = $14
+			  WHERE id = $15`
+
+	before := slideSnapshot(id)
+	_, err = database.DB.Exec(query, imageURL, caption, string(slideElements), duration, finalBgColor, sortOrder, thumbnailURL, previewURL, mediaType, videoURL, hotelSlugs, imageWebP, thumbnailWebP, previewWebP, id)
 	if err != nil {
 		fmt.Println("DB Update Error:", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update slide"})
 		return
 	}
 
+	recordAudit(c, "update", auditSlide, id, before, slideSnapshot(id))
 	c.Status(http.StatusOK)
 }
+
+// renditionURLs splits stored slide renditions into the image_url,
+// thumbnail_url and preview_url columns. A nil map clears them.
+func renditionURLs(urls map[string]string) (string, *string, *string) {
+	if urls == nil {
+		return "", nil, nil
+	}
+	thumb, preview := urls["thumb"], urls["preview"]
+	return urls["story"], &thumb, &preview
+}
+
+// webpURLs picks the WebP copies of stored slide renditions for the
+// *_webp_url columns. They are nil when none were made.
+func webpURLs(urls map[string]string) (image, thumb, preview *string) {
+	if urls["story.webp"] == "" {
+		return nil, nil, nil
+	}
+	i, t, p := urls["story.webp"], urls["thumb.webp"], urls["preview.webp"]
+	return &i, &t, &p
+}
+
+// elementContext is what a group's slide elements are checked against
+// now: countdowns may follow the group's end time.
+func elementContext(groupID any) (elements.Context, error) {
+	ctx := elements.Context{Now: time.Now()}
+	err := database.DB.Get(&ctx.GroupEndsAt, "SELECT ends_at FROM story_groups WHERE id = $1", groupID)
+	return ctx, err
+}
+
+// respondElementsError answers an invalid elements payload with 400 and
+// the problem with each field.
+func respondElementsError(c *gin.Context, err error) {
+	var verr *elements.ValidationError
+	if errors.As(err, &verr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": verr.Error(), "code": "invalid_elements", "fields": verr.Fields})
+		return
+	}
+	log.Printf("Elements Error: %v", err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read slide elements"})
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+
+	"hotel-story-panel/backend/internal/database"
+	"hotel-story-panel/backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetUsers(c *gin.Context) {
+	users := []models.User{}
+	err := database.DB.Select(&users, "SELECT id, email, role, created_at, totp_enabled_at IS NOT NULL AS mfa_enabled FROM users ORDER BY created_at ASC")
+	if err != nil {
+		log.Printf("GetUsers DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+	c.JSON(http.StatusOK, users)
+}
+
+// UpdateUserRole changes a user's role. The role travels in the access
+// token, so the change applies from their next token refresh. The last owner
+// cannot be demoted, so the panel always has someone who can manage users.
+func UpdateUserRole(c *gin.Context) {
+	var input struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !models.ValidRole(input.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be owner, editor, reviewer, analyst or viewer"})
+		return
+	}
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the owners so two concurrent demotions can't both pass the check
+	var owners []int
+	if err := tx.Select(&owners, "SELECT id FROM users WHERE role = $1 FOR UPDATE", models.RoleOwner); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var user models.User
+	if err := tx.Get(&user, "SELECT id, email, role, created_at FROM users WHERE id = $1", c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if user.Role == models.RoleOwner && input.Role != models.RoleOwner && len(owners) == 1 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot demote the last owner"})
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE users SET role = $1 WHERE id = $2", input.Role, user.ID); err != nil {
+		log.Printf("UpdateUserRole DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+
+	recordAudit(c, "update_role", auditUser, user.ID, gin.H{"role": user.Role}, gin.H{"role": input.Role})
+
+	user.Role = input.Role
+	c.JSON(http.StatusOK, user)
+}
+
+func GetUserScope(c *gin.Context) {
+	var userID int
+	if err := database.DB.Get(&userID, "SELECT id FROM users WHERE id = $1", c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	scope, err := loadScope(userID)
+	if err != nil {
+		log.Printf("GetUserScope DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch permissions"})
+		return
+	}
+	c.JSON(http.StatusOK, scope)
+}
+
+// SetUserScope replaces what content a user may access: everything with
+// "all", otherwise the listed cities and hotels, so empty lists leave them
+// none. Owners are never limited, whatever is stored for them.
+func SetUserScope(c *gin.Context) {
+	var input models.UserScope
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var userID int
+	if err := database.DB.Get(&userID, "SELECT id FROM users WHERE id = $1", c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if input.All && (len(input.Cities) > 0 || len(input.Hotels) > 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Leave cities and hotels empty when granting all content"})
+		return
+	}
+	cities := []string{}
+	for _, name := range input.Cities {
+		city, err := resolveCity(name)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown city %q", name), "code": "unknown_city"})
+			return
+		}
+		if !slices.Contains(cities, city.Slug) {
+			cities = append(cities, city.Slug)
+		}
+	}
+	hotels := normalizeSlugs(input.Hotels)
+
+	before, err := loadScope(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update permissions"})
+		return
+	}
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE users SET unrestricted = $1 WHERE id = $2", input.All, userID); err != nil {
+		log.Printf("SetUserScope DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update permissions"})
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM user_scopes WHERE user_id = $1", userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update permissions"})
+		return
+	}
+	for _, city := range cities {
+		if _, err := tx.Exec("INSERT INTO user_scopes (user_id, city_slug) VALUES ($1, $2)", userID, city); err != nil {
+			log.Printf("SetUserScope DB Error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update permissions"})
+			return
+		}
+	}
+	for _, hotel := range hotels {
+		if _, err := tx.Exec("INSERT INTO user_scopes (user_id, hotel_slug) VALUES ($1, $2)", userID, hotel); err != nil {
+			log.Printf("SetUserScope DB Error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update permissions"})
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update permissions"})
+		return
+	}
+
+	after := models.UserScope{All: input.All, Cities: cities, Hotels: hotels}
+	recordAudit(c, "update_scope", auditUser, userID, before, after)
+	c.JSON(http.StatusOK, after)
+}
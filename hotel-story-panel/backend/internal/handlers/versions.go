@@ -0,0 +1,398 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"hotel-story-panel/backend/internal/database"
+	"hotel-story-panel/backend/internal/elements"
+	"hotel-story-panel/backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// draftContentSQL builds the draft content of group g from the editable
+// tables, in the shape published versions store it. Counters are left out
+// so that views don't count as changes. created_at is a TIMESTAMP read as
+// UTC elsewhere, so it is given that offset here for the JSON to parse.
+// WebP URLs are left out when a slide has none, so content published
+// before they existed still matches its draft. The 0017 migration
+// backfills version 1 with the same expression, less the WebP URLs.
+const draftContentSQL = `jsonb_build_object(
+	'title_fa', g.title_fa, 'caption', g.caption, 'cover_url', g.cover_url,
+	'slides', COALESCE((
+		SELECT jsonb_agg(jsonb_build_object(
+			'id', s.id, 'group_id', s.group_id, 'image_url', s.image_url,
+			'thumbnail_url', s.thumbnail_url, 'preview_url', s.preview_url,
+			'media_type', s.media_type, 'video_url', s.video_url, 'caption_fa', s.caption_fa,
+			'elements', s.elements, 'sort_order', s.sort_order, 'duration', s.duration,
+			'background_color', s.background_color, 'hotel_slugs', to_jsonb(s.hotel_slugs),
+			'created_at', s.created_at AT TIME ZONE 'UTC') || jsonb_strip_nulls(jsonb_build_object(
+			'image_webp_url', s.image_webp_url, 'thumbnail_webp_url', s.thumbnail_webp_url,
+			'preview_webp_url', s.preview_webp_url)) ORDER BY s.sort_order, s.id)
+		FROM story_slides s WHERE s.group_id = g.id), '[]'::jsonb))`
+
+// draftChangedSQL is true when the draft of group g differs from what
+// customers see, including when it was never published.
+const draftChangedSQL = `(g.published_version IS NULL OR (
+	SELECT v.content FROM story_group_versions v
+	WHERE v.group_id = g.id AND v.version = g.published_version) IS DISTINCT FROM ` + draftContentSQL + `)`
+
+// Reasons publishDraft refuses to publish.
+var (
+	errNoChanges  = errors.New("no unpublished changes")
+	errEmptyDraft = errors.New("add at least one slide before publishing")
+)
+
+// publishedGroup is a group row with the content of its published version.
+type publishedGroup struct {
+	models.StoryGroup
+	Content json.RawMessage `db:"content"`
+}
+
+// published returns the group as customers see it at now: the published
+// title, caption and cover, and the published slides that keep accepts,
+// with their elements as viewers get them. Slides hidden by a passed
+// countdown are left out.
+func (p *publishedGroup) published(now time.Time, keep func(*models.StorySlide) bool) (models.StoryGroup, error) {
+	g := p.StoryGroup
+	g.Slides = []models.StorySlide{}
+
+	var content models.GroupContent
+	if err := json.Unmarshal(p.Content, &content); err != nil {
+		return g, err
+	}
+	g.TitleFa, g.Caption, g.CoverURL = content.TitleFa, content.Caption, content.CoverURL
+	ctx := elements.Context{Now: now, GroupEndsAt: g.EndsAt}
+	for i := range content.Slides {
+		slide := &content.Slides[i]
+		if !keep(slide) {
+			continue
+		}
+		var hidden bool
+		if slide.Elements, hidden = elements.Public(slide.Elements, ctx); !hidden {
+			g.Slides = append(g.Slides, *slide)
+		}
+	}
+	g.StoryCount = int64(len(g.Slides))
+	return g, nil
+}
+
+// lockGroup locks the group row for the rest of tx, so that publishes and
+// rollbacks of one group number their versions in turn, and returns its
+// published version.
+func lockGroup(tx *sqlx.Tx, groupID any) (*int, error) {
+	var version *int
+	err := tx.Get(&version, "SELECT published_version FROM story_groups WHERE id = $1 FOR UPDATE", groupID)
+	return version, err
+}
+
+// publishDraft snapshots the draft of a locked group as its next version
+// and makes that the one customers see. Callers check the review first.
+func publishDraft(tx *sqlx.Tx, groupID any, userID int) (int, error) {
+	var draft struct {
+		Changed bool `db:"changed"`
+		Slides  int  `db:"slides"`
+	}
+	err := tx.Get(&draft, `
+		SELECT `+draftChangedSQL+` AS changed,
+			(SELECT COUNT(*) FROM story_slides WHERE group_id = g.id) AS slides
+		FROM story_groups g WHERE g.id = $1`, groupID)
+	if err != nil {
+		return 0, err
+	}
+	if !draft.Changed {
+		return 0, errNoChanges
+	}
+	if draft.Slides == 0 {
+		return 0, errEmptyDraft
+	}
+
+	var version int
+	err = tx.Get(&version, `
+		INSERT INTO story_group_versions (group_id, version, content, published_by)
+		SELECT g.id, COALESCE((SELECT MAX(version) FROM story_group_versions WHERE group_id = g.id), 0) + 1,
+			`+draftContentSQL+`, NULLIF($2, 0)
+		FROM story_groups g WHERE g.id = $1
+		RETURNING version`, groupID, userID)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(`
+		UPDATE story_groups SET published_version = $1, review_state = $2, approved_content = NULL
+		WHERE id = $3`, version, models.ReviewPublished, groupID)
+	return version, err
+}
+
+// restoreDraft resets the draft of a group to published content. Slides
+// keep their IDs, so ones deleted since come back with their analytics.
+func restoreDraft(tx *sqlx.Tx, groupID int, content *models.GroupContent) error {
+	_, err := tx.Exec("UPDATE story_groups SET title_fa = $1, caption = $2, cover_url = $3 WHERE id = $4",
+		content.TitleFa, content.Caption, content.CoverURL, groupID)
+	if err != nil {
+		return err
+	}
+
+	ids := pq.Int64Array{}
+	for _, s := range content.Slides {
+		ids = append(ids, int64(s.ID))
+	}
+	_, err = tx.Exec("DELETE FROM story_slides WHERE group_id = $1 AND NOT (id = ANY($2))", groupID, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range content.Slides {
+		if s.HotelSlugs == nil {
+			s.HotelSlugs = pq.StringArray{}
+		}
+		if s.Elements == nil {
+			s.Elements = json.RawMessage("[]")
+		}
+		_, err := tx.Exec(`
+			INSERT INTO story_slides (id, group_id, image_url, thumbnail_url, preview_url, media_type, video_url,
+				caption_fa, elements, sort_order, duration, background_color, hotel_slugs, created_at,
+				image_webp_url, thumbnail_webp_url, preview_webp_url)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+			ON CONFLICT (id) DO UPDATE SET
+				image_url = EXCLUDED.image_url, thumbnail_url = EXCLUDED.thumbnail_url,
+				preview_url = EXCLUDED.preview_url, image_webp_url = EXCLUDED.image_webp_url,
+				thumbnail_webp_url = EXCLUDED.thumbnail_webp_url, preview_webp_url = EXCLUDED.preview_webp_url,
+				media_type = EXCLUDED.media_type,
+				video_url = EXCLUDED.video_url, caption_fa = EXCLUDED.caption_fa,
+				elements = EXCLUDED.elements, sort_order = EXCLUDED.sort_order,
+				duration = EXCLUDED.duration, background_color = EXCLUDED.background_color,
+				hotel_slugs = EXCLUDED.hotel_slugs
+			WHERE story_slides.group_id = EXCLUDED.group_id`,
+			s.ID, groupID, s.ImageURL, s.ThumbnailURL, s.PreviewURL, s.MediaType, s.VideoURL,
+			s.CaptionFa, string(s.Elements), s.SortOrder, s.Duration, s.BackgroundColor, s.HotelSlugs, s.CreatedAt,
+			s.ImageWebPURL, s.ThumbnailWebPURL, s.PreviewWebPURL)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PublishGroup makes the group's approved draft what customers see, as a
+// new version. Nothing changes publicly until it is called.
+func PublishGroup(c *gin.Context) {
+	id := c.Param("id")
+	if !groupInScope(c, id) {
+		return
+	}
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	previous, err := lockGroup(tx, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	// Only an approved draft goes live, and only as it was approved
+	var review struct {
+		State     string `db:"review_state"`
+		Unchanged bool   `db:"unchanged"`
+	}
+	err = tx.Get(&review, `
+		SELECT g.review_state, g.approved_content IS NOT DISTINCT FROM `+draftContentSQL+` AS unchanged
+		FROM story_groups g WHERE g.id = $1`, id)
+	if err != nil {
+		log.Printf("PublishGroup DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish group"})
+		return
+	}
+	if review.State != models.ReviewApproved {
+		c.JSON(http.StatusConflict, gin.H{"error": "The draft must be approved before it is published", "code": "not_approved"})
+		return
+	}
+	if !review.Unchanged {
+		c.JSON(http.StatusConflict, gin.H{"error": "The draft has changed since it was approved; submit it for review again", "code": "changed_since_approval"})
+		return
+	}
+
+	version, err := publishDraft(tx, id, callerID(c))
+	if errors.Is(err, errNoChanges) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Nothing to publish: the draft matches the published version", "code": "no_changes"})
+		return
+	}
+	if errors.Is(err, errEmptyDraft) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Add at least one slide before publishing", "code": "empty_draft"})
+		return
+	}
+	if err != nil {
+		log.Printf("PublishGroup DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish group"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	recordAudit(c, "publish", auditGroup, id, gin.H{"published_version": previous}, gin.H{"published_version": version})
+	c.JSON(http.StatusOK, gin.H{"published_version": version})
+}
+
+// GetGroupVersions lists a group's published versions, newest first.
+func GetGroupVersions(c *gin.Context) {
+	id := c.Param("id")
+	if !groupInScope(c, id) {
+		return
+	}
+
+	versions := []models.GroupVersion{}
+	err := database.DB.Select(&versions, `
+		SELECT v.id, v.group_id, v.version, v.published_by, u.email AS published_by_email, v.published_at,
+			v.restored_from, jsonb_array_length(v.content->'slides') AS slide_count,
+			COALESCE(v.version = g.published_version, FALSE) AS current
+		FROM story_group_versions v
+		JOIN story_groups g ON g.id = v.group_id
+		LEFT JOIN users u ON u.id = v.published_by
+		WHERE v.group_id = $1
+		ORDER BY v.version DESC`, id)
+	if err != nil {
+		log.Printf("GetGroupVersions DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch versions"})
+		return
+	}
+	c.JSON(http.StatusOK, versions)
+}
+
+// GetGroupVersion returns one published version with its content.
+func GetGroupVersion(c *gin.Context) {
+	id := c.Param("id")
+	if !groupInScope(c, id) {
+		return
+	}
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version"})
+		return
+	}
+
+	var row struct {
+		models.GroupVersion
+		Content json.RawMessage `db:"content"`
+	}
+	err = database.DB.Get(&row, `
+		SELECT v.id, v.group_id, v.version, v.published_by, u.email AS published_by_email, v.published_at,
+			v.restored_from, jsonb_array_length(v.content->'slides') AS slide_count,
+			COALESCE(v.version = g.published_version, FALSE) AS current, v.content
+		FROM story_group_versions v
+		JOIN story_groups g ON g.id = v.group_id
+		LEFT JOIN users u ON u.id = v.published_by
+		WHERE v.group_id = $1 AND v.version = $2`, id, version)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("GetGroupVersion DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch version"})
+		return
+	}
+
+	result := row.GroupVersion
+	result.Content = &models.GroupContent{}
+	if err := json.Unmarshal(row.Content, result.Content); err != nil {
+		log.Printf("GetGroupVersion content Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read version"})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// RollbackGroup republishes an earlier version as a new one and resets the
+// draft to it, so the next publish starts from what customers see.
+func RollbackGroup(c *gin.Context) {
+	id := c.Param("id")
+	if !groupInScope(c, id) {
+		return
+	}
+	groupID, _ := strconv.Atoi(id)
+	target, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version"})
+		return
+	}
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	previous, err := lockGroup(tx, groupID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	var raw json.RawMessage
+	err = tx.Get(&raw, "SELECT content FROM story_group_versions WHERE group_id = $1 AND version = $2", groupID, target)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("RollbackGroup DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch version"})
+		return
+	}
+	var content models.GroupContent
+	if err := json.Unmarshal(raw, &content); err != nil {
+		log.Printf("RollbackGroup content Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read version"})
+		return
+	}
+
+	if err := restoreDraft(tx, groupID, &content); err != nil {
+		log.Printf("RollbackGroup restore Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore draft"})
+		return
+	}
+
+	// The old content is republished as is rather than rebuilt from the
+	// restored draft
+	var version int
+	err = tx.Get(&version, `
+		INSERT INTO story_group_versions (group_id, version, content, published_by, restored_from)
+		SELECT $1, MAX(version) + 1, $2::jsonb, NULLIF($3, 0), $4::int FROM story_group_versions WHERE group_id = $1
+		RETURNING version`, groupID, string(raw), callerID(c), target)
+	if err == nil {
+		// The restored content was approved when first published; any
+		// review of the replaced draft is moot
+		_, err = tx.Exec(`
+			UPDATE story_groups SET published_version = $1, review_state = $2, approved_content = NULL
+			WHERE id = $3`, version, models.ReviewPublished, groupID)
+	}
+	if err != nil {
+		log.Printf("RollbackGroup DB Error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish version"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	recordAudit(c, "rollback", auditGroup, id,
+		gin.H{"published_version": previous},
+		gin.H{"published_version": version, "restored_from": target})
+	c.JSON(http.StatusOK, gin.H{"published_version": version, "restored_from": target})
+}
@@ -0,0 +1,35 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// File writes each message as an .eml file in Dir, so tests and local
+// setups can inspect exactly what would have been sent.
+type File struct {
+	Dir  string
+	From string
+}
+
+func (f *File) Send(_ context.Context, m Message) error {
+	if err := os.MkdirAll(f.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d_%s.eml", time.Now().UnixNano(), sanitize(m.To))
+	return os.WriteFile(filepath.Join(f.Dir, name), encode(f.From, m), 0o644)
+}
+
+// sanitize keeps an address usable as part of a file name.
+func sanitize(s string) string {
+	out := []rune(s)
+	for i, r := range out {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '@' || r == '.' || r == '-') {
+			out[i] = '_'
+		}
+	}
+	return string(out)
+}
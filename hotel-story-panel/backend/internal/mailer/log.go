@@ -0,0 +1,14 @@
+package mailer
+
+import (
+	"context"
+	"log"
+)
+
+// Log prints messages instead of sending them, for local development.
+type Log struct{}
+
+func (l *Log) Send(_ context.Context, m Message) error {
+	log.Printf("Mailer: to=%s subject=%q\n%s", m.To, m.Subject, m.Text)
+	return nil
+}
@@ -0,0 +1,74 @@
+package mailer
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+)
+
+// Message is an email ready to send. HTML is optional.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer delivers messages.
+type Mailer interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// Default is the mailer used by the auth handlers, selected by InitMailer.
+var Default Mailer
+
+// InitMailer selects the backend from MAIL_BACKEND: "log" (the default)
+// prints messages, "file" writes them as .eml files to MAIL_DIR, and "smtp"
+// sends them through SMTP_HOST.
+func InitMailer() {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+
+	switch backend := os.Getenv("MAIL_BACKEND"); backend {
+	case "", "log":
+		Default = &Log{}
+		log.Println("Mailer: logging messages")
+
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "./mail"
+		}
+		Default = &File{Dir: dir, From: from}
+		log.Println("Mailer: writing messages to", dir)
+
+	case "smtp":
+		port, _ := strconv.Atoi(os.Getenv("SMTP_PORT"))
+		if port == 0 {
+			port = 587
+		}
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			log.Fatalln("MAIL_BACKEND=smtp requires SMTP_HOST")
+		}
+		Default = &SMTP{
+			Host:     host,
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}
+		log.Println("Mailer: SMTP via", host)
+
+	default:
+		log.Fatalln("Unknown MAIL_BACKEND:", backend)
+	}
+}
+
+// Send delivers m through Default.
+func Send(ctx context.Context, m Message) error {
+	return Default.Send(ctx, m)
+}
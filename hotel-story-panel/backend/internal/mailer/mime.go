@@ -0,0 +1,55 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"time"
+)
+
+// encode renders m as an RFC 5322 message with UTF-8 headers and, when HTML
+// is set, a multipart/alternative body.
+func encode(from string, m Message) []byte {
+	var buf bytes.Buffer
+	header := func(k, v string) { fmt.Fprintf(&buf, "%s: %s\r\n", k, v) }
+
+	header("From", (&mail.Address{Address: from}).String())
+	header("To", (&mail.Address{Address: m.To}).String())
+	header("Subject", mime.BEncoding.Encode("UTF-8", m.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+
+	if m.HTML == "" {
+		header("Content-Type", "text/plain; charset=UTF-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		writeQP(&buf, m.Text)
+		return buf.Bytes()
+	}
+
+	b := make([]byte, 12)
+	rand.Read(b)
+	boundary := "=_" + hex.EncodeToString(b)
+	header("Content-Type", fmt.Sprintf("multipart/alternative; boundary=%q", boundary))
+	buf.WriteString("\r\n")
+
+	for _, part := range []struct{ typ, body string }{{"text/plain", m.Text}, {"text/html", m.HTML}} {
+		fmt.Fprintf(&buf, "--%s\r\n", boundary)
+		fmt.Fprintf(&buf, "Content-Type: %s; charset=UTF-8\r\n", part.typ)
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		writeQP(&buf, part.body)
+		buf.WriteString("\r\n")
+	}
+	fmt.Fprintf(&buf, "--%s--\r\n", boundary)
+	return buf.Bytes()
+}
+
+func writeQP(buf *bytes.Buffer, s string) {
+	w := quotedprintable.NewWriter(buf)
+	w.Write([]byte(s))
+	w.Close()
+}
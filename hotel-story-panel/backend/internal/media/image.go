@@ -0,0 +1,157 @@
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+
+	// Registered decoders for uploaded images
+	_ "image/gif"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Rendition describes one stored size of an uploaded image.
+type Rendition struct {
+	Name   string
+	Width  int
+	Height int
+	// Crop fills the exact Width x Height box (center crop); otherwise the
+	// image is scaled to fit inside it, keeping its aspect ratio.
+	Crop bool
+}
+
+var (
+	// StoryRendition is the full-screen 9:16 slide background.
+	StoryRendition = Rendition{Name: "story", Width: 1080, Height: 1920, Crop: true}
+	// ThumbnailRendition is the 1:1 crop used in story rings and admin lists.
+	ThumbnailRendition = Rendition{Name: "thumb", Width: 320, Height: 320, Crop: true}
+	// PreviewRendition is a tiny 9:16 placeholder shown while the story loads.
+	PreviewRendition = Rendition{Name: "preview", Width: 90, Height: 160, Crop: true}
+	// DisplayRendition keeps the original aspect ratio, e.g. for group covers.
+	DisplayRendition = Rendition{Name: "display", Width: 1080, Height: 1080}
+)
+
+const jpegQuality = 82
+
+// DecodeImage decodes an uploaded image and rotates it upright according to
+// its EXIF orientation. Re-encoding the result drops all EXIF metadata.
+func DecodeImage(data []byte) (image.Image, error) {
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %w", err)
+	}
+	if format == "jpeg" {
+		img = orient(img, jpegOrientation(data))
+	}
+	return img, nil
+}
+
+// Scale resizes img to the rendition's box. Images are never upscaled
+// beyond their source resolution.
+func Scale(img image.Image, r Rendition) image.Image {
+	src := img.Bounds()
+	var crop image.Rectangle
+	var w, h int
+
+	if r.Crop {
+		crop = coverCrop(src, r.Width, r.Height)
+		w, h = r.Width, r.Height
+		if crop.Dx() < w {
+			w, h = crop.Dx(), crop.Dy()
+		}
+	} else {
+		crop = src
+		w, h = fitInside(src.Dx(), src.Dy(), r.Width, r.Height)
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, crop, draw.Src, nil)
+	return dst
+}
+
+// EncodeJPEG encodes a rendered image as JPEG, the format every rendition
+// is stored in.
+func EncodeJPEG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// coverCrop returns the largest centered rectangle of src with aspect w:h.
+func coverCrop(src image.Rectangle, w, h int) image.Rectangle {
+	sw, sh := src.Dx(), src.Dy()
+	cw, ch := sw, sw*h/w
+	if ch > sh {
+		cw, ch = sh*w/h, sh
+	}
+	x := src.Min.X + (sw-cw)/2
+	y := src.Min.Y + (sh-ch)/2
+	return image.Rect(x, y, x+cw, y+ch)
+}
+
+// fitInside scales w x h down (never up) to fit within maxW x maxH.
+func fitInside(w, h, maxW, maxH int) (int, int) {
+	if w <= maxW && h <= maxH {
+		return w, h
+	}
+	if w*maxH > h*maxW {
+		return maxW, h * maxW / w
+	}
+	return w * maxH / h, maxH
+}
+
+// orient applies an EXIF orientation (1-8) so the image displays upright.
+func orient(img image.Image, o int) image.Image {
+	if o <= 1 || o > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	src := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch o {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			si := src.PixOffset(sx, sy)
+			di := dst.PixOffset(x, y)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,139 @@
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"net/http"
+)
+
+// Error codes returned to the admin UI, which translates them for display.
+const (
+	CodeFileMissing       = "file_missing"
+	CodeFileTooLarge      = "file_too_large"
+	CodeUnsupportedType   = "unsupported_type"
+	CodeInvalidImage      = "invalid_image"
+	CodeImageTooSmall     = "image_too_small"
+	CodeImageTooLarge     = "image_too_large"
+	CodeAspectRatio       = "aspect_ratio_out_of_range"
+	CodeDecompressionBomb = "decompression_bomb"
+	CodeInvalidVideo      = "invalid_video"
+	CodeVideoTooLong      = "video_too_long"
+)
+
+// ValidationError is a rejected upload with a stable machine-readable code.
+type ValidationError struct {
+	Code    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// HTTPStatus maps the error code to the response status for the handlers.
+func (e *ValidationError) HTTPStatus() int {
+	switch e.Code {
+	case CodeFileTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case CodeUnsupportedType:
+		return http.StatusUnsupportedMediaType
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func invalid(code, format string, args ...any) *ValidationError {
+	return &ValidationError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// ImagePolicy bounds what an upload path accepts.
+type ImagePolicy struct {
+	MaxBytes  int64
+	MinWidth  int
+	MinHeight int
+	MaxWidth  int
+	MaxHeight int
+	// MaxPixels caps width*height so a tiny file can't expand into a huge
+	// bitmap when decoded.
+	MaxPixels int
+	// MinAspect and MaxAspect bound width/height.
+	MinAspect float64
+	MaxAspect float64
+}
+
+var (
+	// CoverPolicy applies to UploadImage (group covers).
+	CoverPolicy = ImagePolicy{
+		MaxBytes:  2 * 1024 * 1024,
+		MinWidth:  200,
+		MinHeight: 200,
+		MaxWidth:  8000,
+		MaxHeight: 8000,
+		MaxPixels: 40_000_000,
+		MinAspect: 0.25,
+		MaxAspect: 4,
+	}
+	// SlidePolicy applies to slide images, which the builder already crops to 9:16.
+	SlidePolicy = ImagePolicy{
+		MaxBytes:  5 * 1024 * 1024,
+		MinWidth:  320,
+		MinHeight: 320,
+		MaxWidth:  8000,
+		MaxHeight: 8000,
+		MaxPixels: 40_000_000,
+		MinAspect: 0.4,
+		MaxAspect: 1,
+	}
+)
+
+// allowedImageTypes maps sniffed MIME types to the decoder format name.
+var allowedImageTypes = map[string]string{
+	"image/jpeg": "jpeg",
+	"image/png":  "png",
+	"image/webp": "webp",
+}
+
+// ValidateImage checks the real content type and pixel dimensions of data
+// without decoding the full bitmap, and returns the detected MIME type.
+func ValidateImage(data []byte, p ImagePolicy) (string, error) {
+	if int64(len(data)) > p.MaxBytes {
+		return "", invalid(CodeFileTooLarge, "File size exceeds %dMB limit", p.MaxBytes/(1024*1024))
+	}
+
+	mimeType := http.DetectContentType(data)
+	format, ok := allowedImageTypes[mimeType]
+	if !ok {
+		return "", invalid(CodeUnsupportedType, "Unsupported file type %s (allowed: JPEG, PNG, WebP)", mimeType)
+	}
+
+	cfg, decoded, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || decoded != format {
+		return "", invalid(CodeInvalidImage, "File is not a valid image")
+	}
+
+	w, h := cfg.Width, cfg.Height
+	if w <= 0 || h <= 0 {
+		return "", invalid(CodeInvalidImage, "File is not a valid image")
+	}
+	// Judge the image as it will be displayed, after EXIF rotation
+	if format == "jpeg" && jpegOrientation(data) >= 5 {
+		w, h = h, w
+	}
+	if w*h > p.MaxPixels {
+		return "", invalid(CodeDecompressionBomb, "Image is %dx%d pixels, above the %d megapixel limit", w, h, p.MaxPixels/1_000_000)
+	}
+	if w > p.MaxWidth || h > p.MaxHeight {
+		return "", invalid(CodeImageTooLarge, "Image is %dx%d, maximum is %dx%d", w, h, p.MaxWidth, p.MaxHeight)
+	}
+	if w < p.MinWidth || h < p.MinHeight {
+		return "", invalid(CodeImageTooSmall, "Image is %dx%d, minimum is %dx%d", w, h, p.MinWidth, p.MinHeight)
+	}
+
+	aspect := float64(w) / float64(h)
+	if aspect < p.MinAspect || aspect > p.MaxAspect {
+		return "", invalid(CodeAspectRatio, "Image aspect ratio %.2f is outside %.2f-%.2f", aspect, p.MinAspect, p.MaxAspect)
+	}
+
+	return mimeType, nil
+}
@@ -0,0 +1,299 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os/exec"
+	"time"
+)
+
+// VideoPolicy bounds video slide uploads.
+type VideoPolicy struct {
+	MaxBytes    int64
+	MaxDuration time.Duration
+}
+
+// SlideVideoPolicy applies to video slides on AddSlide / UpdateSlide.
+var SlideVideoPolicy = VideoPolicy{
+	MaxBytes:    50 * 1024 * 1024,
+	MaxDuration: 60 * time.Second,
+}
+
+// allowedVideoTypes maps sniffed MIME types to the container we can probe.
+var allowedVideoTypes = map[string]string{
+	"video/mp4":  "mp4",
+	"video/webm": "webm",
+}
+
+// VideoInfo is what we read from the container header.
+type VideoInfo struct {
+	MIMEType string
+	Duration time.Duration
+}
+
+// ProbeVideo sniffs the container type and reads the video duration from its
+// header without decoding any frames.
+func ProbeVideo(r io.ReaderAt, size int64, p VideoPolicy) (VideoInfo, error) {
+	if size > p.MaxBytes {
+		return VideoInfo{}, invalid(CodeFileTooLarge, "File size exceeds %dMB limit", p.MaxBytes/(1024*1024))
+	}
+
+	head := make([]byte, 512)
+	n, _ := r.ReadAt(head, 0)
+	mimeType := http.DetectContentType(head[:n])
+	container, ok := allowedVideoTypes[mimeType]
+	if !ok {
+		return VideoInfo{}, invalid(CodeUnsupportedType, "Unsupported file type %s (allowed: MP4, WebM)", mimeType)
+	}
+
+	var d time.Duration
+	var err error
+	if container == "mp4" {
+		d, err = mp4Duration(r, size)
+	} else {
+		d, err = webmDuration(r, size)
+	}
+	if err != nil || d <= 0 {
+		return VideoInfo{}, invalid(CodeInvalidVideo, "Could not read video duration")
+	}
+	if d > p.MaxDuration {
+		return VideoInfo{}, invalid(CodeVideoTooLong, "Video is %.0fs long, maximum is %.0fs", d.Seconds(), p.MaxDuration.Seconds())
+	}
+
+	return VideoInfo{MIMEType: mimeType, Duration: d}, nil
+}
+
+// --- MP4 (ISO BMFF) ---
+
+// mp4Box finds the first box of the given type within [start, end).
+func mp4Box(r io.ReaderAt, start, end int64, boxType string) (int64, int64, error) {
+	hdr := make([]byte, 16)
+	for pos := start; pos+8 <= end; {
+		if _, err := r.ReadAt(hdr[:8], pos); err != nil {
+			return 0, 0, err
+		}
+		size := int64(binary.BigEndian.Uint32(hdr))
+		typ := string(hdr[4:8])
+		headerLen := int64(8)
+
+		switch size {
+		case 0:
+			size = end - pos
+		case 1:
+			if _, err := r.ReadAt(hdr[8:16], pos+8); err != nil {
+				return 0, 0, err
+			}
+			size = int64(binary.BigEndian.Uint64(hdr[8:16]))
+			headerLen = 16
+		}
+		if size < headerLen || pos+size > end {
+			return 0, 0, errors.New("mp4: malformed box")
+		}
+
+		if typ == boxType {
+			return pos + headerLen, pos + size, nil
+		}
+		pos += size
+	}
+	return 0, 0, fmt.Errorf("mp4: %s box not found", boxType)
+}
+
+func mp4Duration(r io.ReaderAt, size int64) (time.Duration, error) {
+	moovStart, moovEnd, err := mp4Box(r, 0, size, "moov")
+	if err != nil {
+		return 0, err
+	}
+	start, end, err := mp4Box(r, moovStart, moovEnd, "mvhd")
+	if err != nil {
+		return 0, err
+	}
+
+	if end-start < 20 {
+		return 0, errors.New("mp4: mvhd box too short")
+	}
+	body := make([]byte, min(end-start, 32))
+	if _, err := r.ReadAt(body, start); err != nil {
+		return 0, err
+	}
+
+	var timescale uint32
+	var duration uint64
+	switch {
+	case body[0] == 0:
+		timescale = binary.BigEndian.Uint32(body[12:])
+		duration = uint64(binary.BigEndian.Uint32(body[16:]))
+	case body[0] == 1 && len(body) >= 32:
+		timescale = binary.BigEndian.Uint32(body[20:])
+		duration = binary.BigEndian.Uint64(body[24:])
+	default:
+		return 0, errors.New("mp4: unsupported mvhd version")
+	}
+	if timescale == 0 {
+		return 0, errors.New("mp4: zero timescale")
+	}
+
+	return time.Duration(float64(duration) / float64(timescale) * float64(time.Second)), nil
+}
+
+// --- WebM (Matroska / EBML) ---
+
+const (
+	ebmlSegment       = 0x18538067
+	ebmlInfo          = 0x1549A966
+	ebmlTimecodeScale = 0x2AD7B1
+	ebmlDuration      = 0x4489
+)
+
+// readVint reads an EBML variable-length integer at pos. IDs keep their
+// length marker bits; sizes have them stripped.
+func readVint(r io.ReaderAt, pos int64, keepMarker bool) (uint64, int, error) {
+	first := make([]byte, 1)
+	if _, err := r.ReadAt(first, pos); err != nil {
+		return 0, 0, err
+	}
+	length := 1
+	for mask := byte(0x80); length <= 8 && first[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 8 {
+		return 0, 0, errors.New("ebml: invalid vint")
+	}
+
+	buf := make([]byte, length)
+	if _, err := r.ReadAt(buf, pos); err != nil {
+		return 0, 0, err
+	}
+	if !keepMarker {
+		buf[0] &= 0xFF >> length
+	}
+	var v uint64
+	for _, b := range buf {
+		v = v<<8 | uint64(b)
+	}
+	return v, length, nil
+}
+
+// ebmlElement reads the element header at pos, returning its ID and the
+// bounds of its data. Unknown sizes extend to end.
+func ebmlElement(r io.ReaderAt, pos, end int64) (uint64, int64, int64, error) {
+	id, idLen, err := readVint(r, pos, true)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	size, sizeLen, err := readVint(r, pos+int64(idLen), false)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	dataStart := pos + int64(idLen+sizeLen)
+	dataEnd := dataStart + int64(size)
+	if size == (1<<(7*uint(sizeLen)))-1 || dataEnd > end {
+		dataEnd = end
+	}
+	return id, dataStart, dataEnd, nil
+}
+
+func webmDuration(r io.ReaderAt, size int64) (time.Duration, error) {
+	// Skip the EBML header, then descend Segment -> Info
+	_, _, pos, err := ebmlElement(r, 0, size)
+	if err != nil {
+		return 0, err
+	}
+
+	for pos < size {
+		id, start, end, err := ebmlElement(r, pos, size)
+		if err != nil {
+			return 0, err
+		}
+		switch id {
+		case ebmlSegment:
+			pos = start
+			size = end
+			continue
+		case ebmlInfo:
+			return webmInfoDuration(r, start, end)
+		}
+		pos = end
+	}
+	return 0, errors.New("webm: Info element not found")
+}
+
+func webmInfoDuration(r io.ReaderAt, pos, end int64) (time.Duration, error) {
+	scale := uint64(1_000_000) // default TimecodeScale in ns
+	var duration float64
+
+	for pos < end {
+		id, start, elemEnd, err := ebmlElement(r, pos, end)
+		if err != nil {
+			return 0, err
+		}
+		if elemEnd-start > 8 {
+			pos = elemEnd
+			continue
+		}
+		data := make([]byte, elemEnd-start)
+		if _, err := r.ReadAt(data, start); err != nil {
+			return 0, err
+		}
+
+		switch id {
+		case ebmlTimecodeScale:
+			scale = 0
+			for _, b := range data {
+				scale = scale<<8 | uint64(b)
+			}
+		case ebmlDuration:
+			switch len(data) {
+			case 4:
+				duration = float64(math.Float32frombits(binary.BigEndian.Uint32(data)))
+			case 8:
+				duration = math.Float64frombits(binary.BigEndian.Uint64(data))
+			}
+		}
+		pos = elemEnd
+	}
+
+	if duration == 0 {
+		return 0, errors.New("webm: no duration")
+	}
+	return time.Duration(duration * float64(scale)), nil
+}
+
+// ErrNoFFmpeg is returned by ExtractPoster when ffmpeg is not installed.
+var ErrNoFFmpeg = errors.New("ffmpeg not available")
+
+// ExtractPoster grabs a JPEG frame shortly after the start of the video
+// using ffmpeg, if it is installed on the host.
+func ExtractPoster(ctx context.Context, path string) ([]byte, error) {
+	bin, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return nil, ErrNoFFmpeg
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, bin,
+		"-v", "error",
+		"-ss", "0.5",
+		"-i", path,
+		"-frames:v", "1",
+		"-f", "image2pipe",
+		"-vcodec", "mjpeg",
+		"pipe:1",
+	)
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg: %w", err)
+	}
+	if out.Len() == 0 {
+		return nil, errors.New("ffmpeg produced no frame")
+	}
+	return out.Bytes(), nil
+}
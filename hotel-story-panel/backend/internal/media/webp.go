@@ -0,0 +1,61 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// ErrNoWebP is returned by EncodeWebP when cwebp is not installed.
+var ErrNoWebP = errors.New("cwebp not available")
+
+const webpQuality = 80
+
+// EncodeWebP encodes a rendered image as lossy WebP using cwebp, if it is
+// installed on the host. The image is handed over losslessly as PNG so it
+// is only compressed once.
+func EncodeWebP(ctx context.Context, img image.Image) ([]byte, error) {
+	bin, err := exec.LookPath("cwebp")
+	if err != nil {
+		return nil, ErrNoWebP
+	}
+
+	tmp, err := os.CreateTemp("", "rendition-*.png")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	err = png.Encode(tmp, img)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, bin,
+		"-quiet",
+		"-q", fmt.Sprint(webpQuality),
+		"-metadata", "none",
+		tmp.Name(),
+		"-o", "-",
+	)
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("cwebp: %w", err)
+	}
+	if out.Len() == 0 {
+		return nil, errors.New("cwebp produced no output")
+	}
+	return out.Bytes(), nil
+}
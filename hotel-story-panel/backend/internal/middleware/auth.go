@@ -7,16 +7,30 @@ import (
 	"strings"
 	"time"
 
+	"hotel-story-panel/backend/internal/database"
+
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
 var SecretKey = []byte(os.Getenv("JWT_SECRET"))
 
+// AccessTokenTTL is how long an access token is accepted. It is kept short
+// since only revoking its session cuts it off early; ACCESS_TOKEN_TTL
+// overrides it (e.g. "10m").
+var AccessTokenTTL = 15 * time.Minute
+
+// MFATokenTTL is how long a login that passed the password check has to
+// supply its second factor.
+const MFATokenTTL = 5 * time.Minute
+
 func init() {
 	if len(SecretKey) == 0 {
 		SecretKey = []byte("super-secret-key-change-me")
 	}
+	if v, err := time.ParseDuration(os.Getenv("ACCESS_TOKEN_TTL")); err == nil && v > 0 {
+		AccessTokenTTL = v
+	}
 }
 
 func AuthMiddleware() gin.HandlerFunc {
@@ -42,23 +56,71 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			c.Set("userID", claims["user_id"])
-		} else {
+		// Tokens issued before roles and sessions existed must be renewed
+		claims, ok := token.Claims.(jwt.MapClaims)
+		sid, hasSession := claims["sid"].(float64)
+		if !ok || claims["role"] == nil || !hasSession {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
 			c.Abort()
 			return
 		}
 
+		var active bool
+		err = database.DB.Get(&active, "SELECT revoked_at IS NULL AND expires_at > NOW() FROM user_sessions WHERE id = $1", int64(sid))
+		if err != nil || !active {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has ended"})
+			c.Abort()
+			return
+		}
+
+		c.Set("userID", claims["user_id"])
+		c.Set("role", claims["role"])
+		c.Set("sessionID", int64(sid))
+
 		c.Next()
 	}
 }
 
-func GenerateToken(userID int) (string, error) {
+// GenerateToken issues an access token for a session.
+func GenerateToken(userID int, role string, sessionID int64) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": userID,
+		"role":    role,
+		"sid":     sessionID,
+		"exp":     time.Now().Add(AccessTokenTTL).Unix(),
+	})
+
+	return token.SignedString(SecretKey)
+}
+
+// GenerateMFAToken issues the short-lived token a login holds between the
+// password check and the second factor. It carries no session, so
+// AuthMiddleware refuses it.
+func GenerateMFAToken(userID int) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"user_id": userID,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
+		"purpose": "mfa",
+		"exp":     time.Now().Add(MFATokenTTL).Unix(),
 	})
 
 	return token.SignedString(SecretKey)
 }
+
+// ParseMFAToken returns the user a pending-MFA token was issued for.
+func ParseMFAToken(tokenString string) (int, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return SecretKey, nil
+	})
+	if err != nil || !token.Valid {
+		return 0, fmt.Errorf("invalid token")
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	userID, hasUser := claims["user_id"].(float64)
+	if !ok || claims["purpose"] != "mfa" || !hasUser {
+		return 0, fmt.Errorf("invalid token claims")
+	}
+	return int(userID), nil
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"hotel-story-panel/backend/internal/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimit limits each client IP to l on the routes it guards. name keeps
+// the buckets of different route groups apart.
+func RateLimit(name string, l ratelimit.Limit) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !Throttle(c, name+":ip:"+c.ClientIP(), l) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// Throttle takes a token from key's bucket. When it is empty it answers 429
+// and returns false. If the store fails the request is let through, so an
+// outage of the shared backend doesn't take logins down with it.
+func Throttle(c *gin.Context, key string, l ratelimit.Limit) bool {
+	ok, wait, err := ratelimit.Default.Take(c.Request.Context(), key, l)
+	if err != nil {
+		log.Printf("Rate limit store error: %v", err)
+		return true
+	}
+	if !ok {
+		TooManyRequests(c, wait, "rate_limited")
+		return false
+	}
+	return true
+}
+
+// TooManyRequests aborts with 429 and a Retry-After header in whole seconds.
+func TooManyRequests(c *gin.Context, wait time.Duration, code string) {
+	seconds := max(1, int(math.Ceil(wait.Seconds())))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+		"error":       "Too many requests; try again later",
+		"code":        code,
+		"retry_after": seconds,
+	})
+}
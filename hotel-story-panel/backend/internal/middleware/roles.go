@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"net/http"
+
+	"hotel-story-panel/backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Permission is an action a route requires; roles are granted sets of them.
+type Permission string
+
+const (
+	ViewContent   Permission = "content:view"   // read groups, slides and dashboard stats
+	EditContent   Permission = "content:edit"   // create, change and delete groups, slides and uploads
+	ReviewContent Permission = "content:review" // approve or reject groups submitted for review
+	ViewAnalytics Permission = "analytics:view" // reports, time series and event metrics
+	ManageCities  Permission = "cities:manage"  // the city registry
+	ManageUsers   Permission = "users:manage"   // roles and user accounts
+)
+
+var rolePermissions = map[string][]Permission{
+	models.RoleOwner:    {ViewContent, EditContent, ReviewContent, ViewAnalytics, ManageCities, ManageUsers},
+	models.RoleEditor:   {ViewContent, EditContent, ViewAnalytics},
+	models.RoleReviewer: {ViewContent, ReviewContent},
+	models.RoleAnalyst:  {ViewContent, ViewAnalytics},
+	models.RoleViewer:   {ViewContent},
+}
+
+// HasPermission reports whether role grants p.
+func HasPermission(role string, p Permission) bool {
+	for _, granted := range rolePermissions[role] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+// RolesWith lists the roles that grant p.
+func RolesWith(p Permission) []string {
+	var roles []string
+	for role := range rolePermissions {
+		if HasPermission(role, p) {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// RequirePermission rejects the request with 403 unless the role set by
+// AuthMiddleware grants at least one of ps. It must run after
+// AuthMiddleware.
+func RequirePermission(ps ...Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+		for _, p := range ps {
+			if HasPermission(role, p) {
+				c.Next()
+				return
+			}
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to do this"})
+		c.Abort()
+	}
+}
@@ -0,0 +1,287 @@
+package migrations
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// lockKey is the pg_advisory_lock key held while migrating, so several
+// server replicas starting with AUTO_MIGRATE don't race each other.
+const lockKey = 720_301
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+// Load reads the embedded migrations, named NNNN_name.up.sql / NNNN_name.down.sql,
+// and returns them sorted by version.
+func Load() ([]Migration, error) {
+	entries, err := fs.ReadDir(files, "sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		name := e.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		prefix, label, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %q: expected NNNN_name", name)
+		}
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("migration %q: invalid version: %w", name, err)
+		}
+
+		body, err := files.ReadFile("sql/" + name)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		} else if m.Name != label {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, label)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	list := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", m.Version, m.Name)
+		}
+		list = append(list, *m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, nil
+}
+
+func ensureTable(db *sqlx.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	return err
+}
+
+func applied(db *sqlx.DB) (map[int]time.Time, error) {
+	var rows []struct {
+		Version   int       `db:"version"`
+		AppliedAt time.Time `db:"applied_at"`
+	}
+	if err := db.Select(&rows, "SELECT version, applied_at FROM schema_migrations"); err != nil {
+		return nil, err
+	}
+	out := make(map[int]time.Time, len(rows))
+	for _, r := range rows {
+		out[r.Version] = r.AppliedAt
+	}
+	return out, nil
+}
+
+// withLock prepares the bookkeeping table and runs fn while holding the
+// migration advisory lock on a dedicated connection.
+func withLock(db *sqlx.DB, fn func() error) error {
+	if err := ensureTable(db); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	ctx := context.Background()
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", lockKey)
+
+	return fn()
+}
+
+// Up applies every pending migration in order and returns how many ran.
+func Up(db *sqlx.DB) (int, error) {
+	list, err := Load()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = withLock(db, func() error {
+		done, err := applied(db)
+		if err != nil {
+			return err
+		}
+		for _, m := range list {
+			if _, ok := done[m.Version]; ok {
+				continue
+			}
+			if err := run(db, m, true); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Down rolls back the given number of most recently applied migrations.
+func Down(db *sqlx.DB, steps int) (int, error) {
+	list, err := Load()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = withLock(db, func() error {
+		done, err := applied(db)
+		if err != nil {
+			return err
+		}
+		for i := len(list) - 1; i >= 0 && count < steps; i-- {
+			m := list[i]
+			if _, ok := done[m.Version]; !ok {
+				continue
+			}
+			if err := run(db, m, false); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Redo rolls back the latest applied migration and applies just that one
+// again, under a single lock so nothing else migrates in between.
+func Redo(db *sqlx.DB) error {
+	list, err := Load()
+	if err != nil {
+		return err
+	}
+
+	return withLock(db, func() error {
+		done, err := applied(db)
+		if err != nil {
+			return err
+		}
+		for i := len(list) - 1; i >= 0; i-- {
+			m := list[i]
+			if _, ok := done[m.Version]; !ok {
+				continue
+			}
+			if err := run(db, m, false); err != nil {
+				return err
+			}
+			return run(db, m, true)
+		}
+		return nil
+	})
+}
+
+// GetStatus lists every known migration and whether it has been applied.
+func GetStatus(db *sqlx.DB) ([]Status, error) {
+	list, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureTable(db); err != nil {
+		return nil, err
+	}
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(list))
+	for _, m := range list {
+		s := Status{Version: m.Version, Name: m.Name}
+		if at, ok := done[m.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = &at
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses, nil
+}
+
+// run executes a single migration script and records it in one transaction.
+func run(db *sqlx.DB, m Migration, up bool) error {
+	script, verb := m.Up, "up"
+	if !up {
+		script, verb = m.Down, "down"
+		if script == "" {
+			return fmt.Errorf("migration %04d_%s has no down script", m.Version, m.Name)
+		}
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(script); err != nil {
+		return fmt.Errorf("migration %04d_%s %s: %w", m.Version, m.Name, verb, err)
+	}
+
+	if up {
+		_, err = tx.Exec("INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.Version, m.Name)
+	} else {
+		_, err = tx.Exec("DELETE FROM schema_migrations WHERE version = $1", m.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("Migrated %s: %04d_%s", verb, m.Version, m.Name)
+	return nil
+}
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_story_groups_city;
+DROP TABLE IF EXISTS story_slides;
+DROP TABLE IF EXISTS story_groups;
+DROP TABLE IF EXISTS users;
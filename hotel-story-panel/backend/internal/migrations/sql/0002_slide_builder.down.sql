@@ -0,0 +1,6 @@
+ALTER TABLE story_groups DROP COLUMN IF EXISTS open_count;
+UPDATE story_slides SET image_url = '' WHERE image_url IS NULL;
+ALTER TABLE story_slides ALTER COLUMN image_url SET NOT NULL;
+ALTER TABLE story_slides DROP COLUMN IF EXISTS background_color;
+ALTER TABLE story_slides DROP COLUMN IF EXISTS duration;
+ALTER TABLE story_slides DROP COLUMN IF EXISTS elements;
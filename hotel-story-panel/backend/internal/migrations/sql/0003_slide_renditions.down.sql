@@ -0,0 +1 @@
+ALTER TABLE story_slides DROP COLUMN IF EXISTS preview_url;
@@ -0,0 +1,3 @@
+-- Small 9:16 placeholder rendition; image_url holds the 1080x1920 story
+-- rendition and thumbnail_url the 1:1 crop
+ALTER TABLE story_slides ADD COLUMN IF NOT EXISTS preview_url TEXT;
@@ -0,0 +1,3 @@
+DELETE FROM story_slides WHERE media_type = 'video' AND COALESCE(image_url, '') = '' AND background_color IS NULL;
+ALTER TABLE story_slides DROP COLUMN IF EXISTS video_url;
+ALTER TABLE story_slides DROP COLUMN IF EXISTS media_type;
@@ -0,0 +1,7 @@
+-- Slides are an image, a video (with image_url holding its poster) or a plain background color
+ALTER TABLE story_slides ADD COLUMN IF NOT EXISTS media_type VARCHAR(10) NOT NULL DEFAULT 'image'
+    CHECK (media_type IN ('image', 'video', 'color'));
+ALTER TABLE story_slides ADD COLUMN IF NOT EXISTS video_url TEXT;
+
+UPDATE story_slides SET media_type = 'color'
+WHERE COALESCE(image_url, '') = '' AND background_color IS NOT NULL;
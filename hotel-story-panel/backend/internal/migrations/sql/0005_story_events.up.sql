@@ -0,0 +1,16 @@
+-- Append-only raw analytics events, written in batches by the event writer
+CREATE TABLE IF NOT EXISTS story_events (
+    id BIGSERIAL PRIMARY KEY,
+    event_type VARCHAR(20) NOT NULL,
+    group_id INT, -- NULL only for legacy slide-open calls
+    slide_id INT,
+    session_id VARCHAR(64) NOT NULL DEFAULT '', -- one story viewer session
+    viewer_id VARCHAR(64) NOT NULL DEFAULT '', -- anonymous, persistent per browser
+    watch_ms INT, -- time spent on the slide before the event
+    meta JSONB, -- e.g. {"url": "..."} for link_click
+    occurred_at TIMESTAMPTZ NOT NULL,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_story_events_group_time ON story_events(group_id, occurred_at);
+CREATE INDEX IF NOT EXISTS idx_story_events_slide ON story_events(slide_id) WHERE slide_id IS NOT NULL;
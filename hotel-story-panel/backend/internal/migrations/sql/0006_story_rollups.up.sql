@@ -0,0 +1,35 @@
+-- Rollups of story_events maintained by the background aggregator.
+-- Buckets follow Tehran local time.
+CREATE TABLE IF NOT EXISTS story_stats_hourly (
+    bucket TIMESTAMPTZ NOT NULL, -- start of the Tehran-local hour
+    group_id INT NOT NULL,
+    city_slug VARCHAR(100) NOT NULL DEFAULT '',
+    impressions INT NOT NULL DEFAULT 0,
+    opens INT NOT NULL DEFAULT 0,
+    slide_views INT NOT NULL DEFAULT 0,
+    completions INT NOT NULL DEFAULT 0,
+    link_clicks INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (bucket, group_id)
+);
+
+CREATE TABLE IF NOT EXISTS story_stats_daily (
+    day DATE NOT NULL, -- Tehran calendar day
+    group_id INT NOT NULL,
+    city_slug VARCHAR(100) NOT NULL DEFAULT '',
+    impressions INT NOT NULL DEFAULT 0,
+    opens INT NOT NULL DEFAULT 0,
+    slide_views INT NOT NULL DEFAULT 0,
+    completions INT NOT NULL DEFAULT 0,
+    link_clicks INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (day, group_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_story_stats_hourly_city ON story_stats_hourly(city_slug, bucket);
+CREATE INDEX IF NOT EXISTS idx_story_stats_daily_city ON story_stats_daily(city_slug, day);
+
+-- Highest story_events.id already folded into the rollups
+CREATE TABLE IF NOT EXISTS rollup_state (
+    name VARCHAR(50) PRIMARY KEY,
+    last_event_id BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS story_group_schedule_events;
+ALTER TABLE story_groups DROP COLUMN IF EXISTS schedule_state;
+ALTER TABLE story_groups DROP CONSTRAINT IF EXISTS story_groups_window_check;
+ALTER TABLE story_groups DROP COLUMN IF EXISTS ends_at;
+ALTER TABLE story_groups DROP COLUMN IF EXISTS starts_at;
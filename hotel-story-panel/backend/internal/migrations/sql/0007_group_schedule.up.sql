@@ -0,0 +1,17 @@
+-- Optional publishing window; a group is shown only while active AND inside it
+ALTER TABLE story_groups ADD COLUMN IF NOT EXISTS starts_at TIMESTAMPTZ;
+ALTER TABLE story_groups ADD COLUMN IF NOT EXISTS ends_at TIMESTAMPTZ;
+ALTER TABLE story_groups ADD CONSTRAINT story_groups_window_check
+    CHECK (starts_at IS NULL OR ends_at IS NULL OR ends_at > starts_at);
+
+-- Last window state announced by the scheduler: scheduled, live or expired
+ALTER TABLE story_groups ADD COLUMN IF NOT EXISTS schedule_state VARCHAR(20) NOT NULL DEFAULT 'live';
+
+-- Activation/expiry transitions emitted by the scheduler
+CREATE TABLE IF NOT EXISTS story_group_schedule_events (
+    id BIGSERIAL PRIMARY KEY,
+    group_id INT NOT NULL REFERENCES story_groups(id) ON DELETE CASCADE,
+    event VARCHAR(20) NOT NULL, -- scheduled, activated, expired
+    occurred_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_story_group_schedule_events_group ON story_group_schedule_events(group_id, occurred_at);
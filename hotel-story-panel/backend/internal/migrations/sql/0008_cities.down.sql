@@ -0,0 +1,2 @@
+ALTER TABLE story_groups DROP CONSTRAINT IF EXISTS story_groups_city_fkey;
+DROP TABLE IF EXISTS cities;
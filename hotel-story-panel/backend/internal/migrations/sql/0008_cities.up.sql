@@ -0,0 +1,41 @@
+-- City registry; story_groups.city_slug must name one of these
+CREATE TABLE IF NOT EXISTS cities (
+    id SERIAL PRIMARY KEY,
+    slug VARCHAR(100) UNIQUE NOT NULL, -- canonical English slug, e.g. 'tehran'
+    name_fa VARCHAR(100) NOT NULL, -- e.g. 'تهران'
+    aliases TEXT[] NOT NULL DEFAULT '{}', -- other spellings accepted on lookup, stored normalized
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_cities_aliases ON cities USING GIN (aliases);
+
+-- The cities previously hardcoded in GetPublicStories
+INSERT INTO cities (slug, name_fa, aliases) VALUES
+    ('tehran', 'تهران', ARRAY['تهران']),
+    ('shiraz', 'شیراز', ARRAY['شیراز']),
+    ('mashhad', 'مشهد', ARRAY['مشهد', 'mashad']),
+    ('isfahan', 'اصفهان', ARRAY['اصفهان', 'esfahan']),
+    ('kish', 'کیش', ARRAY['کیش']),
+    ('tabriz', 'تبریز', ARRAY['تبریز']),
+    ('yazd', 'یزد', ARRAY['یزد']),
+    ('qeshm', 'قشم', ARRAY['قشم', 'gheshm']),
+    ('qom', 'قم', ARRAY['قم', 'ghom'])
+ON CONFLICT (slug) DO NOTHING;
+
+-- Point existing groups at the canonical slug, whichever spelling they used
+UPDATE story_groups g SET city_slug = c.slug
+FROM cities c
+WHERE g.city_slug <> c.slug
+    AND (lower(btrim(g.city_slug)) = c.slug
+        OR btrim(g.city_slug) = c.name_fa
+        OR lower(btrim(g.city_slug)) = ANY(c.aliases));
+
+-- Anything left over becomes its own city so the foreign key holds and its
+-- stories stay reachable; an admin can rename it afterwards
+INSERT INTO cities (slug, name_fa)
+SELECT DISTINCT city_slug, city_slug FROM story_groups
+WHERE city_slug NOT IN (SELECT slug FROM cities)
+ON CONFLICT (slug) DO NOTHING;
+
+ALTER TABLE story_groups ADD CONSTRAINT story_groups_city_fkey
+    FOREIGN KEY (city_slug) REFERENCES cities(slug) ON UPDATE CASCADE;
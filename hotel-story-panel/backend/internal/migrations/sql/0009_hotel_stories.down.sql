@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_story_slides_hotels;
+ALTER TABLE story_slides DROP COLUMN IF EXISTS hotel_slugs;
+DROP TABLE IF EXISTS story_group_hotels;
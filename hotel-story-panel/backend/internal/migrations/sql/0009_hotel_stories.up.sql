@@ -0,0 +1,11 @@
+-- Hotels a group is shown for, in addition to its city page
+CREATE TABLE IF NOT EXISTS story_group_hotels (
+    group_id INT NOT NULL REFERENCES story_groups(id) ON DELETE CASCADE,
+    hotel_slug VARCHAR(150) NOT NULL, -- normalized hotel identifier
+    PRIMARY KEY (group_id, hotel_slug)
+);
+CREATE INDEX IF NOT EXISTS idx_story_group_hotels_hotel ON story_group_hotels(hotel_slug);
+
+-- A slide with hotel slugs is shown only on those hotels' pages
+ALTER TABLE story_slides ADD COLUMN IF NOT EXISTS hotel_slugs TEXT[] NOT NULL DEFAULT '{}';
+CREATE INDEX IF NOT EXISTS idx_story_slides_hotels ON story_slides USING GIN (hotel_slugs);
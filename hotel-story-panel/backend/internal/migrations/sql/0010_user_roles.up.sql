@@ -0,0 +1,6 @@
+-- Everyone who could log in so far had full access, so existing users become
+-- owners; new users start as viewers
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'owner';
+ALTER TABLE users ALTER COLUMN role SET DEFAULT 'viewer';
+ALTER TABLE users ADD CONSTRAINT users_role_check
+    CHECK (role IN ('owner', 'editor', 'analyst', 'viewer'));
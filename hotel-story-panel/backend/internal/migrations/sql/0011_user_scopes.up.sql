@@ -0,0 +1,11 @@
+-- Limits a non-owner to groups of the given cities and/or hotels. A user
+-- without any rows here is not limited, so deleting a granted city is refused
+-- rather than cascaded.
+CREATE TABLE IF NOT EXISTS user_scopes (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    city_slug VARCHAR(100) REFERENCES cities(slug) ON UPDATE CASCADE,
+    hotel_slug VARCHAR(150), -- normalized, as in story_group_hotels
+    CONSTRAINT user_scopes_target_check CHECK ((city_slug IS NULL) <> (hotel_slug IS NULL))
+);
+CREATE INDEX IF NOT EXISTS idx_user_scopes_user ON user_scopes(user_id);
@@ -0,0 +1,15 @@
+-- Single-use, expiring invitation and password reset tokens. Only the
+-- sha256 of each token is stored.
+CREATE TABLE IF NOT EXISTS user_tokens (
+    id SERIAL PRIMARY KEY,
+    purpose VARCHAR(20) NOT NULL CHECK (purpose IN ('invite', 'password_reset')),
+    token_hash CHAR(64) UNIQUE NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    role VARCHAR(20), -- invitations: the role the new user gets
+    user_id INT REFERENCES users(id) ON DELETE CASCADE, -- password resets: whose password
+    created_by INT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_user_tokens_email ON user_tokens(purpose, email);
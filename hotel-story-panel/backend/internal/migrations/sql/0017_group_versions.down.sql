@@ -0,0 +1,2 @@
+ALTER TABLE story_groups DROP COLUMN IF EXISTS published_version;
+DROP TABLE IF EXISTS story_group_versions;
@@ -0,0 +1,36 @@
+-- Published snapshots of a group's content. story_groups and story_slides
+-- hold the draft that the admin edits; customers see the version named by
+-- story_groups.published_version. content is the title, caption, cover and
+-- slides as built by handlers.draftContentSQL.
+CREATE TABLE IF NOT EXISTS story_group_versions (
+    id BIGSERIAL PRIMARY KEY,
+    group_id INT NOT NULL REFERENCES story_groups(id) ON DELETE CASCADE,
+    version INT NOT NULL,
+    content JSONB NOT NULL,
+    published_by INT REFERENCES users(id) ON DELETE SET NULL,
+    published_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    restored_from INT, -- the version a rollback republished
+    UNIQUE (group_id, version)
+);
+
+ALTER TABLE story_groups ADD COLUMN IF NOT EXISTS published_version INT;
+
+-- Existing groups stay visible: their current content becomes version 1
+INSERT INTO story_group_versions (group_id, version, content)
+SELECT g.id, 1, jsonb_build_object(
+    'title_fa', g.title_fa, 'caption', g.caption, 'cover_url', g.cover_url,
+    'slides', COALESCE((
+        SELECT jsonb_agg(jsonb_build_object(
+            'id', s.id, 'group_id', s.group_id, 'image_url', s.image_url,
+            'thumbnail_url', s.thumbnail_url, 'preview_url', s.preview_url,
+            'media_type', s.media_type, 'video_url', s.video_url, 'caption_fa', s.caption_fa,
+            'elements', s.elements, 'sort_order', s.sort_order, 'duration', s.duration,
+            'background_color', s.background_color, 'hotel_slugs', to_jsonb(s.hotel_slugs),
+            'created_at', s.created_at AT TIME ZONE 'UTC') ORDER BY s.sort_order, s.id)
+        FROM story_slides s WHERE s.group_id = g.id), '[]'::jsonb))
+FROM story_groups g
+WHERE NOT EXISTS (SELECT 1 FROM story_group_versions v WHERE v.group_id = g.id);
+
+UPDATE story_groups g SET published_version = 1
+WHERE g.published_version IS NULL
+    AND EXISTS (SELECT 1 FROM story_group_versions v WHERE v.group_id = g.id AND v.version = 1);
@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS story_group_comments;
+ALTER TABLE story_groups DROP COLUMN IF EXISTS approved_content;
+ALTER TABLE story_groups DROP COLUMN IF EXISTS submitted_at;
+ALTER TABLE story_groups DROP COLUMN IF EXISTS submitted_by;
+ALTER TABLE story_groups DROP COLUMN IF EXISTS reviewer_id;
+ALTER TABLE story_groups DROP CONSTRAINT IF EXISTS story_groups_review_state_check;
+ALTER TABLE story_groups DROP COLUMN IF EXISTS review_state;
+UPDATE users SET role = 'viewer' WHERE role = 'reviewer';
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+ALTER TABLE users ADD CONSTRAINT users_role_check
+    CHECK (role IN ('owner', 'editor', 'analyst', 'viewer'));
@@ -0,0 +1,30 @@
+-- Reviewers sign off on group content before it is published
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+ALTER TABLE users ADD CONSTRAINT users_role_check
+    CHECK (role IN ('owner', 'editor', 'reviewer', 'analyst', 'viewer'));
+
+-- Review state of the draft: draft, in_review, approved, rejected or
+-- published. approved_content is the draft as the reviewer approved it;
+-- publishing requires the draft to still match it.
+ALTER TABLE story_groups ADD COLUMN IF NOT EXISTS review_state VARCHAR(20) NOT NULL DEFAULT 'draft';
+ALTER TABLE story_groups ADD CONSTRAINT story_groups_review_state_check
+    CHECK (review_state IN ('draft', 'in_review', 'approved', 'rejected', 'published'));
+ALTER TABLE story_groups ADD COLUMN IF NOT EXISTS reviewer_id INT REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE story_groups ADD COLUMN IF NOT EXISTS submitted_by INT REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE story_groups ADD COLUMN IF NOT EXISTS submitted_at TIMESTAMPTZ;
+ALTER TABLE story_groups ADD COLUMN IF NOT EXISTS approved_content JSONB;
+
+UPDATE story_groups SET review_state = 'published' WHERE published_version IS NOT NULL;
+
+-- Review discussion on a group, optionally about one of its slides. Review
+-- transitions are posted here too, with their optional comment.
+CREATE TABLE IF NOT EXISTS story_group_comments (
+    id BIGSERIAL PRIMARY KEY,
+    group_id INT NOT NULL REFERENCES story_groups(id) ON DELETE CASCADE,
+    slide_id INT, -- no FK: rollbacks bring deleted slides back under the same id
+    user_id INT REFERENCES users(id) ON DELETE SET NULL,
+    body TEXT NOT NULL DEFAULT '',
+    transition VARCHAR(20), -- submit, withdraw, approve or reject; NULL for plain comments
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_story_group_comments_group ON story_group_comments(group_id, created_at);
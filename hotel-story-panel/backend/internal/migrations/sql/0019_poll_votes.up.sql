@@ -0,0 +1,12 @@
+-- One vote per viewer on each poll element. Polls are identified by the
+-- slide and the element's id within the slide's elements.
+CREATE TABLE IF NOT EXISTS poll_votes (
+    group_id INT NOT NULL REFERENCES story_groups(id) ON DELETE CASCADE,
+    slide_id INT NOT NULL, -- no FK: published versions outlive draft slides
+    element_id VARCHAR(32) NOT NULL,
+    viewer_id VARCHAR(64) NOT NULL, -- anonymous, persistent per browser
+    option_index SMALLINT NOT NULL, -- 0-based, into the poll's options
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (slide_id, element_id, viewer_id)
+);
+CREATE INDEX IF NOT EXISTS idx_poll_votes_group ON poll_votes(group_id, created_at);
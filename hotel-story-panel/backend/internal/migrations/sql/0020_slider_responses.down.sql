@@ -0,0 +1 @@
+DROP TABLE IF EXISTS slider_responses;
@@ -0,0 +1,11 @@
+-- Raw emoji slider responses, one per viewer on each slider element
+CREATE TABLE IF NOT EXISTS slider_responses (
+    group_id INT NOT NULL REFERENCES story_groups(id) ON DELETE CASCADE,
+    slide_id INT NOT NULL, -- no FK: published versions outlive draft slides
+    element_id VARCHAR(32) NOT NULL,
+    viewer_id VARCHAR(64) NOT NULL, -- anonymous, persistent per browser
+    value SMALLINT NOT NULL CHECK (value BETWEEN 0 AND 100),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (slide_id, element_id, viewer_id)
+);
+CREATE INDEX IF NOT EXISTS idx_slider_responses_group ON slider_responses(group_id, created_at);
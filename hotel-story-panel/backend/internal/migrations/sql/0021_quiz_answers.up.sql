@@ -0,0 +1,13 @@
+-- One answer per viewer on each quiz element. Whether it was correct is
+-- kept as judged when answering, in case the quiz is edited later.
+CREATE TABLE IF NOT EXISTS quiz_answers (
+    group_id INT NOT NULL REFERENCES story_groups(id) ON DELETE CASCADE,
+    slide_id INT NOT NULL, -- no FK: published versions outlive draft slides
+    element_id VARCHAR(32) NOT NULL,
+    viewer_id VARCHAR(64) NOT NULL, -- anonymous, persistent per browser
+    option_index SMALLINT NOT NULL, -- 0-based, into the quiz's options
+    correct BOOLEAN NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (slide_id, element_id, viewer_id)
+);
+CREATE INDEX IF NOT EXISTS idx_quiz_answers_group ON quiz_answers(group_id, created_at);
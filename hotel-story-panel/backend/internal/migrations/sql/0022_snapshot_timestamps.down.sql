@@ -0,0 +1,2 @@
+-- Nothing to undo: the offsets added by the up migration are still valid
+-- for the older code, which reads created_at as UTC.
@@ -0,0 +1,20 @@
+-- Snapshots written before this fix hold slide created_at without a UTC
+-- offset, which doesn't parse as a time. Add the offset, as the draft
+-- expression now does, so they load and still compare equal to drafts.
+UPDATE story_group_versions v SET content = jsonb_set(v.content, '{slides}', (
+    SELECT COALESCE(jsonb_agg(
+        CASE WHEN jsonb_typeof(s->'created_at') = 'string' AND s->>'created_at' !~ '(Z|[+-][0-9]{2}:[0-9]{2})$'
+            THEN jsonb_set(s, '{created_at}', to_jsonb((s->>'created_at')::timestamp AT TIME ZONE 'UTC'))
+            ELSE s END
+        ORDER BY e.ord), '[]'::jsonb)
+    FROM jsonb_array_elements(v.content->'slides') WITH ORDINALITY AS e(s, ord)))
+WHERE jsonb_typeof(v.content->'slides') = 'array';
+
+UPDATE story_groups g SET approved_content = jsonb_set(g.approved_content, '{slides}', (
+    SELECT COALESCE(jsonb_agg(
+        CASE WHEN jsonb_typeof(s->'created_at') = 'string' AND s->>'created_at' !~ '(Z|[+-][0-9]{2}:[0-9]{2})$'
+            THEN jsonb_set(s, '{created_at}', to_jsonb((s->>'created_at')::timestamp AT TIME ZONE 'UTC'))
+            ELSE s END
+        ORDER BY e.ord), '[]'::jsonb)
+    FROM jsonb_array_elements(g.approved_content->'slides') WITH ORDINALITY AS e(s, ord)))
+WHERE jsonb_typeof(g.approved_content->'slides') = 'array';
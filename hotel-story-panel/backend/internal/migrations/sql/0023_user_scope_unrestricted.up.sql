@@ -0,0 +1,6 @@
+-- Whether a non-owner sees all content. Those who don't see only what
+-- user_scopes grants them, which may be nothing, so taking away a user's
+-- last city no longer opens everything up. Users limited so far keep their
+-- grants; everyone else stays unrestricted, as new accounts start out.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS unrestricted BOOLEAN NOT NULL DEFAULT TRUE;
+UPDATE users SET unrestricted = FALSE WHERE id IN (SELECT user_id FROM user_scopes);
@@ -0,0 +1,3 @@
+ALTER TABLE story_slides DROP COLUMN IF EXISTS preview_webp_url;
+ALTER TABLE story_slides DROP COLUMN IF EXISTS thumbnail_webp_url;
+ALTER TABLE story_slides DROP COLUMN IF EXISTS image_webp_url;
@@ -0,0 +1,5 @@
+-- WebP copies of a slide's image renditions, for browsers that take them.
+-- NULL when the server had no WebP encoder; the JPEGs always exist.
+ALTER TABLE story_slides ADD COLUMN IF NOT EXISTS image_webp_url TEXT;
+ALTER TABLE story_slides ADD COLUMN IF NOT EXISTS thumbnail_webp_url TEXT;
+ALTER TABLE story_slides ADD COLUMN IF NOT EXISTS preview_webp_url TEXT;
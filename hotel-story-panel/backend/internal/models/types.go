@@ -3,42 +3,233 @@ package models
 import (
 	"encoding/json"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type User struct {
 	ID           int       `db:"id" json:"id"`
 	Email        string    `db:"email" json:"email"`
 	PasswordHash string    `db:"password_hash" json:"-"`
+	Role         string    `db:"role" json:"role"` // owner, editor, reviewer, analyst or viewer
 	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+
+	TOTPSecret    *string    `db:"totp_secret" json:"-"`
+	TOTPEnabledAt *time.Time `db:"totp_enabled_at" json:"-"`
+	TOTPLastStep  int64      `db:"totp_last_step" json:"-"`
+	MFAEnabled    bool       `db:"mfa_enabled" json:"mfa_enabled"` // only in user listings
+
+	FailedLogins      int        `db:"failed_logins" json:"-"`
+	LastFailedLoginAt *time.Time `db:"last_failed_login_at" json:"-"`
+	LockedUntil       *time.Time `db:"locked_until" json:"-"`
+
+	Unrestricted bool `db:"unrestricted" json:"-"` // see UserScope
+}
+
+// Admin user roles, from most to least privileged. What each may do is
+// defined in middleware.rolePermissions.
+const (
+	RoleOwner    = "owner"
+	RoleEditor   = "editor"
+	RoleReviewer = "reviewer"
+	RoleAnalyst  = "analyst"
+	RoleViewer   = "viewer"
+)
+
+// Session is a login on one device, as listed to its user.
+type Session struct {
+	ID         int64     `db:"id" json:"id"`
+	UserAgent  string    `db:"user_agent" json:"user_agent"`
+	IP         string    `db:"ip" json:"ip"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+	LastUsedAt time.Time `db:"last_used_at" json:"last_used_at"`
+	ExpiresAt  time.Time `db:"expires_at" json:"expires_at"`
+	Current    bool      `db:"-" json:"current"` // the session making the request
+}
+
+// Invitation is a pending invitation for a new admin user.
+type Invitation struct {
+	ID        int       `db:"id" json:"id"`
+	Email     string    `db:"email" json:"email"`
+	Role      string    `db:"role" json:"role"`
+	CreatedBy *int      `db:"created_by" json:"created_by"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	ExpiresAt time.Time `db:"expires_at" json:"expires_at"`
+}
+
+// AuditEntry is one change recorded in the audit log. Changes maps each
+// changed field to its before and after values.
+type AuditEntry struct {
+	ID         int64           `db:"id" json:"id"`
+	UserID     *int            `db:"user_id" json:"user_id"`
+	UserEmail  *string         `db:"user_email" json:"user_email"`
+	Action     string          `db:"action" json:"action"`
+	EntityType string          `db:"entity_type" json:"entity_type"`
+	EntityID   *string         `db:"entity_id" json:"entity_id"`
+	Changes    json.RawMessage `db:"changes" json:"changes"`
+	IP         string          `db:"ip" json:"ip"`
+	CreatedAt  time.Time       `db:"created_at" json:"created_at"`
+}
+
+// UserScope is what content a user may see and change: everything when All
+// is set, otherwise the groups of the given cities and hotels, which may be
+// none. Owners are never limited.
+type UserScope struct {
+	All    bool     `json:"all"`
+	Cities []string `json:"cities"`
+	Hotels []string `json:"hotels"`
+}
+
+// ValidRole reports whether r is one of the roles above.
+func ValidRole(r string) bool {
+	switch r {
+	case RoleOwner, RoleEditor, RoleReviewer, RoleAnalyst, RoleViewer:
+		return true
+	}
+	return false
 }
 
 type StoryGroup struct {
-	ID         int          `db:"id" json:"id"`
-	CitySlug   string       `db:"city_slug" json:"city_slug"`
-	TitleFa    string       `db:"title_fa" json:"title_fa"`
-	Caption    string       `db:"caption" json:"caption"`     // New field
-	CoverURL   string       `db:"cover_url" json:"cover_url"` // New field
-	ShortCode  string       `db:"short_code" json:"short_code"`
-	Active     bool         `db:"active" json:"active"`
-	ViewCount  int          `db:"view_count" json:"view_count"`
-	OpenCount  int          `db:"open_count" json:"open_count"`
-	CreatedAt  time.Time    `db:"created_at" json:"created_at"`
-	StoryCount int64        `db:"story_count" json:"story_count"`
-	Slides     []StorySlide `db:"-" json:"slides,omitempty"` // populated manually
+	ID         int            `db:"id" json:"id"`
+	CitySlug   string         `db:"city_slug" json:"city_slug"`
+	TitleFa    string         `db:"title_fa" json:"title_fa"`
+	Caption    string         `db:"caption" json:"caption"`     // New field
+	CoverURL   string         `db:"cover_url" json:"cover_url"` // New field
+	ShortCode  string         `db:"short_code" json:"short_code"`
+	Active     bool           `db:"active" json:"active"`
+	ViewCount  int            `db:"view_count" json:"view_count"`
+	OpenCount  int            `db:"open_count" json:"open_count"`
+	CreatedAt  time.Time      `db:"created_at" json:"created_at"`
+	StartsAt   *time.Time     `db:"starts_at" json:"starts_at"` // optional publishing window
+	EndsAt     *time.Time     `db:"ends_at" json:"ends_at"`
+	Status     string         `db:"-" json:"status"`      // inactive, scheduled, live or expired
+	Hotels     pq.StringArray `db:"hotels" json:"hotels"` // hotel pages the group is also shown on
+	StoryCount int64          `db:"story_count" json:"story_count"`
+	Slides     []StorySlide   `db:"-" json:"slides,omitempty"` // populated manually
+
+	PublishedVersion *int `db:"published_version" json:"published_version"` // nil until first published
+	HasDraftChanges  bool `db:"has_draft_changes" json:"has_draft_changes"` // only in admin reads
+
+	// Review of the draft; only in admin reads
+	ReviewState   string     `db:"review_state" json:"review_state,omitempty"`
+	ReviewerID    *int       `db:"reviewer_id" json:"reviewer_id,omitempty"`
+	ReviewerEmail *string    `db:"reviewer_email" json:"reviewer_email,omitempty"`
+	SubmittedBy   *int       `db:"submitted_by" json:"submitted_by,omitempty"`
+	SubmittedAt   *time.Time `db:"submitted_at" json:"submitted_at,omitempty"`
+}
+
+// Review states of a group's draft. Editors submit it, reviewers approve or
+// reject it, and only an approved draft can be published.
+const (
+	ReviewDraft     = "draft"
+	ReviewInReview  = "in_review"
+	ReviewApproved  = "approved"
+	ReviewRejected  = "rejected"
+	ReviewPublished = "published"
+)
+
+// GroupComment is a review comment on a group or one of its slides. Review
+// transitions appear among them with Transition set.
+type GroupComment struct {
+	ID         int64     `db:"id" json:"id"`
+	GroupID    int       `db:"group_id" json:"group_id"`
+	SlideID    *int      `db:"slide_id" json:"slide_id"`
+	UserID     *int      `db:"user_id" json:"user_id"`
+	UserEmail  *string   `db:"user_email" json:"user_email"`
+	Body       string    `db:"body" json:"body"`
+	Transition *string   `db:"transition" json:"transition"` // submit, withdraw, approve or reject
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+}
+
+// GroupContent is the part of a group that goes through publishing: its
+// text, cover and slides. Placement, the active flag and the window apply
+// as soon as they are saved.
+type GroupContent struct {
+	TitleFa  string       `json:"title_fa"`
+	Caption  string       `json:"caption"`
+	CoverURL string       `json:"cover_url"`
+	Slides   []StorySlide `json:"slides"`
+}
+
+// GroupVersion is one published version of a group.
+type GroupVersion struct {
+	ID               int64         `db:"id" json:"id"`
+	GroupID          int           `db:"group_id" json:"group_id"`
+	Version          int           `db:"version" json:"version"`
+	PublishedBy      *int          `db:"published_by" json:"published_by"`
+	PublishedByEmail *string       `db:"published_by_email" json:"published_by_email"`
+	PublishedAt      time.Time     `db:"published_at" json:"published_at"`
+	RestoredFrom     *int          `db:"restored_from" json:"restored_from"` // set when a rollback republished that version
+	SlideCount       int           `db:"slide_count" json:"slide_count"`
+	Current          bool          `db:"current" json:"current"` // the version customers see
+	Content          *GroupContent `db:"-" json:"content,omitempty"`
+}
+
+// Group window states, see StoryGroup.WindowState.
+const (
+	GroupInactive  = "inactive"
+	GroupScheduled = "scheduled"
+	GroupLive      = "live"
+	GroupExpired   = "expired"
+)
+
+// WindowState reports where now falls relative to the publishing window,
+// ignoring the manual active flag.
+func (g *StoryGroup) WindowState(now time.Time) string {
+	if g.StartsAt != nil && now.Before(*g.StartsAt) {
+		return GroupScheduled
+	}
+	if g.EndsAt != nil && !now.Before(*g.EndsAt) {
+		return GroupExpired
+	}
+	return GroupLive
+}
+
+// ComputeStatus fills Status from the active flag and the window.
+func (g *StoryGroup) ComputeStatus(now time.Time) {
+	if !g.Active {
+		g.Status = GroupInactive
+		return
+	}
+	g.Status = g.WindowState(now)
+}
+
+type City struct {
+	ID         int            `db:"id" json:"id"`
+	Slug       string         `db:"slug" json:"slug"`       // canonical English slug
+	NameFa     string         `db:"name_fa" json:"name_fa"` // Persian display name
+	Aliases    pq.StringArray `db:"aliases" json:"aliases"` // normalized alternative spellings
+	Active     bool           `db:"active" json:"active"`
+	CreatedAt  time.Time      `db:"created_at" json:"created_at"`
+	GroupCount int            `db:"group_count" json:"group_count"`
+}
+
+// PublicCity is a city listed on the public site, with its live group count.
+type PublicCity struct {
+	Slug       string `db:"slug" json:"slug"`
+	NameFa     string `db:"name_fa" json:"name_fa"`
+	GroupCount int    `db:"group_count" json:"group_count"`
 }
 
 type StorySlide struct {
-	ID              int             `db:"id" json:"id"`
-	GroupID         int             `db:"group_id" json:"group_id"`
-	ImageURL        string          `db:"image_url" json:"image_url"`
-	ThumbnailURL    *string         `db:"thumbnail_url" json:"thumbnail_url"`
-	CaptionFa       string          `db:"caption_fa" json:"caption_fa"`
-	Elements        json.RawMessage `db:"elements" json:"elements"` // JSONB
-	SortOrder       int             `db:"sort_order" json:"sort_order"`
-	OpenCount       int             `db:"open_count" json:"open_count"`
-	Duration        int             `db:"duration" json:"duration"`
-	BackgroundColor *string         `db:"background_color" json:"background_color"`
-	CreatedAt       time.Time       `db:"created_at" json:"created_at"`
+	ID               int             `db:"id" json:"id"`
+	GroupID          int             `db:"group_id" json:"group_id"`
+	ImageURL         string          `db:"image_url" json:"image_url"`
+	ThumbnailURL     *string         `db:"thumbnail_url" json:"thumbnail_url"`
+	PreviewURL       *string         `db:"preview_url" json:"preview_url"`
+	ImageWebPURL     *string         `db:"image_webp_url" json:"image_webp_url,omitempty"` // WebP copies of the above, if made
+	ThumbnailWebPURL *string         `db:"thumbnail_webp_url" json:"thumbnail_webp_url,omitempty"`
+	PreviewWebPURL   *string         `db:"preview_webp_url" json:"preview_webp_url,omitempty"`
+	MediaType        string          `db:"media_type" json:"media_type"` // image, video or color
+	VideoURL         *string         `db:"video_url" json:"video_url"`
+	CaptionFa        string          `db:"caption_fa" json:"caption_fa"`
+	Elements         json.RawMessage `db:"elements" json:"elements"` // JSONB
+	SortOrder        int             `db:"sort_order" json:"sort_order"`
+	OpenCount        int             `db:"open_count" json:"open_count"`
+	Duration         int             `db:"duration" json:"duration"`
+	BackgroundColor  *string         `db:"background_color" json:"background_color"`
+	HotelSlugs       pq.StringArray  `db:"hotel_slugs" json:"hotel_slugs"` // if set, shown only on these hotel pages
+	CreatedAt        time.Time       `db:"created_at" json:"created_at"`
 }
 
 type DashboardStats struct {
@@ -48,3 +239,89 @@ type DashboardStats struct {
 	TotalViews   int `json:"total_views"`
 	TotalCities  int `json:"total_cities"`
 }
+
+// GroupAnalytics is the per-session watch report for one story group.
+type GroupAnalytics struct {
+	GroupID         int              `json:"group_id"`
+	From            time.Time        `json:"from"`
+	To              time.Time        `json:"to"`
+	Impressions     int              `json:"impressions"`
+	Opens           int              `json:"opens"`
+	CTR             float64          `json:"ctr"` // opens / impressions, percent
+	Sessions        int              `json:"sessions"`
+	AvgSlidesViewed float64          `json:"avg_slides_viewed"`
+	AvgWatchMs      float64          `json:"avg_watch_ms"`
+	Slides          []SlideAnalytics `json:"slides"`
+}
+
+type SlideAnalytics struct {
+	SlideID        int     `db:"slide_id" json:"slide_id"`
+	Position       int     `db:"-" json:"position"` // 1-based, by sort_order
+	Views          int     `db:"views" json:"views"`
+	Reach          int     `db:"reach" json:"reach"` // distinct sessions that saw the slide
+	Completions    int     `db:"completions" json:"completions"`
+	CompletionRate float64 `db:"-" json:"completion_rate"` // completions / reach, percent
+	Exits          int     `db:"exits" json:"exits"`
+	AvgWatchMs     float64 `db:"avg_watch_ms" json:"avg_watch_ms"`
+	// DropOff is the percentage of sessions that reached the previous slide
+	// but not this one.
+	DropOff float64       `db:"-" json:"drop_off"`
+	Polls   []PollResults `db:"-" json:"polls,omitempty"`
+}
+
+// PollResults are the votes on one poll element.
+type PollResults struct {
+	SlideID   int          `json:"slide_id"`
+	ElementID string       `json:"element_id"`
+	Question  string       `json:"question"`
+	Total     int          `json:"total"`
+	Options   []PollOption `json:"options"`
+}
+
+type PollOption struct {
+	Text    string  `json:"text"`
+	Votes   int     `json:"votes"`
+	Percent float64 `json:"percent"` // of all votes on the poll
+}
+
+// QuizResults are the answers to one quiz element.
+type QuizResults struct {
+	SlideID        int          `json:"slide_id"`
+	Position       int          `json:"position"` // the slide's, 1-based
+	ElementID      string       `json:"element_id"`
+	Question       string       `json:"question"`
+	Total          int          `json:"total"`
+	CorrectAnswers int          `json:"correct_answers"`
+	PercentCorrect float64      `json:"percent_correct"`
+	Options        []QuizOption `json:"options"`
+}
+
+type QuizOption struct {
+	Text    string  `json:"text"`
+	Correct bool    `json:"correct"`
+	Answers int     `json:"answers"`
+	Percent float64 `json:"percent"` // of all answers to the quiz
+}
+
+// SliderResults summarise the responses to one emoji slider.
+type SliderResults struct {
+	SlideID   int     `json:"slide_id"`
+	Position  int     `json:"position"` // the slide's, 1-based
+	ElementID string  `json:"element_id"`
+	Emoji     string  `json:"emoji"`
+	Count     int     `json:"count"`
+	Average   float64 `json:"average"`
+	// Histogram counts responses in ten buckets: 0–9, 10–19, … 90–100.
+	Histogram []int `json:"histogram"`
+}
+
+// TimeSeriesPoint is one hourly or daily bucket of rolled-up story metrics.
+type TimeSeriesPoint struct {
+	Bucket      time.Time `db:"bucket" json:"bucket"`
+	Impressions int       `db:"impressions" json:"impressions"`
+	Opens       int       `db:"opens" json:"opens"`
+	CTR         float64   `db:"-" json:"ctr"` // opens / impressions, percent
+	SlideViews  int       `db:"slide_views" json:"slide_views"`
+	Completions int       `db:"completions" json:"completions"`
+	LinkClicks  int       `db:"link_clicks" json:"link_clicks"`
+}
@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often idle buckets are dropped from memory.
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   Limit
+}
+
+// Memory keeps buckets in this process. Buckets that have refilled are
+// forgotten, since a new one starts full anyway.
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{buckets: make(map[string]*bucket), lastSweep: time.Now()}
+}
+
+func (m *Memory) Take(_ context.Context, key string, l Limit) (bool, time.Duration, error) {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.lastSweep) >= sweepInterval {
+		for k, b := range m.buckets {
+			if b.refill(now) >= float64(b.limit.Burst) {
+				delete(m.buckets, k)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.Burst), updated: now}
+		m.buckets[key] = b
+	}
+	b.limit = l
+	b.tokens = b.refill(now)
+	b.updated = now
+
+	if b.tokens < 1 {
+		return false, retryAfter(b.tokens, l), nil
+	}
+	b.tokens--
+	return true, 0, nil
+}
+
+// refill returns the tokens the bucket holds at now.
+func (b *bucket) refill(now time.Time) float64 {
+	return min(float64(b.limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*b.limit.Rate)
+}
@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Postgres keeps buckets in the rate_limits table so all replicas share
+// them. Each Take is a single upsert, so concurrent requests can't both take
+// the last token.
+type Postgres struct {
+	db *sqlx.DB
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+func NewPostgres(db *sqlx.DB) *Postgres {
+	return &Postgres{db: db, lastSweep: time.Now()}
+}
+
+func (p *Postgres) Take(ctx context.Context, key string, l Limit) (bool, time.Duration, error) {
+	p.sweep(ctx)
+
+	var row struct {
+		Tokens  float64 `db:"tokens"`
+		Allowed bool    `db:"allowed"`
+	}
+	// $2 is the refill rate and $3 the burst. A new bucket starts full; an
+	// existing one is refilled for the time since its last use first.
+	err := p.db.GetContext(ctx, &row, `
+		INSERT INTO rate_limits (key, tokens, allowed, updated_at)
+		VALUES ($1, $3 - 1, TRUE, NOW())
+		ON CONFLICT (key) DO UPDATE SET
+			tokens = CASE
+				WHEN LEAST($3, rate_limits.tokens + EXTRACT(EPOCH FROM NOW() - rate_limits.updated_at) * $2) >= 1
+				THEN LEAST($3, rate_limits.tokens + EXTRACT(EPOCH FROM NOW() - rate_limits.updated_at) * $2) - 1
+				ELSE LEAST($3, rate_limits.tokens + EXTRACT(EPOCH FROM NOW() - rate_limits.updated_at) * $2)
+			END,
+			allowed = LEAST($3, rate_limits.tokens + EXTRACT(EPOCH FROM NOW() - rate_limits.updated_at) * $2) >= 1,
+			updated_at = NOW()
+		RETURNING tokens, allowed`, key, l.Rate, float64(l.Burst))
+	if err != nil {
+		return true, 0, err
+	}
+	if !row.Allowed {
+		return false, retryAfter(row.Tokens, l), nil
+	}
+	return true, 0, nil
+}
+
+// sweep occasionally deletes buckets untouched for a day; any of them would
+// have refilled long ago.
+func (p *Postgres) sweep(ctx context.Context) {
+	p.mu.Lock()
+	due := time.Since(p.lastSweep) >= sweepInterval
+	if due {
+		p.lastSweep = time.Now()
+	}
+	p.mu.Unlock()
+	if due {
+		p.db.ExecContext(ctx, "DELETE FROM rate_limits WHERE updated_at < NOW() - INTERVAL '1 day'")
+	}
+}
@@ -0,0 +1,58 @@
+// Package ratelimit implements token-bucket rate limits keyed by arbitrary
+// strings (an IP, an account), kept in memory or in Postgres when several
+// replicas must share them.
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Limit is a token bucket: Burst requests at once, refilled at Rate per
+// second.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerMinute allows n requests a minute, all of which may come at once.
+func PerMinute(n int) Limit {
+	return Limit{Rate: float64(n) / 60, Burst: n}
+}
+
+// Store takes tokens from buckets.
+type Store interface {
+	// Take removes one token from key's bucket. When the bucket is empty it
+	// reports false and how long until a token is available.
+	Take(ctx context.Context, key string, l Limit) (bool, time.Duration, error)
+}
+
+// Default is the store used by the rate-limit middleware, selected by Init.
+var Default Store = NewMemory()
+
+// Init selects the backend from RATE_LIMIT_BACKEND: "memory" (the default)
+// limits each process on its own, "postgres" shares buckets between
+// replicas through the rate_limits table.
+func Init(db *sqlx.DB) {
+	switch backend := os.Getenv("RATE_LIMIT_BACKEND"); backend {
+	case "", "memory":
+		Default = NewMemory()
+	case "postgres":
+		Default = NewPostgres(db)
+		log.Println("Rate limits: shared in Postgres")
+	default:
+		log.Fatalln("Unknown RATE_LIMIT_BACKEND:", backend)
+	}
+}
+
+// retryAfter is how long until a bucket holding tokens has one again.
+func retryAfter(tokens float64, l Limit) time.Duration {
+	if l.Rate <= 0 {
+		return time.Hour
+	}
+	return time.Duration((1 - tokens) / l.Rate * float64(time.Second))
+}
@@ -0,0 +1,160 @@
+package rollup
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"hotel-story-panel/backend/internal/timeutil"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// lockKey serializes aggregation passes across server replicas.
+const lockKey = 720_302
+
+// lateWindow is always recomputed, so events that reach the table slightly
+// out of order (several replicas flushing) still land in their bucket.
+const lateWindow = 2 * time.Hour
+
+var (
+	stop chan struct{}
+	wg   sync.WaitGroup
+)
+
+// Start runs the aggregator in the background every ROLLUP_INTERVAL
+// (default 1m) until Stop is called.
+func Start(db *sqlx.DB) {
+	interval := time.Minute
+	if v, err := time.ParseDuration(os.Getenv("ROLLUP_INTERVAL")); err == nil && v > 0 {
+		interval = v
+	}
+
+	stop = make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := Run(db); err != nil {
+				log.Println("Rollup: aggregation failed:", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop waits for the current pass to finish and stops the aggregator.
+func Stop() {
+	if stop != nil {
+		close(stop)
+		wg.Wait()
+	}
+}
+
+// Run folds story_events added since the last pass into the hourly and daily
+// rollups. Affected buckets are recomputed from scratch, so running it
+// repeatedly is safe.
+func Run(db *sqlx.DB) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.Get(&locked, "SELECT pg_try_advisory_xact_lock($1)", lockKey); err != nil {
+		return err
+	}
+	if !locked {
+		return nil // another replica is aggregating
+	}
+
+	if _, err := tx.Exec("INSERT INTO rollup_state (name) VALUES ('story_stats') ON CONFLICT DO NOTHING"); err != nil {
+		return err
+	}
+	var lastID int64
+	if err := tx.Get(&lastID, "SELECT last_event_id FROM rollup_state WHERE name = 'story_stats'"); err != nil {
+		return err
+	}
+
+	var pending struct {
+		MaxID    int64        `db:"max_id"`
+		Earliest sql.NullTime `db:"earliest"`
+	}
+	err = tx.Get(&pending, "SELECT COALESCE(MAX(id), 0) AS max_id, MIN(occurred_at) AS earliest FROM story_events WHERE id > $1", lastID)
+	if err != nil {
+		return err
+	}
+	if pending.MaxID == 0 {
+		return nil
+	}
+
+	since := time.Now().Add(-lateWindow)
+	if pending.Earliest.Valid && pending.Earliest.Time.Before(since) {
+		since = pending.Earliest.Time
+	}
+	since = timeutil.StartOfHour(since)
+	sinceDay := timeutil.StartOfDay(since)
+
+	_, err = tx.Exec(`
+		INSERT INTO story_stats_hourly (bucket, group_id, city_slug, impressions, opens, slide_views, completions, link_clicks)
+		SELECT
+			date_trunc('hour', e.occurred_at AT TIME ZONE 'Asia/Tehran') AT TIME ZONE 'Asia/Tehran' AS bucket,
+			e.group_id,
+			COALESCE(g.city_slug, ''),
+			COUNT(*) FILTER (WHERE e.event_type = 'impression'),
+			COUNT(*) FILTER (WHERE e.event_type = 'group_open'),
+			COUNT(*) FILTER (WHERE e.event_type = 'slide_view'),
+			COUNT(*) FILTER (WHERE e.event_type = 'slide_complete'),
+			COUNT(*) FILTER (WHERE e.event_type = 'link_click')
+		FROM story_events e
+		LEFT JOIN story_groups g ON g.id = e.group_id
+		WHERE e.group_id IS NOT NULL AND e.occurred_at >= $1 AND e.id <= $2
+		GROUP BY 1, 2, 3
+		ON CONFLICT (bucket, group_id) DO UPDATE SET
+			city_slug = EXCLUDED.city_slug,
+			impressions = EXCLUDED.impressions,
+			opens = EXCLUDED.opens,
+			slide_views = EXCLUDED.slide_views,
+			completions = EXCLUDED.completions,
+			link_clicks = EXCLUDED.link_clicks`, since, pending.MaxID)
+	if err != nil {
+		return err
+	}
+
+	// Tehran hours nest inside Tehran days, so days are summed from hours
+	_, err = tx.Exec(`
+		INSERT INTO story_stats_daily (day, group_id, city_slug, impressions, opens, slide_views, completions, link_clicks)
+		SELECT
+			(bucket AT TIME ZONE 'Asia/Tehran')::date AS day,
+			group_id,
+			MAX(city_slug),
+			SUM(impressions), SUM(opens), SUM(slide_views), SUM(completions), SUM(link_clicks)
+		FROM story_stats_hourly
+		WHERE bucket >= $1
+		GROUP BY 1, 2
+		ON CONFLICT (day, group_id) DO UPDATE SET
+			city_slug = EXCLUDED.city_slug,
+			impressions = EXCLUDED.impressions,
+			opens = EXCLUDED.opens,
+			slide_views = EXCLUDED.slide_views,
+			completions = EXCLUDED.completions,
+			link_clicks = EXCLUDED.link_clicks`, sinceDay)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE rollup_state SET last_event_id = $1, updated_at = NOW() WHERE name = 'story_stats'", pending.MaxID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,110 @@
+package scheduler
+
+import (
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"hotel-story-panel/backend/internal/models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// lockKey keeps a single replica announcing transitions.
+const lockKey = 720_303
+
+var (
+	stop chan struct{}
+	wg   sync.WaitGroup
+)
+
+// Start checks publishing windows every SCHEDULER_INTERVAL (default 30s).
+// Visibility itself never waits on the scheduler: GetPublicStories filters
+// by the window directly. The scheduler only records and logs transitions.
+func Start(db *sqlx.DB) {
+	interval := 30 * time.Second
+	if v, err := time.ParseDuration(os.Getenv("SCHEDULER_INTERVAL")); err == nil && v > 0 {
+		interval = v
+	}
+
+	stop = make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := Run(db, time.Now()); err != nil {
+				log.Println("Scheduler: run failed:", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func Stop() {
+	if stop != nil {
+		close(stop)
+		wg.Wait()
+	}
+}
+
+// transitionEvents names the event emitted when a group enters a state.
+var transitionEvents = map[string]string{
+	models.GroupScheduled: "scheduled",
+	models.GroupLive:      "activated",
+	models.GroupExpired:   "expired",
+}
+
+// Run compares each group's window state with the last one announced and
+// emits an activation/expiry event for every change.
+func Run(db *sqlx.DB, now time.Time) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.Get(&locked, "SELECT pg_try_advisory_xact_lock($1)", lockKey); err != nil {
+		return err
+	}
+	if !locked {
+		return nil
+	}
+
+	var groups []struct {
+		models.StoryGroup
+		ScheduleState string `db:"schedule_state"`
+	}
+	err = tx.Select(&groups, `
+		SELECT id, COALESCE(title_fa, '') AS title_fa, active, starts_at, ends_at, schedule_state
+		FROM story_groups
+		WHERE starts_at IS NOT NULL OR ends_at IS NOT NULL OR schedule_state <> $1`, models.GroupLive)
+	if err != nil {
+		return err
+	}
+
+	for _, g := range groups {
+		state := g.WindowState(now)
+		if state == g.ScheduleState {
+			continue
+		}
+
+		if _, err := tx.Exec("UPDATE story_groups SET schedule_state = $1 WHERE id = $2", state, g.ID); err != nil {
+			return err
+		}
+		event := transitionEvents[state]
+		if _, err := tx.Exec("INSERT INTO story_group_schedule_events (group_id, event, occurred_at) VALUES ($1, $2, $3)", g.ID, event, now); err != nil {
+			return err
+		}
+		log.Printf("Scheduler: group %d (%s) %s", g.ID, g.TitleFa, event)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,318 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testBucket    = "media"
+	testAccessKey = "AKIDEXAMPLE"
+	testSecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	testRegion    = "ir-thr-at1"
+)
+
+// fakeS3 is a bucket that checks each request's SigV4 signature the way S3
+// does, from what actually arrived on the wire.
+type fakeS3 struct {
+	t         *testing.T
+	pathStyle bool
+
+	mu       sync.Mutex
+	objects  map[string][]byte
+	types    map[string]string
+	requests []string // "METHOD key"
+}
+
+func newFakeS3(t *testing.T, pathStyle bool) *fakeS3 {
+	return &fakeS3{t: t, pathStyle: pathStyle, objects: map[string][]byte{}, types: map[string]string{}}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if msg := f.checkSignature(r); msg != "" {
+		f.t.Errorf("%s %s: %s", r.Method, r.URL.Path, msg)
+		http.Error(w, msg, http.StatusForbidden)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	if f.pathStyle {
+		if !strings.HasPrefix(key, testBucket+"/") {
+			http.Error(w, "no bucket in path", http.StatusBadRequest)
+			return
+		}
+		key = strings.TrimPrefix(key, testBucket+"/")
+	} else if host, _, _ := net.SplitHostPort(r.Host); !strings.HasPrefix(host, testBucket+".") {
+		http.Error(w, "no bucket in host "+r.Host, http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r.Method+" "+key)
+
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.ContentLength != int64(len(data)) {
+			http.Error(w, "content length mismatch", http.StatusBadRequest)
+			return
+		}
+		f.objects[key] = data
+		f.types[key] = r.Header.Get("Content-Type")
+	case http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case http.MethodDelete:
+		if _, ok := f.objects[key]; !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unexpected method", http.StatusMethodNotAllowed)
+	}
+}
+
+// checkSignature returns what is wrong with the request's signature, or "".
+func (f *fakeS3) checkSignature(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	const prefix = "AWS4-HMAC-SHA256 "
+	if !strings.HasPrefix(auth, prefix) {
+		return "missing AWS4-HMAC-SHA256 authorization"
+	}
+	fields := map[string]string{}
+	for _, part := range strings.Split(strings.TrimPrefix(auth, prefix), ", ") {
+		name, value, _ := strings.Cut(part, "=")
+		fields[name] = value
+	}
+
+	amzDate := r.Header.Get("X-Amz-Date")
+	when, err := time.Parse("20060102T150405Z", amzDate)
+	if err != nil {
+		return "bad X-Amz-Date " + amzDate
+	}
+	if d := time.Since(when); d < -time.Minute || d > time.Minute {
+		return "X-Amz-Date is not now"
+	}
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash != "UNSIGNED-PAYLOAD" {
+		return "unexpected X-Amz-Content-Sha256 " + payloadHash
+	}
+
+	scope := when.Format("20060102") + "/" + testRegion + "/s3/aws4_request"
+	if want := testAccessKey + "/" + scope; fields["Credential"] != want {
+		return "credential " + fields["Credential"] + ", want " + want
+	}
+
+	signed := strings.Split(fields["SignedHeaders"], ";")
+	if !sort.StringsAreSorted(signed) {
+		return "signed headers are not sorted"
+	}
+	for _, required := range []string{"host", "x-amz-content-sha256", "x-amz-date"} {
+		if !contains(signed, required) {
+			return required + " is not signed"
+		}
+	}
+	if r.Header.Get("Content-Type") != "" && !contains(signed, "content-type") {
+		return "content-type is not signed"
+	}
+
+	var canonicalHeaders strings.Builder
+	for _, name := range signed {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		awsEscapePath(r.URL.Path), // S3 re-encodes the path it received
+		r.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		fields["SignedHeaders"],
+		payloadHash,
+	}, "\n")
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	key := hmacSHA256([]byte("AWS4"+testSecretKey), when.Format("20060102"))
+	key = hmacSHA256(key, testRegion)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	if want := hex.EncodeToString(hmacSHA256(key, stringToSign)); fields["Signature"] != want {
+		return "signature does not match"
+	}
+	return ""
+}
+
+// awsEscapePath encodes each path segment as S3 does when it builds the
+// canonical request: everything but unreserved characters.
+func awsEscapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		segments[i] = strings.ReplaceAll(url.QueryEscape(seg), "+", "%20")
+	}
+	return strings.Join(segments, "/")
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// newTestS3 points an S3 store at a fake bucket. Virtual-host requests go to
+// bucket.127.0.0.1, which is dialed as the server itself.
+func newTestS3(t *testing.T, pathStyle bool) (*S3, *fakeS3) {
+	fake := newFakeS3(t, pathStyle)
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	s, err := NewS3(S3Config{
+		Endpoint:     srv.URL,
+		Region:       testRegion,
+		Bucket:       testBucket,
+		AccessKey:    testAccessKey,
+		SecretKey:    testSecretKey,
+		UsePathStyle: pathStyle,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := srv.Listener.Addr().String()
+	s.client = &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+	return s, fake
+}
+
+func TestS3PutGetDelete(t *testing.T) {
+	for _, pathStyle := range []bool{true, false} {
+		name := "virtual-host"
+		if pathStyle {
+			name = "path-style"
+		}
+		t.Run(name, func(t *testing.T) {
+			s, fake := newTestS3(t, pathStyle)
+			ctx := context.Background()
+			key := "slides/a b+c.jpg" // escaped in the path, and signed that way
+			body := "jpeg bytes"
+
+			if err := s.Put(ctx, key, strings.NewReader(body), int64(len(body)), "image/jpeg"); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			if got := fake.types[key]; got != "image/jpeg" {
+				t.Errorf("stored content type %q, want image/jpeg", got)
+			}
+
+			rc, err := s.Get(ctx, key)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			data, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil || string(data) != body {
+				t.Fatalf("Get returned %q, %v; want %q", data, err, body)
+			}
+
+			if err := s.Delete(ctx, key); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			if _, err := s.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get after Delete: %v, want ErrNotFound", err)
+			}
+			if err := s.Delete(ctx, key); err != nil {
+				t.Errorf("Delete of a missing key: %v, want nil", err)
+			}
+
+			want := []string{"PUT " + key, "GET " + key, "DELETE " + key, "GET " + key, "DELETE " + key}
+			if strings.Join(fake.requests, "|") != strings.Join(want, "|") {
+				t.Errorf("requests %q, want %q", fake.requests, want)
+			}
+		})
+	}
+}
+
+func TestS3RejectedRequest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	s, err := NewS3(S3Config{Endpoint: srv.URL, Bucket: testBucket, AccessKey: testAccessKey, SecretKey: testSecretKey, UsePathStyle: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Put(context.Background(), "x.jpg", strings.NewReader("x"), 1, "image/jpeg")
+	if err == nil || !strings.Contains(err.Error(), "AccessDenied") {
+		t.Errorf("Put error %v, want one mentioning AccessDenied", err)
+	}
+}
+
+func TestS3URL(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  S3Config
+		want string
+	}{
+		{
+			name: "path-style",
+			cfg:  S3Config{Endpoint: "http://localhost:9000/", UsePathStyle: true},
+			want: "http://localhost:9000/media/slides/a.jpg",
+		},
+		{
+			name: "virtual-host",
+			cfg:  S3Config{Endpoint: "https://s3.ir-thr-at1.arvanstorage.ir"},
+			want: "https://media.s3.ir-thr-at1.arvanstorage.ir/slides/a.jpg",
+		},
+		{
+			name: "public URL",
+			cfg:  S3Config{Endpoint: "https://s3.ir-thr-at1.arvanstorage.ir", PublicURL: "https://cdn.example.com/"},
+			want: "https://cdn.example.com/slides/a.jpg",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Bucket, tt.cfg.AccessKey, tt.cfg.SecretKey = testBucket, testAccessKey, testSecretKey
+			s, err := NewS3(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.URL("slides/a.jpg"); got != tt.want {
+				t.Errorf("URL = %q, want %q", got, tt.want)
+			}
+			if _, err := url.Parse(s.URL("slides/a.jpg")); err != nil {
+				t.Errorf("URL does not parse: %v", err)
+			}
+		})
+	}
+}
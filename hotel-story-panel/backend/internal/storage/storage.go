@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+)
+
+// ErrNotFound is returned by Get when the key does not exist in the store.
+var ErrNotFound = errors.New("storage: object not found")
+
+// Store persists uploaded media under flat keys such as "1771397301430679000_story.jpg".
+type Store interface {
+	// Put writes size bytes from r under key. A negative size means unknown.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	// URL returns the public URL clients should use to fetch key.
+	URL(key string) string
+}
+
+// Media is the store used by the upload handlers, selected by InitStorage.
+var Media Store
+
+// InitStorage selects the backend from STORAGE_BACKEND ("local" or "s3").
+func InitStorage() {
+	switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+	case "", "local":
+		dir := os.Getenv("UPLOAD_DIR")
+		if dir == "" {
+			dir = "./uploads"
+		}
+		Media = NewLocal(dir, "/uploads")
+		log.Println("Media storage: local disk at", dir)
+
+	case "s3":
+		s3, err := NewS3(S3Config{
+			Endpoint:     os.Getenv("S3_ENDPOINT"),
+			Region:       os.Getenv("S3_REGION"),
+			Bucket:       os.Getenv("S3_BUCKET"),
+			AccessKey:    os.Getenv("S3_ACCESS_KEY"),
+			SecretKey:    os.Getenv("S3_SECRET_KEY"),
+			PublicURL:    os.Getenv("S3_PUBLIC_URL"),
+			UsePathStyle: os.Getenv("S3_USE_PATH_STYLE") == "true",
+		})
+		if err != nil {
+			log.Fatalln("Failed to configure S3 storage:", err)
+		}
+		Media = s3
+		log.Println("Media storage: S3 bucket", s3.cfg.Bucket)
+
+	default:
+		log.Fatalln("Unknown STORAGE_BACKEND:", backend)
+	}
+}
+
+// IsLocal reports whether Media is served from the local disk, in which case
+// the server exposes it under /uploads itself.
+func IsLocal() (*Local, bool) {
+	l, ok := Media.(*Local)
+	return l, ok
+}
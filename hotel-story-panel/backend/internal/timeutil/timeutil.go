@@ -0,0 +1,68 @@
+package timeutil
+
+import (
+	"fmt"
+	"time"
+	// Embed the zone database so Asia/Tehran resolves on minimal hosts
+	_ "time/tzdata"
+)
+
+// Tehran is the business time zone: reporting days and campaign windows
+// follow Iranian local time.
+var Tehran = mustLoad("Asia/Tehran")
+
+func mustLoad(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+// StartOfDay returns local midnight of t's day in Tehran.
+func StartOfDay(t time.Time) time.Time {
+	t = t.In(Tehran)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, Tehran)
+}
+
+// StartOfHour returns the start of t's hour on the Tehran wall clock. Unlike
+// t.Truncate(time.Hour) it respects Tehran's half-hour UTC offset.
+func StartOfHour(t time.Time) time.Time {
+	t = t.In(Tehran)
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, Tehran)
+}
+
+// Jalali returns the Solar Hijri (Jalali) date of t's day in Tehran.
+func Jalali(t time.Time) (year, month, day int) {
+	t = t.In(Tehran)
+	gy, gm, gd := t.Year(), int(t.Month()), t.Day()
+
+	// Days since the Jalali epoch, counted through the Gregorian calendar
+	monthDays := [12]int{0, 31, 59, 90, 120, 151, 181, 212, 243, 273, 304, 334}
+	gy2 := gy
+	if gm > 2 {
+		gy2++
+	}
+	days := 355666 + 365*gy + (gy2+3)/4 - (gy2+99)/100 + (gy2+399)/400 + gd + monthDays[gm-1]
+
+	year = -1595 + 33*(days/12053)
+	days %= 12053
+	year += 4 * (days / 1461)
+	days %= 1461
+	if days > 365 {
+		year += (days - 1) / 365
+		days = (days - 1) % 365
+	}
+	if days < 186 {
+		return year, 1 + days/31, 1 + days%31
+	}
+	return year, 7 + (days-186)/30, 1 + (days-186)%30
+}
+
+// FormatJalali formats t as a Jalali date and Tehran wall-clock time,
+// e.g. "1405/07/25 18:30".
+func FormatJalali(t time.Time) string {
+	y, m, d := Jalali(t)
+	t = t.In(Tehran)
+	return fmt.Sprintf("%04d/%02d/%02d %02d:%02d", y, m, d, t.Hour(), t.Minute())
+}
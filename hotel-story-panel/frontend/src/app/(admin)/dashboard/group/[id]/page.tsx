@@ -2,10 +2,10 @@
 
 import { useEffect, useState } from "react";
 import { useParams, useRouter } from "next/navigation";
-import { ArrowRight, Trash2, Pencil, Plus, LayoutGrid, Eye, Clock, ChevronLeft } from "lucide-react";
+import { ArrowRight, Trash2, Pencil, Plus, LayoutGrid, Eye, Clock, ChevronLeft, Send, History, RotateCcw, CheckCircle2, XCircle, Undo2, MessageSquare } from "lucide-react";
 import Link from "next/link";
 import StoryBuilder from "@/components/story-builder";
-import { apiRequest } from "@/lib/api";
+import { apiRequest, mediaUrl, uploadErrorMessage } from "@/lib/api";
 
 interface Slide {
     id: number;
@@ -17,6 +17,44 @@ interface Slide {
     background_color?: string;
 }
 
+interface GroupVersion {
+    version: number;
+    published_by_email: string | null;
+    published_at: string;
+    restored_from: number | null;
+    slide_count: number;
+    current: boolean;
+}
+
+interface GroupComment {
+    id: number;
+    slide_id: number | null;
+    user_email: string | null;
+    body: string;
+    transition: 'submit' | 'withdraw' | 'approve' | 'reject' | null;
+    created_at: string;
+}
+
+interface Reviewer {
+    id: number;
+    email: string;
+}
+
+const reviewBadges: Record<string, { label: string; className: string }> = {
+    draft: { label: 'پیش‌نویس', className: 'bg-slate-100 text-slate-500' },
+    in_review: { label: 'در انتظار بازبینی', className: 'bg-blue-50 text-blue-600' },
+    approved: { label: 'تأیید شده', className: 'bg-emerald-50 text-emerald-600' },
+    rejected: { label: 'رد شده', className: 'bg-rose-50 text-rose-600' },
+    published: { label: 'منتشر شده', className: 'bg-emerald-50 text-emerald-600' },
+};
+
+const transitionLabels: Record<string, string> = {
+    submit: 'برای بازبینی فرستاد',
+    withdraw: 'از بازبینی خارج کرد',
+    approve: 'تأیید کرد',
+    reject: 'رد کرد',
+};
+
 export default function GroupDetails() {
     const { id } = useParams();
     const router = useRouter();
@@ -25,6 +63,19 @@ export default function GroupDetails() {
     const [uploading, setUploading] = useState(false);
     const [showBuilder, setShowBuilder] = useState(false);
     const [editingSlide, setEditingSlide] = useState<Slide | null>(null);
+    const [publishedVersion, setPublishedVersion] = useState<number | null>(null);
+    const [hasDraftChanges, setHasDraftChanges] = useState(false);
+    const [versions, setVersions] = useState<GroupVersion[]>([]);
+    const [publishing, setPublishing] = useState(false);
+    const [reviewState, setReviewState] = useState("draft");
+    const [reviewerId, setReviewerId] = useState<number | null>(null);
+    const [reviewers, setReviewers] = useState<Reviewer[]>([]);
+    const [comments, setComments] = useState<GroupComment[]>([]);
+    const [newComment, setNewComment] = useState("");
+    const [commentSlide, setCommentSlide] = useState<number | null>(null);
+    const [role, setRole] = useState("");
+    const canEdit = role === 'owner' || role === 'editor';
+    const canReview = role === 'owner' || role === 'reviewer';
 
     const fetchGroupData = async () => {
         try {
@@ -32,7 +83,13 @@ export default function GroupDetails() {
             if (group) {
                 setSlides(group.slides || []);
                 setGroupTitle(group.title_fa);
+                setPublishedVersion(group.published_version);
+                setHasDraftChanges(group.has_draft_changes);
+                setReviewState(group.review_state);
+                setReviewerId(group.reviewer_id ?? null);
             }
+            setVersions(await apiRequest(`/admin/story-groups/${id}/versions`));
+            setComments(await apiRequest(`/admin/story-groups/${id}/comments`));
         } catch (err: any) {
             console.error(err);
             if (err.message.includes('401')) {
@@ -48,7 +105,12 @@ export default function GroupDetails() {
             router.push('/login');
             return;
         }
+        const currentRole = localStorage.getItem('role') || '';
+        setRole(currentRole);
         fetchGroupData();
+        if (currentRole === 'owner' || currentRole === 'editor') {
+            apiRequest('/admin/reviewers').then(setReviewers).catch(console.error);
+        }
     }, [id]);
 
     const handleUpload = async (imageBlob: Blob | null, elements: any[], duration: number, backgroundColor: string | null) => {
@@ -81,7 +143,8 @@ export default function GroupDetails() {
                 fetchGroupData();
                 alert(editingSlide ? 'اسلاید با موفقیت ویرایش شد' : 'اسلاید با موفقیت افزوده شد');
             } else {
-                alert('خطا در آپلود');
+                const data = await res.json().catch(() => ({}));
+                alert(uploadErrorMessage(data, 'خطا در آپلود'));
             }
         } catch (e) {
             console.error(e);
@@ -105,6 +168,75 @@ export default function GroupDetails() {
         }
     };
 
+    // Edits stay in the draft until published; customers see the published version
+    const handlePublish = async () => {
+        setPublishing(true);
+        try {
+            await apiRequest(`/admin/story-groups/${id}/publish`, { method: "POST" });
+            fetchGroupData();
+        } catch (err: any) {
+            alert(err.message || "خطا در انتشار");
+        } finally {
+            setPublishing(false);
+        }
+    };
+
+    const handleReview = async (action: 'submit' | 'withdraw' | 'approve' | 'reject') => {
+        let comment = "";
+        if (action === 'reject') {
+            const reason = prompt("دلیل رد و تغییرات لازم را بنویسید:");
+            if (!reason || !reason.trim()) return;
+            comment = reason;
+        }
+        try {
+            await apiRequest(`/admin/story-groups/${id}/${action}`, {
+                method: "POST",
+                body: JSON.stringify({ comment }),
+            });
+            fetchGroupData();
+        } catch (err: any) {
+            alert(err.message || "خطا در ثبت بازبینی");
+        }
+    };
+
+    const handleAssignReviewer = async (value: string) => {
+        const reviewer = value ? Number(value) : null;
+        try {
+            await apiRequest(`/admin/story-groups/${id}/reviewer`, {
+                method: "PUT",
+                body: JSON.stringify({ reviewer_id: reviewer }),
+            });
+            setReviewerId(reviewer);
+        } catch (err: any) {
+            alert(err.message || "خطا در تعیین بازبین");
+        }
+    };
+
+    const handleAddComment = async () => {
+        if (!newComment.trim()) return;
+        try {
+            await apiRequest(`/admin/story-groups/${id}/comments`, {
+                method: "POST",
+                body: JSON.stringify({ body: newComment, slide_id: commentSlide }),
+            });
+            setNewComment("");
+            setCommentSlide(null);
+            fetchGroupData();
+        } catch (err: any) {
+            alert(err.message || "خطا در ثبت نظر");
+        }
+    };
+
+    const handleRollback = async (version: number) => {
+        if (!confirm(`نسخه ${version.toLocaleString('fa-IR')} دوباره منتشر می‌شود و پیش‌نویس فعلی با آن جایگزین می‌شود. ادامه می‌دهید؟`)) return;
+        try {
+            await apiRequest(`/admin/story-groups/${id}/versions/${version}/rollback`, { method: "POST" });
+            fetchGroupData();
+        } catch (err: any) {
+            alert(err.message || "خطا در بازگردانی نسخه");
+        }
+    };
+
     const handleEditSlide = (slide: Slide) => {
         setEditingSlide(slide);
         setShowBuilder(true);
@@ -133,16 +265,72 @@ export default function GroupDetails() {
                     </div>
 
                     {!showBuilder && (
-                        <button
-                            onClick={() => {
-                                setEditingSlide(null);
-                                setShowBuilder(true);
-                            }}
-                            className="bg-red-600 hover:bg-red-700 text-white px-8 py-3.5 rounded-2xl font-black shadow-xl shadow-red-100 flex items-center justify-center gap-2 transition-all active:scale-95"
-                        >
-                            <Plus size={20} strokeWidth={3} />
-                            افزودن اسلاید جدید
-                        </button>
+                        <div className="flex flex-wrap items-center gap-3">
+                            <span className={`text-[10px] font-black px-3 py-1 rounded-full ${reviewBadges[reviewState]?.className}`}>
+                                {reviewBadges[reviewState]?.label}
+                                {publishedVersion !== null && ` · نسخه ${publishedVersion.toLocaleString('fa-IR')}`}
+                                {reviewState === 'published' && hasDraftChanges && ' · تغییرات منتشرنشده'}
+                            </span>
+                            {canEdit && ['draft', 'rejected', 'published'].includes(reviewState) && (
+                                <button
+                                    onClick={() => handleReview('submit')}
+                                    disabled={!hasDraftChanges || slides.length === 0}
+                                    className="bg-white border border-gray-200 hover:border-gray-900 disabled:opacity-40 text-gray-900 px-5 py-3.5 rounded-2xl font-black flex items-center justify-center gap-2 transition-all active:scale-95"
+                                >
+                                    <Send size={18} />
+                                    ارسال برای بازبینی
+                                </button>
+                            )}
+                            {canEdit && ['in_review', 'approved'].includes(reviewState) && (
+                                <button
+                                    onClick={() => handleReview('withdraw')}
+                                    className="bg-white border border-gray-200 hover:border-gray-900 text-gray-500 px-5 py-3.5 rounded-2xl font-black flex items-center justify-center gap-2 transition-all active:scale-95"
+                                >
+                                    <Undo2 size={18} />
+                                    لغو ارسال
+                                </button>
+                            )}
+                            {canReview && reviewState === 'in_review' && (
+                                <button
+                                    onClick={() => handleReview('approve')}
+                                    className="bg-emerald-600 hover:bg-emerald-700 text-white px-5 py-3.5 rounded-2xl font-black flex items-center justify-center gap-2 transition-all active:scale-95"
+                                >
+                                    <CheckCircle2 size={18} />
+                                    تأیید
+                                </button>
+                            )}
+                            {canReview && ['in_review', 'approved'].includes(reviewState) && (
+                                <button
+                                    onClick={() => handleReview('reject')}
+                                    className="bg-rose-600 hover:bg-rose-700 text-white px-5 py-3.5 rounded-2xl font-black flex items-center justify-center gap-2 transition-all active:scale-95"
+                                >
+                                    <XCircle size={18} />
+                                    رد
+                                </button>
+                            )}
+                            {canEdit && reviewState === 'approved' && (
+                                <button
+                                    onClick={handlePublish}
+                                    disabled={publishing}
+                                    className="bg-slate-900 hover:bg-black disabled:opacity-40 text-white px-6 py-3.5 rounded-2xl font-black flex items-center justify-center gap-2 transition-all active:scale-95"
+                                >
+                                    <Send size={18} />
+                                    {publishing ? 'در حال انتشار...' : 'انتشار'}
+                                </button>
+                            )}
+                            {canEdit && (
+                                <button
+                                    onClick={() => {
+                                        setEditingSlide(null);
+                                        setShowBuilder(true);
+                                    }}
+                                    className="bg-red-600 hover:bg-red-700 text-white px-8 py-3.5 rounded-2xl font-black shadow-xl shadow-red-100 flex items-center justify-center gap-2 transition-all active:scale-95"
+                                >
+                                    <Plus size={20} strokeWidth={3} />
+                                    افزودن اسلاید جدید
+                                </button>
+                            )}
+                        </div>
                     )}
                 </div>
 
@@ -197,7 +385,7 @@ export default function GroupDetails() {
                                     </div>
                                     <div
                                         className="relative aspect-[9/16] rounded-[32px] overflow-hidden bg-gray-200 border-4 border-white shadow-xl shadow-gray-200/50 group-hover:shadow-red-200/60 transition-all group-hover:-translate-y-2 group-hover:scale-[1.02] bg-cover bg-center"
-                                        style={slide.image_url ? { backgroundImage: `url(http://localhost:8080${slide.image_url})` } : { backgroundColor: slide.background_color || '#eee' }}
+                                        style={slide.image_url ? { backgroundImage: `url(${mediaUrl(slide.image_url)})` } : { backgroundColor: slide.background_color || '#eee' }}
                                     >
                                         <div className="absolute inset-0 bg-gradient-to-t from-black/80 via-transparent opacity-0 group-hover:opacity-100 transition-all duration-300 flex flex-col items-center justify-end p-6 gap-3">
                                             <div className="flex gap-2 mb-4">
@@ -235,6 +423,115 @@ export default function GroupDetails() {
                         )}
                     </div>
                 )}
+
+                {!showBuilder && (
+                    <div className="mt-12 bg-white rounded-[32px] border border-gray-100 p-8">
+                        <div className="flex flex-col md:flex-row md:items-center justify-between gap-4 mb-6">
+                            <h2 className="text-lg font-black text-gray-900 flex items-center gap-2">
+                                <MessageSquare size={20} className="text-red-600" />
+                                بازبینی و نظرات
+                            </h2>
+                            {canEdit && (
+                                <label className="flex items-center gap-2 text-xs font-bold text-gray-500">
+                                    بازبین:
+                                    <select
+                                        value={reviewerId ?? ''}
+                                        onChange={(e) => handleAssignReviewer(e.target.value)}
+                                        className="bg-gray-50 border border-gray-100 rounded-xl px-3 py-2 text-gray-900 outline-none"
+                                    >
+                                        <option value="">هر بازبینی</option>
+                                        {reviewers.map((r) => (
+                                            <option key={r.id} value={r.id}>{r.email}</option>
+                                        ))}
+                                    </select>
+                                </label>
+                            )}
+                        </div>
+                        <div className="space-y-3 mb-6">
+                            {comments.length === 0 && <p className="text-sm text-gray-400 font-medium">هنوز نظری ثبت نشده است.</p>}
+                            {comments.map((cm) => (
+                                <div key={cm.id} className={`rounded-2xl px-4 py-3 ${cm.transition ? 'bg-slate-50' : 'bg-gray-50/60 border border-gray-100'}`}>
+                                    <div className="flex items-center gap-2 text-[11px] font-bold text-gray-400 mb-1">
+                                        <span className="text-gray-700">{cm.user_email || '—'}</span>
+                                        {cm.transition && <span className="text-red-600">{transitionLabels[cm.transition]}</span>}
+                                        {cm.slide_id !== null && (
+                                            <span className="bg-white px-2 rounded">
+                                                اسلاید {(slides.findIndex((s) => s.id === cm.slide_id) + 1 || cm.slide_id).toLocaleString('fa-IR')}
+                                            </span>
+                                        )}
+                                        <span className="mr-auto">{new Date(cm.created_at).toLocaleString('fa-IR')}</span>
+                                    </div>
+                                    {cm.body && <p className="text-sm text-gray-800 whitespace-pre-line">{cm.body}</p>}
+                                </div>
+                            ))}
+                        </div>
+                        {(canEdit || canReview) && (
+                            <div className="flex flex-col md:flex-row gap-3">
+                                <textarea
+                                    value={newComment}
+                                    onChange={(e) => setNewComment(e.target.value)}
+                                    placeholder="نظر خود را بنویسید..."
+                                    rows={2}
+                                    className="flex-1 bg-gray-50 border border-gray-100 rounded-2xl px-4 py-3 text-sm outline-none focus:border-red-200"
+                                />
+                                <select
+                                    value={commentSlide ?? ''}
+                                    onChange={(e) => setCommentSlide(e.target.value ? Number(e.target.value) : null)}
+                                    className="bg-gray-50 border border-gray-100 rounded-2xl px-3 py-2 text-xs font-bold text-gray-600 outline-none"
+                                >
+                                    <option value="">کل گروه</option>
+                                    {slides.map((slide, index) => (
+                                        <option key={slide.id} value={slide.id}>اسلاید {(index + 1).toLocaleString('fa-IR')}</option>
+                                    ))}
+                                </select>
+                                <button
+                                    onClick={handleAddComment}
+                                    disabled={!newComment.trim()}
+                                    className="bg-slate-900 hover:bg-black disabled:opacity-40 text-white px-6 py-3 rounded-2xl font-black text-sm transition-all active:scale-95"
+                                >
+                                    ثبت نظر
+                                </button>
+                            </div>
+                        )}
+                    </div>
+                )}
+
+                {!showBuilder && versions.length > 0 && (
+                    <div className="mt-12 bg-white rounded-[32px] border border-gray-100 p-8">
+                        <h2 className="text-lg font-black text-gray-900 mb-6 flex items-center gap-2">
+                            <History size={20} className="text-red-600" />
+                            تاریخچه انتشار
+                        </h2>
+                        <div className="divide-y divide-gray-50">
+                            {versions.map((v) => (
+                                <div key={v.version} className="py-3 flex items-center justify-between gap-4">
+                                    <div className="flex items-center gap-3">
+                                        <span className="text-sm font-black text-gray-900">نسخه {v.version.toLocaleString('fa-IR')}</span>
+                                        {v.current && <span className="text-[10px] font-black px-2 py-0.5 rounded bg-emerald-50 text-emerald-600">نسخه فعلی</span>}
+                                        {v.restored_from !== null && (
+                                            <span className="text-[10px] font-bold text-gray-400">بازگردانی از نسخه {v.restored_from.toLocaleString('fa-IR')}</span>
+                                        )}
+                                    </div>
+                                    <div className="flex items-center gap-4 text-xs font-bold text-gray-400">
+                                        <span>{v.slide_count.toLocaleString('fa-IR')} اسلاید</span>
+                                        <span>{v.published_by_email || '—'}</span>
+                                        <span>{new Date(v.published_at).toLocaleString('fa-IR')}</span>
+                                        {!v.current && canEdit && (
+                                            <button
+                                                onClick={() => handleRollback(v.version)}
+                                                className="flex items-center gap-1 text-gray-500 hover:text-red-600 transition-colors"
+                                                title="بازگردانی این نسخه"
+                                            >
+                                                <RotateCcw size={14} />
+                                                بازگردانی
+                                            </button>
+                                        )}
+                                    </div>
+                                </div>
+                            ))}
+                        </div>
+                    </div>
+                )}
             </div>
         </div>
     );
@@ -4,7 +4,7 @@ import { useEffect, useState } from "react";
 import { useParams, useRouter } from "next/navigation";
 import Link from "next/link";
 import { ArrowRight, Eye, MousePointerClick, Calendar, BarChart2, TrendingUp, Users, Clock, Download } from "lucide-react";
-import { apiRequest } from "@/lib/api";
+import { apiRequest, mediaUrl } from "@/lib/api";
 
 interface Slide {
     id: number;
@@ -27,17 +27,64 @@ interface GroupDetails {
     slides: Slide[];
 }
 
+interface PollResults {
+    slide_id: number;
+    element_id: string;
+    question: string;
+    total: number;
+    options: { text: string; votes: number; percent: number }[];
+}
+
+interface SliderResults {
+    slide_id: number;
+    position: number;
+    element_id: string;
+    emoji: string;
+    count: number;
+    average: number;
+    histogram: number[];
+}
+
+interface QuizResults {
+    slide_id: number;
+    position: number;
+    element_id: string;
+    question: string;
+    total: number;
+    correct_answers: number;
+    percent_correct: number;
+    options: { text: string; correct: boolean; answers: number; percent: number }[];
+}
+
+interface GroupAnalytics {
+    sessions: number;
+    avg_slides_viewed: number;
+    avg_watch_ms: number;
+    slides: { slide_id: number; position: number; reach: number; completion_rate: number; drop_off: number; polls?: PollResults[] }[];
+}
+
 export default function AnalyticsReport() {
     const { id } = useParams();
     const router = useRouter();
     const [group, setGroup] = useState<GroupDetails | null>(null);
+    const [analytics, setAnalytics] = useState<GroupAnalytics | null>(null);
+    const [sliders, setSliders] = useState<SliderResults[]>([]);
+    const [quizzes, setQuizzes] = useState<QuizResults[]>([]);
     const [loading, setLoading] = useState(true);
 
     useEffect(() => {
         const fetchGroupDetails = async () => {
             try {
-                const data = await apiRequest(`/admin/story-groups/${id}`);
+                const [data, report, sliderReport, quizReport] = await Promise.all([
+                    apiRequest(`/admin/story-groups/${id}`),
+                    apiRequest(`/admin/story-groups/${id}/analytics`).catch(() => null),
+                    apiRequest(`/admin/story-groups/${id}/sliders`).catch(() => null),
+                    apiRequest(`/admin/story-groups/${id}/quizzes`).catch(() => null),
+                ]);
                 setGroup(data);
+                setAnalytics(report);
+                setSliders(sliderReport?.sliders || []);
+                setQuizzes(quizReport?.quizzes || []);
             } catch (err) {
                 console.error(err);
             } finally {
@@ -65,9 +112,14 @@ export default function AnalyticsReport() {
         );
     }
 
+    const polls = analytics?.slides.flatMap(s => (s.polls || []).map(p => ({ ...p, position: s.position }))) || [];
+
     const totalOpens = group.slides?.reduce((acc, slide) => acc + slide.open_count, 0) || 0;
     const ctr = group.view_count > 0 ? ((group.open_count / group.view_count) * 100).toFixed(1) : 0;
-    const watchDepth = group.open_count > 0 ? (totalOpens / group.open_count).toFixed(1) : 0;
+    // Prefer session-based watch depth from the event log; fall back to the legacy counters
+    const watchDepth = analytics && analytics.sessions > 0
+        ? analytics.avg_slides_viewed.toFixed(1)
+        : group.open_count > 0 ? (totalOpens / group.open_count).toFixed(1) : 0;
 
     return (
         <div className="min-h-screen bg-gray-50/50 p-6 md:p-10 font-sans">
@@ -153,7 +205,7 @@ export default function AnalyticsReport() {
                                         <td className="px-8 py-4">
                                             <div
                                                 className="w-14 aspect-[9/16] rounded-xl border-2 border-white shadow-md bg-gray-200 bg-cover bg-center overflow-hidden transition-transform group-hover:scale-110"
-                                                style={slide.image_url ? { backgroundImage: `url(http://localhost:8080${slide.image_url})` } : { backgroundColor: slide.background_color || '#eee' }}
+                                                style={slide.image_url ? { backgroundImage: `url(${mediaUrl(slide.image_url)})` } : { backgroundColor: slide.background_color || '#eee' }}
                                             />
                                         </td>
                                         <td className="px-6 py-4">
@@ -198,6 +250,117 @@ export default function AnalyticsReport() {
                         </table>
                     </div>
                 </div>
+
+                {/* Poll Results */}
+                {polls.length > 0 && (
+                    <div className="bg-white rounded-[40px] shadow-sm border border-gray-100 overflow-hidden mt-10">
+                        <div className="p-8 border-b border-gray-100 bg-gray-50/30">
+                            <h3 className="text-xl font-black text-gray-900">نتایج نظرسنجی‌ها</h3>
+                            <p className="text-sm text-gray-500 font-medium">رأی‌های ثبت‌شده در ۳۰ روز اخیر</p>
+                        </div>
+                        <div className="grid grid-cols-1 md:grid-cols-2 gap-6 p-8">
+                            {polls.map(poll => (
+                                <div key={`${poll.slide_id}:${poll.element_id}`} className="border border-gray-100 rounded-3xl p-6 space-y-3">
+                                    <div className="flex items-center justify-between">
+                                        <div className="text-sm font-black text-gray-900">{poll.question}</div>
+                                        <span className="text-[10px] font-bold text-gray-400">اسلاید {poll.position.toLocaleString('fa-IR')}</span>
+                                    </div>
+                                    {poll.options.map((option, oi) => (
+                                        <div key={oi}>
+                                            <div className="flex justify-between text-xs font-bold text-gray-600 mb-1">
+                                                <span>{option.text}</span>
+                                                <span>{option.votes.toLocaleString('fa-IR')} ({option.percent.toLocaleString('fa-IR')}٪)</span>
+                                            </div>
+                                            <div className="w-full h-1.5 bg-gray-100 rounded-full overflow-hidden">
+                                                <div className="h-full bg-red-600 rounded-full" style={{ width: `${option.percent}%` }} />
+                                            </div>
+                                        </div>
+                                    ))}
+                                    <div className="text-[10px] font-bold text-gray-400">{poll.total.toLocaleString('fa-IR')} رأی</div>
+                                </div>
+                            ))}
+                        </div>
+                    </div>
+                )}
+
+                {/* Slider Responses */}
+                {sliders.length > 0 && (
+                    <div className="bg-white rounded-[40px] shadow-sm border border-gray-100 overflow-hidden mt-10">
+                        <div className="p-8 border-b border-gray-100 bg-gray-50/30">
+                            <h3 className="text-xl font-black text-gray-900">پاسخ‌های اسلایدر</h3>
+                            <p className="text-sm text-gray-500 font-medium">میانگین و پراکندگی پاسخ‌ها در ۳۰ روز اخیر</p>
+                        </div>
+                        <div className="grid grid-cols-1 md:grid-cols-2 gap-6 p-8">
+                            {sliders.map(slider => {
+                                const peak = Math.max(1, ...slider.histogram);
+                                return (
+                                    <div key={`${slider.slide_id}:${slider.element_id}`} className="border border-gray-100 rounded-3xl p-6 space-y-4">
+                                        <div className="flex items-center justify-between">
+                                            <div className="flex items-center gap-3">
+                                                <span className="text-3xl">{slider.emoji}</span>
+                                                <div>
+                                                    <div className="text-lg font-black text-gray-900">{slider.average.toLocaleString('fa-IR')} <span className="text-xs text-gray-400">از ۱۰۰</span></div>
+                                                    <div className="text-[10px] font-bold text-gray-400">{slider.count.toLocaleString('fa-IR')} پاسخ</div>
+                                                </div>
+                                            </div>
+                                            <span className="text-[10px] font-bold text-gray-400">اسلاید {slider.position.toLocaleString('fa-IR')}</span>
+                                        </div>
+                                        <div className="flex items-end gap-1 h-20" style={{ direction: 'ltr' }}>
+                                            {slider.histogram.map((n, bi) => (
+                                                <div
+                                                    key={bi}
+                                                    className={`flex-1 rounded-t-md ${n > 0 ? 'bg-red-600' : 'bg-gray-100'}`}
+                                                    style={{ height: `${Math.max(4, (n / peak) * 100)}%` }}
+                                                    title={`${bi * 10}–${bi === 9 ? 100 : bi * 10 + 9}: ${n}`}
+                                                />
+                                            ))}
+                                        </div>
+                                        <div className="flex justify-between text-[10px] font-bold text-gray-300" style={{ direction: 'ltr' }}>
+                                            <span>0</span>
+                                            <span>100</span>
+                                        </div>
+                                    </div>
+                                );
+                            })}
+                        </div>
+                    </div>
+                )}
+
+                {/* Quiz Results */}
+                {quizzes.length > 0 && (
+                    <div className="bg-white rounded-[40px] shadow-sm border border-gray-100 overflow-hidden mt-10">
+                        <div className="p-8 border-b border-gray-100 bg-gray-50/30">
+                            <h3 className="text-xl font-black text-gray-900">نتایج مسابقه‌ها</h3>
+                            <p className="text-sm text-gray-500 font-medium">پاسخ‌های ثبت‌شده در ۳۰ روز اخیر</p>
+                        </div>
+                        <div className="grid grid-cols-1 md:grid-cols-2 gap-6 p-8">
+                            {quizzes.map(quiz => (
+                                <div key={`${quiz.slide_id}:${quiz.element_id}`} className="border border-gray-100 rounded-3xl p-6 space-y-3">
+                                    <div className="flex items-center justify-between">
+                                        <div className="text-sm font-black text-gray-900">{quiz.question}</div>
+                                        <span className="text-[10px] font-bold text-gray-400">اسلاید {quiz.position.toLocaleString('fa-IR')}</span>
+                                    </div>
+                                    <div className="text-2xl font-black text-green-600">
+                                        ٪{quiz.percent_correct.toLocaleString('fa-IR')}
+                                        <span className="text-xs text-gray-400 font-bold mr-2">پاسخ درست</span>
+                                    </div>
+                                    {quiz.options.map((option, oi) => (
+                                        <div key={oi}>
+                                            <div className={`flex justify-between text-xs font-bold mb-1 ${option.correct ? 'text-green-700' : 'text-gray-600'}`}>
+                                                <span>{option.text}{option.correct && ' ✓'}</span>
+                                                <span>{option.answers.toLocaleString('fa-IR')} ({option.percent.toLocaleString('fa-IR')}٪)</span>
+                                            </div>
+                                            <div className="w-full h-1.5 bg-gray-100 rounded-full overflow-hidden">
+                                                <div className={`h-full rounded-full ${option.correct ? 'bg-green-600' : 'bg-red-600'}`} style={{ width: `${option.percent}%` }} />
+                                            </div>
+                                        </div>
+                                    ))}
+                                    <div className="text-[10px] font-bold text-gray-400">{quiz.total.toLocaleString('fa-IR')} پاسخ</div>
+                                </div>
+                            ))}
+                        </div>
+                    </div>
+                )}
             </div>
         </div>
     );
@@ -4,6 +4,7 @@ import { useEffect, useState } from "react";
 import { useParams, useRouter } from "next/navigation";
 import StoryBuilder from "@/components/story-builder";
 import { ArrowRight, Loader2 } from "lucide-react";
+import { uploadErrorMessage } from "@/lib/api";
 
 export default function NewSlidePage() {
     const params = useParams();
@@ -66,7 +67,8 @@ export default function NewSlidePage() {
             if (res.ok) {
                 router.push(`/dashboard/group/${groupId}`);
             } else {
-                alert("خطا در ذخیره اسلاید");
+                const data = await res.json().catch(() => ({}));
+                alert(uploadErrorMessage(data, "خطا در ذخیره اسلاید"));
             }
         } catch (error) {
             console.error(error);
@@ -20,6 +20,7 @@ import {
     Activity,
     Layers
 } from "lucide-react";
+import { mediaUrl, uploadErrorMessage } from "@/lib/api";
 
 interface StoryGroup {
     id: number;
@@ -28,13 +29,45 @@ interface StoryGroup {
     caption: string;
     cover_url: string;
     active: boolean;
+    status?: 'inactive' | 'scheduled' | 'live' | 'expired';
+    starts_at?: string | null;
+    ends_at?: string | null;
+    hotels?: string[];
     story_count?: number;
     view_count: number;
 }
 
+interface City {
+    id: number;
+    slug: string;
+    name_fa: string;
+    active: boolean;
+}
+
+const statusBadges: Record<string, { label: string; className: string }> = {
+    live: { label: 'فعال', className: 'bg-emerald-50 text-emerald-600' },
+    scheduled: { label: 'زمان‌بندی شده', className: 'bg-amber-50 text-amber-600' },
+    expired: { label: 'منقضی شده', className: 'bg-rose-50 text-rose-500' },
+    inactive: { label: 'غیرفعال', className: 'bg-slate-50 text-slate-400' },
+};
+
+// datetime-local inputs work in the browser's local time without an offset;
+// the API expects RFC 3339.
+const toLocalInput = (iso?: string | null) => {
+    if (!iso) return '';
+    const d = new Date(iso);
+    const pad = (n: number) => String(n).padStart(2, '0');
+    return `${d.getFullYear()}-${pad(d.getMonth() + 1)}-${pad(d.getDate())}T${pad(d.getHours())}:${pad(d.getMinutes())}`;
+};
+const fromLocalInput = (value: string) => (value ? new Date(value).toISOString() : null);
+
+// Hotels are edited as a comma-separated list of hotel slugs
+const parseHotels = (value: string) => value.split(/[,،]/).map((h) => h.trim()).filter(Boolean);
+
 export default function GroupsManagement() {
     const router = useRouter();
     const [groups, setGroups] = useState<StoryGroup[]>([]);
+    const [cities, setCities] = useState<City[]>([]);
     const [loading, setLoading] = useState(true);
     const [error, setError] = useState<string | null>(null);
     const [searchTerm, setSearchTerm] = useState("");
@@ -45,7 +78,7 @@ export default function GroupsManagement() {
     const [isDeleteModalOpen, setIsDeleteModalOpen] = useState(false);
     const [groupToDelete, setGroupToDelete] = useState<StoryGroup | null>(null);
     const [groupToEdit, setGroupToEdit] = useState<StoryGroup | null>(null);
-    const [newGroup, setNewGroup] = useState({ city_slug: '', title_fa: '', caption: '', cover_url: '' });
+    const [newGroup, setNewGroup] = useState<{ city_slug: string; title_fa: string; caption: string; cover_url: string; starts_at: string | null; ends_at: string | null; hotels: string[] }>({ city_slug: '', title_fa: '', caption: '', cover_url: '', starts_at: null, ends_at: null, hotels: [] });
     const [creating, setCreating] = useState(false);
     const [updating, setUpdating] = useState(false);
     const [deleting, setDeleting] = useState(false);
@@ -59,6 +92,7 @@ export default function GroupsManagement() {
             return;
         }
         fetchGroups();
+        fetchCities();
     }, []);
 
     const fetchGroups = async () => {
@@ -87,6 +121,17 @@ export default function GroupsManagement() {
         }
     };
 
+    const fetchCities = async () => {
+        try {
+            const res = await fetch('http://localhost:8080/api/admin/cities', {
+                headers: { 'Authorization': `Bearer ${localStorage.getItem('token')}` }
+            });
+            if (res.ok) setCities(await res.json());
+        } catch (error) {
+            console.error("Failed to fetch cities", error);
+        }
+    };
+
     const handleUploadCover = async (file: File, isEdit = false) => {
         if (!file) return;
 
@@ -129,7 +174,7 @@ export default function GroupsManagement() {
                         resolve(data);
                         return;
                     }
-                    errorMsg = data.error || errorMsg;
+                    errorMsg = uploadErrorMessage(data, errorMsg);
                 } catch (e) {
                     console.error('Failed to parse upload response:', e);
                 }
@@ -169,10 +214,13 @@ export default function GroupsManagement() {
                 body: JSON.stringify(newGroup)
             });
 
-            if (!res.ok) throw new Error("Failed to create group");
+            if (!res.ok) {
+                const data = await res.json().catch(() => ({}));
+                throw new Error(data.error || "Failed to create group");
+            }
 
             setIsCreateModalOpen(false);
-            setNewGroup({ city_slug: '', title_fa: '', caption: '', cover_url: '' });
+            setNewGroup({ city_slug: '', title_fa: '', caption: '', cover_url: '', starts_at: null, ends_at: null, hotels: [] });
             fetchGroups();
         } catch (error: any) {
             alert(error.message);
@@ -199,7 +247,10 @@ export default function GroupsManagement() {
                 body: JSON.stringify(groupToEdit)
             });
 
-            if (!res.ok) throw new Error("Failed to update group");
+            if (!res.ok) {
+                const data = await res.json().catch(() => ({}));
+                throw new Error(data.error || "Failed to update group");
+            }
 
             setIsEditModalOpen(false);
             fetchGroups();
@@ -323,8 +374,8 @@ export default function GroupsManagement() {
                             <div className="px-5 pt-5 pb-3 flex items-center justify-between border-b border-slate-50">
                                 <span className="text-[10px] font-bold text-slate-400 uppercase tracking-widest">ID: {group.id}</span>
                                 <div className="flex items-center gap-3">
-                                    <span className={`text-[9px] font-black px-2 py-0.5 rounded ${group.active ? 'bg-emerald-50 text-emerald-600' : 'bg-slate-50 text-slate-400'}`}>
-                                        {group.active ? 'فعال' : 'غیرفعال'}
+                                    <span className={`text-[9px] font-black px-2 py-0.5 rounded ${statusBadges[group.status || (group.active ? 'live' : 'inactive')].className}`}>
+                                        {statusBadges[group.status || (group.active ? 'live' : 'inactive')].label}
                                     </span>
                                     <button
                                         onClick={() => toggleStatus(group)}
@@ -341,7 +392,7 @@ export default function GroupsManagement() {
                                     <div className={`w-20 h-20 rounded-full p-[2px] transition-all duration-500 bg-gradient-to-tr ${group.active ? 'from-yellow-400 via-red-500 to-purple-600' : 'from-slate-200 to-slate-300'}`}>
                                         <div className="w-full h-full rounded-full border-[2px] border-white overflow-hidden bg-white">
                                             <img
-                                                src={group.cover_url ? `http://localhost:8080${group.cover_url}` : "/placeholder.jpg"}
+                                                src={group.cover_url ? mediaUrl(group.cover_url) : "/placeholder.jpg"}
                                                 alt={group.title_fa}
                                                 className="w-full h-full object-cover"
                                             />
@@ -434,7 +485,7 @@ export default function GroupsManagement() {
                                 <tr key={group.id} className="hover:bg-slate-50/50 transition-colors">
                                     <td className="px-6 py-4 text-center">
                                         <img
-                                            src={`http://localhost:8080${group.cover_url}`}
+                                            src={mediaUrl(group.cover_url)}
                                             className="w-12 h-12 rounded-xl object-cover mx-auto"
                                             alt=""
                                         />
@@ -520,15 +571,20 @@ export default function GroupsManagement() {
                         <form onSubmit={handleCreateGroup} className="p-8 space-y-6">
                             <div className="grid grid-cols-2 gap-4">
                                 <div className="space-y-2 text-right">
-                                    <label className="text-xs font-bold text-slate-400 uppercase tracking-widest mr-1">نام شهر (انگلیسی)</label>
-                                    <input
-                                        type="text"
-                                        placeholder="e.g. tehran"
+                                    <label className="text-xs font-bold text-slate-400 uppercase tracking-widest mr-1">شهر</label>
+                                    <select
                                         value={newGroup.city_slug}
-                                        onChange={(e) => setNewGroup({ ...newGroup, city_slug: e.target.value.toLowerCase() })}
+                                        onChange={(e) => setNewGroup({ ...newGroup, city_slug: e.target.value })}
                                         className="w-full bg-slate-50 border-2 border-transparent focus:border-red-100 focus:bg-white rounded-2xl px-5 py-3 outline-none transition-all text-sm font-bold text-slate-900"
                                         required
-                                    />
+                                    >
+                                        <option value="" disabled>انتخاب شهر</option>
+                                        {cities.map((city) => (
+                                            <option key={city.id} value={city.slug}>
+                                                {city.name_fa} ({city.slug}){city.active ? '' : ' - غیرفعال'}
+                                            </option>
+                                        ))}
+                                    </select>
                                 </div>
                                 <div className="space-y-2 text-right">
                                     <label className="text-xs font-bold text-slate-400 uppercase tracking-widest mr-1">عنوان فارسی</label>
@@ -554,12 +610,44 @@ export default function GroupsManagement() {
                                 />
                             </div>
 
+                            <div className="grid grid-cols-2 gap-4">
+                                <div className="space-y-2 text-right">
+                                    <label className="text-xs font-bold text-slate-400 uppercase tracking-widest mr-1">شروع نمایش</label>
+                                    <input
+                                        type="datetime-local"
+                                        value={toLocalInput(newGroup.starts_at)}
+                                        onChange={(e) => setNewGroup({ ...newGroup, starts_at: fromLocalInput(e.target.value) })}
+                                        className="w-full bg-slate-50 border-2 border-transparent focus:border-red-100 focus:bg-white rounded-2xl px-5 py-3 outline-none transition-all text-sm font-bold text-slate-900"
+                                    />
+                                </div>
+                                <div className="space-y-2 text-right">
+                                    <label className="text-xs font-bold text-slate-400 uppercase tracking-widest mr-1">پایان نمایش</label>
+                                    <input
+                                        type="datetime-local"
+                                        value={toLocalInput(newGroup.ends_at)}
+                                        onChange={(e) => setNewGroup({ ...newGroup, ends_at: fromLocalInput(e.target.value) })}
+                                        className="w-full bg-slate-50 border-2 border-transparent focus:border-red-100 focus:bg-white rounded-2xl px-5 py-3 outline-none transition-all text-sm font-bold text-slate-900"
+                                    />
+                                </div>
+                            </div>
+
+                            <div className="space-y-2 text-right">
+                                <label className="text-xs font-bold text-slate-400 uppercase tracking-widest mr-1">هتل‌ها (اختیاری، با کاما جدا کنید)</label>
+                                <input
+                                    type="text"
+                                    placeholder="e.g. espinas-palace, azadi"
+                                    defaultValue={(newGroup.hotels || []).join(', ')}
+                                    onBlur={(e) => setNewGroup({ ...newGroup, hotels: parseHotels(e.target.value) })}
+                                    className="w-full bg-slate-50 border-2 border-transparent focus:border-red-100 focus:bg-white rounded-2xl px-5 py-3 outline-none transition-all text-sm font-bold text-slate-900"
+                                />
+                            </div>
+
                             <div className="space-y-2 text-right">
                                 <label className="text-xs font-bold text-slate-400 uppercase tracking-widest mr-1">تصویر کاور</label>
                                 <div className="flex items-center gap-4">
                                     <div className="w-20 h-20 rounded-2xl bg-slate-50 border-2 border-dashed border-slate-200 overflow-hidden flex items-center justify-center shrink-0 relative">
                                         {newGroup.cover_url ? (
-                                            <img src={`http://localhost:8080${newGroup.cover_url}`} className="w-full h-full object-cover" alt="Preview" />
+                                            <img src={mediaUrl(newGroup.cover_url)} className="w-full h-full object-cover" alt="Preview" />
                                         ) : (
                                             <Plus size={24} className="text-slate-300" />
                                         )}
@@ -579,7 +667,7 @@ export default function GroupsManagement() {
                                             </div>
                                             <input type="file" className="hidden" accept="image/*" onChange={(e) => e.target.files?.[0] && handleUploadCover(e.target.files[0])} />
                                         </label>
-                                        <p className="text-[10px] text-slate-400 font-medium mt-2 mr-1">فرمت‌های JPG، PNG (حداکثر ۲ مگابایت)</p>
+                                        <p className="text-[10px] text-slate-400 font-medium mt-2 mr-1">فرمت‌های JPG، PNG، WebP (حداکثر ۲ مگابایت)</p>
                                     </div>
                                 </div>
                             </div>
@@ -618,14 +706,20 @@ export default function GroupsManagement() {
                         <form onSubmit={handleUpdateGroup} className="p-8 space-y-6">
                             <div className="grid grid-cols-2 gap-4">
                                 <div className="space-y-2 text-right">
-                                    <label className="text-xs font-black text-slate-400 uppercase tracking-widest mr-1">نام شهر (انگلیسی)</label>
-                                    <input
-                                        type="text"
+                                    <label className="text-xs font-black text-slate-400 uppercase tracking-widest mr-1">شهر</label>
+                                    <select
                                         value={groupToEdit.city_slug}
                                         onChange={(e) => setGroupToEdit({ ...groupToEdit, city_slug: e.target.value })}
                                         className="w-full bg-slate-50 border-2 border-transparent focus:border-red-100 focus:bg-white rounded-2xl px-5 py-3 outline-none transition-all text-sm font-bold text-slate-900"
                                         required
-                                    />
+                                    >
+                                        <option value="" disabled>انتخاب شهر</option>
+                                        {cities.map((city) => (
+                                            <option key={city.id} value={city.slug}>
+                                                {city.name_fa} ({city.slug}){city.active ? '' : ' - غیرفعال'}
+                                            </option>
+                                        ))}
+                                    </select>
                                 </div>
                                 <div className="space-y-2 text-right">
                                     <label className="text-xs font-bold text-slate-400 uppercase tracking-widest mr-1">عنوان فارسی</label>
@@ -649,11 +743,43 @@ export default function GroupsManagement() {
                                 />
                             </div>
 
+                            <div className="grid grid-cols-2 gap-4">
+                                <div className="space-y-2 text-right">
+                                    <label className="text-xs font-bold text-slate-400 uppercase tracking-widest mr-1">شروع نمایش</label>
+                                    <input
+                                        type="datetime-local"
+                                        value={toLocalInput(groupToEdit.starts_at)}
+                                        onChange={(e) => setGroupToEdit({ ...groupToEdit, starts_at: fromLocalInput(e.target.value) })}
+                                        className="w-full bg-slate-50 border-2 border-transparent focus:border-red-100 focus:bg-white rounded-2xl px-5 py-3 outline-none transition-all text-sm font-bold text-slate-900"
+                                    />
+                                </div>
+                                <div className="space-y-2 text-right">
+                                    <label className="text-xs font-bold text-slate-400 uppercase tracking-widest mr-1">پایان نمایش</label>
+                                    <input
+                                        type="datetime-local"
+                                        value={toLocalInput(groupToEdit.ends_at)}
+                                        onChange={(e) => setGroupToEdit({ ...groupToEdit, ends_at: fromLocalInput(e.target.value) })}
+                                        className="w-full bg-slate-50 border-2 border-transparent focus:border-red-100 focus:bg-white rounded-2xl px-5 py-3 outline-none transition-all text-sm font-bold text-slate-900"
+                                    />
+                                </div>
+                            </div>
+
+                            <div className="space-y-2 text-right">
+                                <label className="text-xs font-bold text-slate-400 uppercase tracking-widest mr-1">هتل‌ها (اختیاری، با کاما جدا کنید)</label>
+                                <input
+                                    type="text"
+                                    placeholder="e.g. espinas-palace, azadi"
+                                    defaultValue={(groupToEdit.hotels || []).join(', ')}
+                                    onBlur={(e) => setGroupToEdit({ ...groupToEdit, hotels: parseHotels(e.target.value) })}
+                                    className="w-full bg-slate-50 border-2 border-transparent focus:border-red-100 focus:bg-white rounded-2xl px-5 py-3 outline-none transition-all text-sm font-bold text-slate-900"
+                                />
+                            </div>
+
                             <div className="space-y-2 text-right">
                                 <label className="text-xs font-bold text-slate-400 uppercase tracking-widest mr-1">تصویر کاور</label>
                                 <div className="flex items-center gap-4">
                                     <div className="w-20 h-20 rounded-2xl bg-slate-50 border-2 border-dashed border-slate-200 overflow-hidden flex items-center justify-center shrink-0 relative">
-                                        <img src={`http://localhost:8080${groupToEdit.cover_url}`} className="w-full h-full object-cover" alt="Preview" />
+                                        <img src={mediaUrl(groupToEdit.cover_url)} className="w-full h-full object-cover" alt="Preview" />
                                         {uploading && (
                                             <div className="absolute inset-0 bg-red-600/80 backdrop-blur-[2px] flex flex-col items-center justify-center text-white p-2">
                                                 <span className="text-[10px] font-black">{uploadProgress}%</span>
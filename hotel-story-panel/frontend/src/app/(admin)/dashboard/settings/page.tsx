@@ -0,0 +1,197 @@
+"use client";
+
+import React, { useEffect, useState } from "react";
+import { ShieldCheck, ShieldOff, KeyRound, Loader2 } from "lucide-react";
+import { apiRequest } from "@/lib/api";
+
+interface MFAStatus {
+    enabled: boolean;
+    required: boolean;
+    recovery_codes_remaining: number;
+}
+
+export default function SettingsPage() {
+    const [status, setStatus] = useState<MFAStatus | null>(null);
+    const [setup, setSetup] = useState<{ secret: string; otpauth_uri: string } | null>(null);
+    const [recoveryCodes, setRecoveryCodes] = useState<string[]>([]);
+    const [code, setCode] = useState("");
+    const [busy, setBusy] = useState(false);
+    const [error, setError] = useState("");
+    const [isOwner, setIsOwner] = useState(false);
+
+    const fetchStatus = async () => {
+        try {
+            setStatus(await apiRequest("/admin/mfa"));
+        } catch (err: any) {
+            setError(err.message);
+        }
+    };
+
+    useEffect(() => {
+        setIsOwner(localStorage.getItem("role") === "owner");
+        fetchStatus();
+    }, []);
+
+    // Runs one 2FA action, keeping the code field and error state in step
+    const run = async (action: () => Promise<void>) => {
+        setBusy(true);
+        setError("");
+        try {
+            await action();
+            setCode("");
+            await fetchStatus();
+        } catch (err: any) {
+            setError(err.message || "خطا در انجام عملیات");
+        } finally {
+            setBusy(false);
+        }
+    };
+
+    const startSetup = () => run(async () => {
+        setRecoveryCodes([]);
+        setSetup(await apiRequest("/admin/mfa/setup", { method: "POST" }));
+    });
+
+    const enable = () => run(async () => {
+        const data = await apiRequest("/admin/mfa/enable", { method: "POST", body: JSON.stringify({ code }) });
+        setSetup(null);
+        setRecoveryCodes(data.recovery_codes || []);
+    });
+
+    const disable = () => run(async () => {
+        await apiRequest("/admin/mfa/disable", { method: "POST", body: JSON.stringify({ code }) });
+        setRecoveryCodes([]);
+    });
+
+    const regenerate = () => run(async () => {
+        const data = await apiRequest("/admin/mfa/recovery-codes", { method: "POST", body: JSON.stringify({ code }) });
+        setRecoveryCodes(data.recovery_codes || []);
+    });
+
+    const toggleRequired = () => run(async () => {
+        await apiRequest("/admin/settings/security", {
+            method: "PUT",
+            body: JSON.stringify({ require_mfa: !status?.required }),
+        });
+    });
+
+    const codeInput = (
+        <input
+            type="text"
+            inputMode="numeric"
+            autoComplete="one-time-code"
+            dir="ltr"
+            placeholder="123456"
+            value={code}
+            onChange={e => setCode(e.target.value)}
+            className="bg-slate-50 border-2 border-transparent focus:border-red-100 focus:bg-white rounded-2xl px-4 py-3 w-40 outline-none transition-all text-center font-bold tracking-widest text-slate-900"
+        />
+    );
+
+    return (
+        <div className="space-y-6">
+            {/* Header */}
+            <div className="bg-white p-6 rounded-[2rem] border border-slate-100 shadow-sm">
+                <h1 className="text-2xl font-black text-slate-900">تنظیمات</h1>
+                <p className="text-sm text-slate-400 font-bold mt-1">امنیت حساب کاربری و ورود دو مرحله‌ای.</p>
+            </div>
+
+            <div className="bg-white p-6 rounded-[2rem] border border-slate-100 shadow-sm space-y-5">
+                <div className="flex items-center gap-3">
+                    <div className={`w-10 h-10 rounded-xl flex items-center justify-center ${status?.enabled ? 'bg-emerald-50 text-emerald-600' : 'bg-slate-50 text-slate-400'}`}>
+                        {status?.enabled ? <ShieldCheck size={20} /> : <ShieldOff size={20} />}
+                    </div>
+                    <div>
+                        <h2 className="font-black text-slate-900">ورود دو مرحله‌ای</h2>
+                        <p className="text-xs font-bold text-slate-400">
+                            {!status ? "در حال بارگذاری..." : status.enabled
+                                ? `فعال — ${status.recovery_codes_remaining.toLocaleString('fa-IR')} کد بازیابی باقی مانده`
+                                : "غیرفعال"}
+                        </p>
+                    </div>
+                </div>
+
+                {status && !status.enabled && !setup && (
+                    <button
+                        onClick={startSetup}
+                        disabled={busy}
+                        className="bg-red-600 hover:bg-red-700 disabled:bg-slate-200 text-white px-6 py-3 rounded-2xl font-black transition-all active:scale-95"
+                    >
+                        فعال‌سازی
+                    </button>
+                )}
+
+                {setup && (
+                    <div className="space-y-3 text-sm font-bold text-slate-600 leading-7">
+                        <p>کلید زیر را در برنامه احراز هویت وارد کنید یا <a href={setup.otpauth_uri} className="text-red-600 underline">این لینک</a> را روی گوشی باز کنید، سپس کد شش رقمی را وارد کنید:</p>
+                        <div className="bg-slate-50 rounded-2xl p-4 font-mono text-center text-slate-900 break-all" dir="ltr">{setup.secret}</div>
+                        <div className="flex items-center gap-3">
+                            {codeInput}
+                            <button
+                                onClick={enable}
+                                disabled={busy || !code}
+                                className="bg-red-600 hover:bg-red-700 disabled:bg-slate-200 text-white px-6 py-3 rounded-2xl font-black transition-all active:scale-95"
+                            >
+                                تأیید
+                            </button>
+                        </div>
+                    </div>
+                )}
+
+                {status?.enabled && (
+                    <div className="flex flex-wrap items-center gap-3">
+                        {codeInput}
+                        <button
+                            onClick={regenerate}
+                            disabled={busy || !code}
+                            className="flex items-center gap-2 bg-white hover:bg-slate-50 disabled:opacity-50 text-slate-700 px-5 py-3 rounded-2xl font-bold border border-slate-200 transition-all"
+                        >
+                            <KeyRound size={16} />
+                            کدهای بازیابی جدید
+                        </button>
+                        {!status.required && (
+                            <button
+                                onClick={disable}
+                                disabled={busy || !code}
+                                className="bg-white hover:bg-red-50 hover:text-red-600 disabled:opacity-50 text-slate-700 px-5 py-3 rounded-2xl font-bold border border-slate-200 transition-all"
+                            >
+                                غیرفعال‌سازی
+                            </button>
+                        )}
+                    </div>
+                )}
+
+                {recoveryCodes.length > 0 && (
+                    <div className="space-y-2">
+                        <p className="text-sm font-bold text-slate-600">این کدهای بازیابی فقط یک بار نمایش داده می‌شوند؛ آن‌ها را در جای امنی نگه دارید.</p>
+                        <div className="grid grid-cols-2 gap-2 bg-slate-50 rounded-2xl p-4 font-mono text-sm text-slate-900 max-w-md" dir="ltr">
+                            {recoveryCodes.map(c => <div key={c}>{c}</div>)}
+                        </div>
+                    </div>
+                )}
+
+                {error && (
+                    <div className="p-4 bg-red-50 rounded-xl text-red-600 text-sm font-bold border border-red-100">
+                        {error}
+                    </div>
+                )}
+            </div>
+
+            {isOwner && status && (
+                <div className="bg-white p-6 rounded-[2rem] border border-slate-100 shadow-sm flex items-center justify-between gap-4">
+                    <div>
+                        <h2 className="font-black text-slate-900">الزام ورود دو مرحله‌ای</h2>
+                        <p className="text-xs font-bold text-slate-400 mt-1">کاربرانی که ورود دو مرحله‌ای ندارند، در ورود بعدی باید آن را فعال کنند.</p>
+                    </div>
+                    <button
+                        onClick={toggleRequired}
+                        disabled={busy}
+                        className={`px-5 py-3 rounded-2xl font-black transition-all active:scale-95 ${status.required ? 'bg-emerald-600 text-white' : 'bg-slate-100 text-slate-600'}`}
+                    >
+                        {busy ? <Loader2 size={18} className="animate-spin" /> : status.required ? "الزامی" : "اختیاری"}
+                    </button>
+                </div>
+            )}
+        </div>
+    );
+}
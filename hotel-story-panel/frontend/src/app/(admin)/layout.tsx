@@ -16,6 +16,10 @@ import {
     Calendar,
     Activity
 } from "lucide-react";
+import { logout } from "@/lib/api";
+
+// Pages reachable without signing in
+const publicPaths = ["/login", "/set-password", "/forgot-password"];
 
 export default function AdminLayout({
     children,
@@ -29,14 +33,14 @@ export default function AdminLayout({
 
     useEffect(() => {
         const token = localStorage.getItem("token");
-        if (!token && pathname !== "/login") {
+        if (!token && !publicPaths.includes(pathname)) {
             router.push("/login");
         } else {
             setAuthorized(true);
         }
     }, [router, pathname]);
 
-    if (pathname === "/login") {
+    if (publicPaths.includes(pathname)) {
         return <>{children}</>;
     }
 
@@ -65,8 +69,8 @@ export default function AdminLayout({
         }
     ];
 
-    const handleLogout = () => {
-        localStorage.removeItem('token');
+    const handleLogout = async () => {
+        await logout();
         router.push('/login');
     };
 
@@ -3,7 +3,7 @@
 import { useState } from "react";
 import { useRouter } from "next/navigation";
 import { apiRequest } from "@/lib/api";
-import { Lock, Mail, Loader2 } from "lucide-react";
+import { Lock, Mail, Loader2, ShieldCheck } from "lucide-react";
 import Link from "next/link";
 
 export default function LoginPage() {
@@ -11,8 +11,21 @@ export default function LoginPage() {
     const [password, setPassword] = useState("");
     const [loading, setLoading] = useState(false);
     const [error, setError] = useState("");
+    // Second step: "verify" asks for a code, "enroll" sets up 2FA first when
+    // it is required, "codes" shows the recovery codes from enrolment
+    const [step, setStep] = useState<"password" | "verify" | "enroll" | "codes">("password");
+    const [mfaToken, setMfaToken] = useState("");
+    const [code, setCode] = useState("");
+    const [useRecovery, setUseRecovery] = useState(false);
+    const [setup, setSetup] = useState<{ secret: string; otpauth_uri: string } | null>(null);
+    const [recoveryCodes, setRecoveryCodes] = useState<string[]>([]);
     const router = useRouter();
 
+    const signIn = (data: any) => {
+        localStorage.setItem("token", data.token);
+        localStorage.setItem("role", data.role);
+    };
+
     const handleLogin = async (e: React.FormEvent) => {
         e.preventDefault();
         setLoading(true);
@@ -24,8 +37,20 @@ export default function LoginPage() {
                 body: JSON.stringify({ email, password }),
             });
 
-            localStorage.setItem("token", data.token);
-            router.push("/dashboard");
+            if (data.mfa_required) {
+                setMfaToken(data.mfa_token);
+                setStep("verify");
+            } else if (data.mfa_enrollment_required) {
+                setMfaToken(data.mfa_token);
+                setSetup(await apiRequest("/auth/mfa/enroll", {
+                    method: "POST",
+                    body: JSON.stringify({ mfa_token: data.mfa_token }),
+                }));
+                setStep("enroll");
+            } else {
+                signIn(data);
+                router.push("/dashboard");
+            }
         } catch (err: any) {
             setError(err.message || "خطا در ورود");
         } finally {
@@ -33,6 +58,36 @@ export default function LoginPage() {
         }
     };
 
+    const handleSecondFactor = async (e: React.FormEvent) => {
+        e.preventDefault();
+        setLoading(true);
+        setError("");
+
+        try {
+            if (step === "verify") {
+                signIn(await apiRequest("/auth/mfa/verify", {
+                    method: "POST",
+                    body: JSON.stringify(useRecovery
+                        ? { mfa_token: mfaToken, recovery_code: code }
+                        : { mfa_token: mfaToken, code }),
+                }));
+                router.push("/dashboard");
+            } else {
+                const data = await apiRequest("/auth/mfa/enroll/confirm", {
+                    method: "POST",
+                    body: JSON.stringify({ mfa_token: mfaToken, code }),
+                });
+                signIn(data);
+                setRecoveryCodes(data.recovery_codes || []);
+                setStep("codes");
+            }
+        } catch (err: any) {
+            setError(err.message || "کد وارد شده معتبر نیست");
+        } finally {
+            setLoading(false);
+        }
+    };
+
     return (
         <div className="min-h-screen flex items-center justify-center bg-gray-50 p-4 font-sans">
             <div className="w-full max-w-md bg-white rounded-3xl shadow-xl shadow-gray-200/50 border border-gray-100 overflow-hidden">
@@ -45,56 +100,136 @@ export default function LoginPage() {
                         <p className="text-gray-400 text-sm font-medium mt-2">برای دسترسی به داشبورد، وارد حساب خود شوید.</p>
                     </div>
 
-                    <form onSubmit={handleLogin} className="space-y-6">
-                        <div className="space-y-4">
+                    {step === "codes" ? (
+                        <div className="space-y-6">
+                            <p className="text-sm font-bold text-gray-600 leading-7">
+                                ورود دو مرحله‌ای فعال شد. این کدهای بازیابی را در جای امنی نگه دارید؛ اگر به برنامه احراز هویت دسترسی نداشتید، با هر کدام یک بار می‌توانید وارد شوید.
+                            </p>
+                            <div className="grid grid-cols-2 gap-2 bg-gray-50 rounded-2xl p-4 font-mono text-sm text-gray-900" dir="ltr">
+                                {recoveryCodes.map(c => <div key={c}>{c}</div>)}
+                            </div>
+                            <button
+                                onClick={() => router.push("/dashboard")}
+                                className="w-full bg-red-600 hover:bg-red-700 text-white py-4 rounded-2xl font-black text-lg shadow-lg shadow-red-200 transition-all active:scale-95"
+                            >
+                                ادامه
+                            </button>
+                        </div>
+                    ) : step !== "password" ? (
+                        <form onSubmit={handleSecondFactor} className="space-y-6">
+                            {step === "enroll" && setup && (
+                                <div className="space-y-3 text-sm font-bold text-gray-600 leading-7">
+                                    <p>ورود دو مرحله‌ای برای همه کاربران الزامی است. کلید زیر را در برنامه احراز هویت (مانند Google Authenticator) وارد کنید یا <a href={setup.otpauth_uri} className="text-red-600 underline">این لینک</a> را روی گوشی باز کنید:</p>
+                                    <div className="bg-gray-50 rounded-2xl p-4 font-mono text-center text-gray-900 break-all" dir="ltr">{setup.secret}</div>
+                                </div>
+                            )}
                             <div className="space-y-1.5">
-                                <label className="text-xs font-black text-gray-400 uppercase tracking-widest mr-1">پست الکترونیک</label>
+                                <label className="text-xs font-black text-gray-400 uppercase tracking-widest mr-1">
+                                    {useRecovery ? "کد بازیابی" : "کد شش رقمی برنامه احراز هویت"}
+                                </label>
                                 <div className="relative">
-                                    <Mail className="absolute right-4 top-1/2 -translate-y-1/2 text-gray-300" size={20} />
+                                    <ShieldCheck className="absolute right-4 top-1/2 -translate-y-1/2 text-gray-300" size={20} />
                                     <input
-                                        type="email"
+                                        type="text"
                                         required
-                                        className="w-full bg-gray-50 border-2 border-transparent focus:border-red-600 focus:bg-white rounded-2xl pr-12 pl-5 py-3.5 outline-none transition-all font-bold text-gray-900 placeholder:text-gray-300"
-                                        placeholder="admin@trip.com"
-                                        value={email}
-                                        onChange={e => setEmail(e.target.value)}
+                                        autoFocus
+                                        autoComplete="one-time-code"
+                                        inputMode={useRecovery ? "text" : "numeric"}
+                                        dir="ltr"
+                                        className="w-full bg-gray-50 border-2 border-transparent focus:border-red-600 focus:bg-white rounded-2xl pr-12 pl-5 py-3.5 outline-none transition-all font-bold text-gray-900 placeholder:text-gray-300 text-center tracking-widest"
+                                        placeholder={useRecovery ? "xxxx-xxxx-xxxx-xxxx" : "123456"}
+                                        value={code}
+                                        onChange={e => setCode(e.target.value)}
                                     />
                                 </div>
                             </div>
-                            <div className="space-y-1.5">
-                                <label className="text-xs font-black text-gray-400 uppercase tracking-widest mr-1">رمز عبور</label>
-                                <div className="relative">
-                                    <Lock className="absolute right-4 top-1/2 -translate-y-1/2 text-gray-300" size={20} />
-                                    <input
-                                        type="password"
-                                        required
-                                        className="w-full bg-gray-50 border-2 border-transparent focus:border-red-600 focus:bg-white rounded-2xl pr-12 pl-5 py-3.5 outline-none transition-all font-bold text-gray-900 placeholder:text-gray-300"
-                                        placeholder="••••••••"
-                                        value={password}
-                                        onChange={e => setPassword(e.target.value)}
-                                    />
+
+                            {step === "verify" && (
+                                <button
+                                    type="button"
+                                    onClick={() => { setUseRecovery(!useRecovery); setCode(""); }}
+                                    className="text-xs font-bold text-gray-400 hover:text-red-600 transition-colors"
+                                >
+                                    {useRecovery ? "استفاده از کد برنامه احراز هویت" : "استفاده از کد بازیابی"}
+                                </button>
+                            )}
+
+                            {error && (
+                                <div className="p-4 bg-red-50 rounded-xl text-red-600 text-sm font-bold border border-red-100 animate-in fade-in duration-200">
+                                    {error}
+                                </div>
+                            )}
+
+                            <button
+                                type="submit"
+                                disabled={loading}
+                                className="w-full bg-red-600 hover:bg-red-700 disabled:bg-gray-200 text-white py-4 rounded-2xl font-black text-lg shadow-lg shadow-red-200 transition-all active:scale-95 flex items-center justify-center gap-2"
+                            >
+                                {loading ? (
+                                    <Loader2 className="w-6 h-6 animate-spin text-white/50" />
+                                ) : (
+                                    "تأیید"
+                                )}
+                            </button>
+                        </form>
+                    ) : (
+                        <form onSubmit={handleLogin} className="space-y-6">
+                            <div className="space-y-4">
+                                <div className="space-y-1.5">
+                                    <label className="text-xs font-black text-gray-400 uppercase tracking-widest mr-1">پست الکترونیک</label>
+                                    <div className="relative">
+                                        <Mail className="absolute right-4 top-1/2 -translate-y-1/2 text-gray-300" size={20} />
+                                        <input
+                                            type="email"
+                                            required
+                                            className="w-full bg-gray-50 border-2 border-transparent focus:border-red-600 focus:bg-white rounded-2xl pr-12 pl-5 py-3.5 outline-none transition-all font-bold text-gray-900 placeholder:text-gray-300"
+                                            placeholder="admin@trip.com"
+                                            value={email}
+                                            onChange={e => setEmail(e.target.value)}
+                                        />
+                                    </div>
+                                </div>
+                                <div className="space-y-1.5">
+                                    <label className="text-xs font-black text-gray-400 uppercase tracking-widest mr-1">رمز عبور</label>
+                                    <div className="relative">
+                                        <Lock className="absolute right-4 top-1/2 -translate-y-1/2 text-gray-300" size={20} />
+                                        <input
+                                            type="password"
+                                            required
+                                            className="w-full bg-gray-50 border-2 border-transparent focus:border-red-600 focus:bg-white rounded-2xl pr-12 pl-5 py-3.5 outline-none transition-all font-bold text-gray-900 placeholder:text-gray-300"
+                                            placeholder="••••••••"
+                                            value={password}
+                                            onChange={e => setPassword(e.target.value)}
+                                        />
+                                    </div>
                                 </div>
                             </div>
-                        </div>
 
-                        {error && (
-                            <div className="p-4 bg-red-50 rounded-xl text-red-600 text-sm font-bold border border-red-100 animate-in fade-in duration-200">
-                                {error}
+                            <div className="text-left -mt-2">
+                                <Link href="/forgot-password" className="text-xs font-bold text-gray-400 hover:text-red-600 transition-colors">
+                                    رمز عبور را فراموش کرده‌اید؟
+                                </Link>
                             </div>
-                        )}
-
-                        <button
-                            type="submit"
-                            disabled={loading}
-                            className="w-full bg-red-600 hover:bg-red-700 disabled:bg-gray-200 text-white py-4 rounded-2xl font-black text-lg shadow-lg shadow-red-200 transition-all active:scale-95 flex items-center justify-center gap-2"
-                        >
-                            {loading ? (
-                                <Loader2 className="w-6 h-6 animate-spin text-white/50" />
-                            ) : (
-                                "ورود به سیستم"
+
+                            {error && (
+                                <div className="p-4 bg-red-50 rounded-xl text-red-600 text-sm font-bold border border-red-100 animate-in fade-in duration-200">
+                                    {error}
+                                </div>
                             )}
-                        </button>
-                    </form>
+
+                            <button
+                                type="submit"
+                                disabled={loading}
+                                className="w-full bg-red-600 hover:bg-red-700 disabled:bg-gray-200 text-white py-4 rounded-2xl font-black text-lg shadow-lg shadow-red-200 transition-all active:scale-95 flex items-center justify-center gap-2"
+                            >
+                                {loading ? (
+                                    <Loader2 className="w-6 h-6 animate-spin text-white/50" />
+                                ) : (
+                                    "ورود به سیستم"
+                                )}
+                            </button>
+                        </form>
+                    )}
                 </div>
 
                 <div className="p-6 bg-gray-50 text-center border-t border-gray-100">
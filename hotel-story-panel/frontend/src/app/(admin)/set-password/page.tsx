@@ -0,0 +1,158 @@
+"use client";
+
+import { Suspense, useState } from "react";
+import { useRouter, useSearchParams } from "next/navigation";
+import { apiRequest } from "@/lib/api";
+import { Lock, KeyRound, Loader2 } from "lucide-react";
+import Link from "next/link";
+
+// Landing page for invitation (?invite=) and password reset (?reset=) links
+function SetPasswordForm() {
+    const searchParams = useSearchParams();
+    const inviteToken = searchParams.get("invite");
+    const resetToken = searchParams.get("reset");
+    const [password, setPassword] = useState("");
+    const [confirm, setConfirm] = useState("");
+    const [loading, setLoading] = useState(false);
+    const [error, setError] = useState("");
+    const [done, setDone] = useState(false);
+    const router = useRouter();
+
+    const handleSubmit = async (e: React.FormEvent) => {
+        e.preventDefault();
+        if (password !== confirm) {
+            setError("تکرار رمز عبور مطابقت ندارد");
+            return;
+        }
+        setLoading(true);
+        setError("");
+
+        try {
+            if (inviteToken) {
+                const data = await apiRequest("/auth/invitations/accept", {
+                    method: "POST",
+                    body: JSON.stringify({ token: inviteToken, password }),
+                });
+                localStorage.setItem("token", data.token);
+                localStorage.setItem("role", data.role);
+                router.push("/dashboard");
+            } else {
+                await apiRequest("/auth/password/reset", {
+                    method: "POST",
+                    body: JSON.stringify({ token: resetToken, password }),
+                });
+                setDone(true);
+            }
+        } catch (err: any) {
+            setError(err.message || "خطا در ثبت رمز عبور");
+        } finally {
+            setLoading(false);
+        }
+    };
+
+    if (!inviteToken && !resetToken) {
+        return (
+            <div className="p-4 bg-red-50 rounded-xl text-red-600 text-sm font-bold border border-red-100">
+                لینک نامعتبر است. لطفاً از لینک ارسال‌شده در ایمیل استفاده کنید.
+            </div>
+        );
+    }
+
+    if (done) {
+        return (
+            <div className="space-y-6 text-center">
+                <div className="p-4 bg-green-50 rounded-xl text-green-700 text-sm font-bold border border-green-100">
+                    رمز عبور شما تغییر کرد. اکنون می‌توانید وارد شوید.
+                </div>
+                <Link href="/login" className="inline-block text-sm font-black text-red-600 hover:text-red-700">
+                    ورود به سیستم
+                </Link>
+            </div>
+        );
+    }
+
+    return (
+        <form onSubmit={handleSubmit} className="space-y-6">
+            <div className="space-y-4">
+                <div className="space-y-1.5">
+                    <label className="text-xs font-black text-gray-400 uppercase tracking-widest mr-1">رمز عبور جدید</label>
+                    <div className="relative">
+                        <Lock className="absolute right-4 top-1/2 -translate-y-1/2 text-gray-300" size={20} />
+                        <input
+                            type="password"
+                            required
+                            minLength={6}
+                            className="w-full bg-gray-50 border-2 border-transparent focus:border-red-600 focus:bg-white rounded-2xl pr-12 pl-5 py-3.5 outline-none transition-all font-bold text-gray-900 placeholder:text-gray-300"
+                            placeholder="••••••••"
+                            value={password}
+                            onChange={e => setPassword(e.target.value)}
+                        />
+                    </div>
+                </div>
+                <div className="space-y-1.5">
+                    <label className="text-xs font-black text-gray-400 uppercase tracking-widest mr-1">تکرار رمز عبور</label>
+                    <div className="relative">
+                        <Lock className="absolute right-4 top-1/2 -translate-y-1/2 text-gray-300" size={20} />
+                        <input
+                            type="password"
+                            required
+                            minLength={6}
+                            className="w-full bg-gray-50 border-2 border-transparent focus:border-red-600 focus:bg-white rounded-2xl pr-12 pl-5 py-3.5 outline-none transition-all font-bold text-gray-900 placeholder:text-gray-300"
+                            placeholder="••••••••"
+                            value={confirm}
+                            onChange={e => setConfirm(e.target.value)}
+                        />
+                    </div>
+                </div>
+            </div>
+
+            {error && (
+                <div className="p-4 bg-red-50 rounded-xl text-red-600 text-sm font-bold border border-red-100 animate-in fade-in duration-200">
+                    {error}
+                </div>
+            )}
+
+            <button
+                type="submit"
+                disabled={loading}
+                className="w-full bg-red-600 hover:bg-red-700 disabled:bg-gray-200 text-white py-4 rounded-2xl font-black text-lg shadow-lg shadow-red-200 transition-all active:scale-95 flex items-center justify-center gap-2"
+            >
+                {loading ? (
+                    <Loader2 className="w-6 h-6 animate-spin text-white/50" />
+                ) : inviteToken ? (
+                    "ایجاد حساب"
+                ) : (
+                    "ثبت رمز عبور"
+                )}
+            </button>
+        </form>
+    );
+}
+
+export default function SetPasswordPage() {
+    return (
+        <div className="min-h-screen flex items-center justify-center bg-gray-50 p-4 font-sans">
+            <div className="w-full max-w-md bg-white rounded-3xl shadow-xl shadow-gray-200/50 border border-gray-100 overflow-hidden">
+                <div className="p-8">
+                    <div className="text-center mb-10">
+                        <div className="w-16 h-16 bg-red-50 rounded-2xl flex items-center justify-center mx-auto mb-4 text-red-600">
+                            <KeyRound size={32} />
+                        </div>
+                        <h1 className="text-2xl font-black text-gray-900 tracking-tight">تعیین رمز عبور</h1>
+                        <p className="text-gray-400 text-sm font-medium mt-2">رمز عبوری با حداقل ۶ کاراکتر انتخاب کنید.</p>
+                    </div>
+
+                    <Suspense fallback={<Loader2 className="w-6 h-6 animate-spin text-red-600 mx-auto" />}>
+                        <SetPasswordForm />
+                    </Suspense>
+                </div>
+
+                <div className="p-6 bg-gray-50 text-center border-t border-gray-100">
+                    <Link href="/login" className="text-xs font-bold text-gray-400 hover:text-red-600 transition-colors">
+                        بازگشت به صفحه ورود
+                    </Link>
+                </div>
+            </div>
+        </div>
+    );
+}
@@ -4,7 +4,8 @@ import { useEffect, useState } from "react";
 import { useParams, useSearchParams } from "next/navigation";
 import Link from "next/link";
 import { ArrowRight, MapPin, Star, Share2, Heart, Wifi, Coffee, Car, Utensils, Info, ShieldCheck, ChevronLeft } from "lucide-react";
-import { apiRequest } from "@/lib/api";
+import { apiRequest, mediaUrl } from "@/lib/api";
+import { trackEvent } from "@/lib/events";
 import StoryViewer from "@/components/story-viewer";
 
 // Mock Data for a single hotel
@@ -37,14 +38,19 @@ export default function HotelDetails() {
     useEffect(() => {
         const fetchStories = async () => {
             try {
-                const data = await apiRequest(`/public/stories/${city_slug}`);
+                const data = await apiRequest(`/public/hotels/${hotel_slug}/stories`);
                 setStories(data || []);
             } catch (err) {
                 console.error(err);
             }
         };
         fetchStories();
-    }, [city_slug]);
+    }, [hotel_slug]);
+
+    // Report an impression for each story ring shown
+    useEffect(() => {
+        stories.forEach((group) => trackEvent({ type: 'impression', group_id: group.id }));
+    }, [stories]);
 
     const nights = searchParams.get("nights");
     const decodedHotelName = decodeURIComponent(hotel_slug as string).replace(/-/g, " ");
@@ -83,22 +89,30 @@ export default function HotelDetails() {
                             <div
                                 key={group.id}
                                 className="flex flex-col items-center gap-3 cursor-pointer group shrink-0"
-                                onClick={() => setSelectedStoryIndex(index)}
+                                onClick={() => {
+                                    setSelectedStoryIndex(index);
+                                    trackEvent({ type: 'group_open', group_id: group.id });
+                                }}
                             >
                                 <div className="p-1 rounded-full border-2 border-red-600 shadow-lg shadow-red-50 group-hover:scale-105 transition-all">
                                     <div className="w-16 h-16 rounded-full border-4 border-white overflow-hidden relative">
                                         {group.cover_url ? (
                                             <img
-                                                src={group.cover_url.startsWith('http') ? group.cover_url : `http://localhost:8080${group.cover_url}`}
+                                                src={mediaUrl(group.cover_url)}
                                                 alt={group.title_fa}
                                                 className="w-full h-full object-cover grayscale-[0.5] group-hover:grayscale-0 transition-all"
                                             />
                                         ) : (group.slides[0]?.thumbnail_url || group.slides[0]?.image_url) ? (
-                                            <img
-                                                src={`http://localhost:8080${group.slides[0]?.thumbnail_url || group.slides[0]?.image_url}`}
-                                                alt={group.title_fa}
-                                                className="w-full h-full object-cover grayscale-[0.5] group-hover:grayscale-0 transition-all"
-                                            />
+                                            <picture>
+                                                {group.slides[0]?.thumbnail_webp_url && (
+                                                    <source srcSet={mediaUrl(group.slides[0].thumbnail_webp_url)} type="image/webp" />
+                                                )}
+                                                <img
+                                                    src={mediaUrl(group.slides[0]?.thumbnail_url || group.slides[0]?.image_url)}
+                                                    alt={group.title_fa}
+                                                    className="w-full h-full object-cover grayscale-[0.5] group-hover:grayscale-0 transition-all"
+                                                />
+                                            </picture>
                                         ) : (
                                             <div className="w-full h-full bg-gray-100 flex items-center justify-center text-gray-300 italic text-[8px]">No Cover</div>
                                         )}
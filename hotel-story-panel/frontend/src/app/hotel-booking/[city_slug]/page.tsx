@@ -3,7 +3,8 @@
 import { useEffect, useState, useRef } from "react";
 import { useParams, useSearchParams, useRouter } from "next/navigation";
 import StoryViewer from "@/components/story-viewer";
-import { apiRequest } from "@/lib/api";
+import { apiRequest, mediaUrl } from "@/lib/api";
+import { trackEvent } from "@/lib/events";
 import { MapPin, Star, Filter, SlidersHorizontal, ArrowRight, Search, ChevronDown, Heart, Calendar as CalendarIcon, Users } from "lucide-react";
 import Link from "next/link";
 import { HotelFilters } from "@/components/hotel-filters";
@@ -150,6 +151,11 @@ export default function SearchResults() {
         fetchStories();
     }, [city_slug]);
 
+    // Report an impression for each story ring shown
+    useEffect(() => {
+        stories.forEach((group) => trackEvent({ type: 'impression', group_id: group.id }));
+    }, [stories]);
+
     const decodedSlug = decodeURIComponent(city_slug as string).trim();
 
     // Map Persian slugs back to English for API compatibility
@@ -307,24 +313,28 @@ export default function SearchResults() {
                                 onClick={() => {
                                     setSelectedStoryIndex(index);
                                     // Track group opening (CTR)
-                                    fetch(`http://localhost:8080/api/public/stories/group-open/${group.id}`, { method: 'POST' })
-                                        .catch(err => console.error('Failed to track story opening:', err));
+                                    trackEvent({ type: 'group_open', group_id: group.id });
                                 }}
                             >
                                 <div className="p-1 rounded-full border-2 border-red-600   group-active:scale-95 shadow-lg shadow-red-50">
                                     <div className="w-20 h-20 rounded-full border-4 border-white overflow-hidden relative shadow-inner">
                                         {group.cover_url ? (
                                             <img
-                                                src={group.cover_url.startsWith('http') ? group.cover_url : `http://localhost:8080${group.cover_url}`}
+                                                src={mediaUrl(group.cover_url)}
                                                 alt={group.title_fa}
                                                 className="w-full h-full object-cover grayscale-[0.3] group-hover:grayscale-0"
                                             />
                                         ) : (group.slides[0]?.thumbnail_url || group.slides[0]?.image_url) ? (
-                                            <img
-                                                src={`http://localhost:8080${group.slides[0]?.thumbnail_url || group.slides[0]?.image_url}`}
-                                                alt={group.title_fa}
-                                                className="w-full h-full object-cover grayscale-[0.3] "
-                                            />
+                                            <picture>
+                                                {group.slides[0]?.thumbnail_webp_url && (
+                                                    <source srcSet={mediaUrl(group.slides[0].thumbnail_webp_url)} type="image/webp" />
+                                                )}
+                                                <img
+                                                    src={mediaUrl(group.slides[0]?.thumbnail_url || group.slides[0]?.image_url)}
+                                                    alt={group.title_fa}
+                                                    className="w-full h-full object-cover grayscale-[0.3] "
+                                                />
+                                            </picture>
                                         ) : (
                                             <div
                                                 className="w-full h-full flex items-center justify-center text-white text-lg font-black"
@@ -3,7 +3,8 @@
 import { useState, useCallback, useRef } from "react";
 import Cropper from "react-easy-crop";
 import { Point, Area } from "react-easy-crop";
-import { Plus, X, Type, Link as LinkIcon, Heart, Save, Image as ImageIcon, Palette, Trash2, ChevronLeft } from "lucide-react";
+import { Plus, X, Type, Link as LinkIcon, Heart, Save, Image as ImageIcon, Palette, Trash2, ChevronLeft, BarChart2, HelpCircle, Check, Timer } from "lucide-react";
+import { mediaUrl, uploadErrorMessage, UPLOAD_IMAGE_TYPES } from "@/lib/api";
 
 // Helper to create valid image file from crop
 const createImage = (url: string): Promise<HTMLImageElement> =>
@@ -54,11 +55,19 @@ async function getCroppedImg(
 }
 
 interface Element {
-    type: 'link' | 'slider' | 'text';
+    type: 'link' | 'slider' | 'text' | 'poll' | 'quiz' | 'countdown';
+    id?: string; // assigned by the server to elements viewers respond to
     text?: string;
     url?: string;
     emoji?: string;
     content?: string; // for text element
+    question?: string; // for poll and quiz elements
+    options?: string[];
+    correct?: number; // index of the quiz's correct option
+    label?: string; // for countdown element
+    target?: string; // ISO time the countdown ends, unless until is set
+    until?: 'group_end';
+    hide_slide?: boolean; // hide the whole slide once the countdown has passed
     x: number;
     y: number;
 }
@@ -75,7 +84,7 @@ interface StoryBuilderProps {
 
 export default function StoryBuilder({ onUpload, initialData }: StoryBuilderProps) {
     const [imageSrc, setImageSrc] = useState<string | null>(
-        initialData?.image_url ? `http://localhost:8080${initialData.image_url}` : null
+        initialData?.image_url ? mediaUrl(initialData.image_url) : null
     );
     const [crop, setCrop] = useState<Point>({ x: 0, y: 0 });
     const [zoom, setZoom] = useState(1);
@@ -87,6 +96,13 @@ export default function StoryBuilder({ onUpload, initialData }: StoryBuilderProp
     const [linkText, setLinkText] = useState("");
     const [linkUrl, setLinkUrl] = useState("");
     const [textContent, setTextContent] = useState('');
+    const [pollQuestion, setPollQuestion] = useState('');
+    const [pollOptions, setPollOptions] = useState<string[]>(['', '']);
+    const [quizCorrect, setQuizCorrect] = useState(0);
+    const [countdownLabel, setCountdownLabel] = useState('');
+    const [countdownTarget, setCountdownTarget] = useState('');
+    const [countdownUntilEnd, setCountdownUntilEnd] = useState(false);
+    const [countdownHideSlide, setCountdownHideSlide] = useState(false);
 
     // New states for enhanced features
     const [duration, setDuration] = useState<number>(initialData?.duration || 7);
@@ -100,9 +116,8 @@ export default function StoryBuilder({ onUpload, initialData }: StoryBuilderProp
     const onFileChange = async (e: React.ChangeEvent<HTMLInputElement>) => {
         if (e.target.files && e.target.files.length > 0) {
             const file = e.target.files[0];
-            const validTypes = ['image/jpeg', 'image/png', 'image/gif'];
-            if (!validTypes.includes(file.type)) {
-                setError("فرمت فایل نامعتبر است.");
+            if (!UPLOAD_IMAGE_TYPES.includes(file.type)) {
+                setError(uploadErrorMessage({ code: 'unsupported_type' }, "فرمت فایل نامعتبر است."));
                 return;
             }
             const imageDataUrl = await readFile(file);
@@ -161,8 +176,11 @@ export default function StoryBuilder({ onUpload, initialData }: StoryBuilderProp
     };
 
     const addLink = () => {
-        if (!linkText || !linkUrl) return;
-        setElements([...elements, { type: 'link', text: linkText, url: linkUrl, x: 50, y: 80 }]);
+        if (!linkText.trim() || !linkUrl.trim()) return;
+        // Links must be http(s) URLs or paths on the site
+        let url = linkUrl.trim();
+        if (!url.startsWith('/') && !/^https?:\/\//i.test(url)) url = `https://${url}`;
+        setElements([...elements, { type: 'link', text: linkText.trim(), url, x: 50, y: 80 }]);
         setLinkText(""); setLinkUrl(""); setActiveTool(null);
     };
 
@@ -177,6 +195,30 @@ export default function StoryBuilder({ onUpload, initialData }: StoryBuilderProp
         setTextContent(''); setActiveTool(null);
     };
 
+    // Polls and quizzes share the question form; quizzes also mark the correct option
+    const addPoll = () => {
+        const options = pollOptions.map(o => o.trim());
+        if (!pollQuestion.trim() || options.some(o => !o)) return;
+        const element: Element = { type: 'poll', question: pollQuestion.trim(), options, x: 50, y: 60 };
+        if (activeTool === 'quiz') {
+            element.type = 'quiz';
+            element.correct = Math.min(quizCorrect, options.length - 1);
+        }
+        setElements([...elements, element]);
+        setPollQuestion(''); setPollOptions(['', '']); setQuizCorrect(0); setActiveTool(null);
+    };
+
+    const addCountdown = () => {
+        if (!countdownUntilEnd && !countdownTarget) return;
+        const element: Element = { type: 'countdown', x: 50, y: 30 };
+        if (countdownLabel.trim()) element.label = countdownLabel.trim();
+        if (countdownUntilEnd) element.until = 'group_end';
+        else element.target = new Date(countdownTarget).toISOString();
+        if (countdownHideSlide) element.hide_slide = true;
+        setElements([...elements, element]);
+        setCountdownLabel(''); setCountdownTarget(''); setCountdownUntilEnd(false); setCountdownHideSlide(false); setActiveTool(null);
+    };
+
     const removeElement = (index: number) => {
         setElements(elements.filter((_, i) => i !== index));
     };
@@ -209,8 +251,9 @@ export default function StoryBuilder({ onUpload, initialData }: StoryBuilderProp
                             <p className="font-bold text-sm">عکسی انتخاب نشده است</p>
                             <label className="mt-4 px-4 py-2 bg-red-600 text-white rounded-lg text-xs font-bold cursor-pointer hover:bg-red-700 transition">
                                 انتخاب عکس
-                                <input type="file" className="hidden" onChange={onFileChange} />
+                                <input type="file" className="hidden" accept={UPLOAD_IMAGE_TYPES.join(',')} onChange={onFileChange} />
                             </label>
+                            {error && <p className="mt-3 text-xs font-bold text-red-600">{error}</p>}
                         </div>
                     ) : null}
 
@@ -241,6 +284,26 @@ export default function StoryBuilder({ onUpload, initialData }: StoryBuilderProp
                                         {el.content}
                                     </div>
                                 )}
+                                {el.type === 'countdown' && (
+                                    <div className="bg-white/90 backdrop-blur-md px-4 py-3 rounded-2xl shadow-xl border border-white/20 text-center">
+                                        {el.label && <div className="text-xs font-bold text-gray-500 mb-1">{el.label}</div>}
+                                        <div className="text-lg font-black text-black flex items-center gap-2 justify-center">
+                                            <Timer size={18} />
+                                            {el.until === 'group_end' ? 'تا پایان کمپین' : new Date(el.target!).toLocaleString('fa-IR', { dateStyle: 'short', timeStyle: 'short' })}
+                                        </div>
+                                    </div>
+                                )}
+                                {(el.type === 'poll' || el.type === 'quiz') && (
+                                    <div className="bg-white/90 backdrop-blur-md p-3 rounded-2xl shadow-xl w-52 border border-white/20 space-y-1.5">
+                                        <div className="text-black text-sm font-black text-center">{el.question}</div>
+                                        {el.options?.map((option, oi) => (
+                                            <div key={oi} className={`rounded-lg border px-3 py-1 text-xs font-bold flex justify-between ${el.type === 'quiz' && el.correct === oi ? 'border-green-500 text-green-700' : 'border-gray-200 text-gray-800'}`}>
+                                                {option}
+                                                {el.type === 'quiz' && el.correct === oi && <Check size={12} />}
+                                            </div>
+                                        ))}
+                                    </div>
+                                )}
                             </div>
                         ))}
                     </div>
@@ -286,8 +349,9 @@ export default function StoryBuilder({ onUpload, initialData }: StoryBuilderProp
                                 <label className="flex flex-col items-center justify-center border-2 border-dashed border-gray-200 rounded-2xl p-6 hover:bg-gray-50 transition cursor-pointer group">
                                     <ImageIcon size={32} className="text-gray-300 group-hover:text-red-400 mb-2 transition" />
                                     <span className="text-xs font-bold text-gray-500">تغییر عکس</span>
-                                    <input type="file" className="hidden" onChange={onFileChange} />
+                                    <input type="file" className="hidden" accept={UPLOAD_IMAGE_TYPES.join(',')} onChange={onFileChange} />
                                 </label>
+                                {error && <p className="text-xs font-bold text-red-600">{error}</p>}
                                 {imageSrc && (
                                     <div className="space-y-2">
                                         <div className="flex justify-between text-xs font-bold text-gray-400">
@@ -336,7 +400,10 @@ export default function StoryBuilder({ onUpload, initialData }: StoryBuilderProp
                             {[
                                 { id: 'text', icon: Type, label: 'متن' },
                                 { id: 'link', icon: LinkIcon, label: 'لینک' },
-                                { id: 'slider', icon: Heart, label: 'لایک' }
+                                { id: 'slider', icon: Heart, label: 'لایک' },
+                                { id: 'poll', icon: BarChart2, label: 'نظرسنجی' },
+                                { id: 'quiz', icon: HelpCircle, label: 'مسابقه' },
+                                { id: 'countdown', icon: Timer, label: 'شمارش' }
                             ].map(tool => (
                                 <button
                                     key={tool.id}
@@ -357,6 +424,7 @@ export default function StoryBuilder({ onUpload, initialData }: StoryBuilderProp
                                     placeholder="متن خود را اینجا بنویسید..."
                                     rows={2}
                                     value={textContent}
+                                    maxLength={200}
                                     onChange={e => setTextContent(e.target.value)}
                                 />
                                 <div className="flex gap-2 mt-3">
@@ -372,6 +440,7 @@ export default function StoryBuilder({ onUpload, initialData }: StoryBuilderProp
                                     className="w-full bg-white border border-gray-200 rounded-xl p-3 text-sm font-bold outline-none"
                                     placeholder="متن دکمه"
                                     value={linkText}
+                                    maxLength={40}
                                     onChange={e => setLinkText(e.target.value)}
                                 />
                                 <input
@@ -386,6 +455,91 @@ export default function StoryBuilder({ onUpload, initialData }: StoryBuilderProp
                                 </div>
                             </div>
                         )}
+
+                        {(activeTool === 'poll' || activeTool === 'quiz') && (
+                            <div className="bg-gray-50 p-4 rounded-2xl border border-red-100 animate-in slide-in-from-top-2 duration-200 space-y-3">
+                                <input
+                                    className="w-full bg-white border border-gray-200 rounded-xl p-3 text-sm font-bold outline-none"
+                                    placeholder={activeTool === 'quiz' ? 'سوال مسابقه' : 'سوال نظرسنجی'}
+                                    value={pollQuestion}
+                                    maxLength={80}
+                                    onChange={e => setPollQuestion(e.target.value)}
+                                />
+                                {pollOptions.map((option, oi) => (
+                                    <div key={oi} className="flex gap-2">
+                                        {activeTool === 'quiz' && (
+                                            <button
+                                                onClick={() => setQuizCorrect(oi)}
+                                                title="گزینه درست"
+                                                className={`px-2 rounded-xl border ${quizCorrect === oi ? 'border-green-500 bg-green-50 text-green-600' : 'border-gray-200 text-gray-300'}`}
+                                            >
+                                                <Check size={16} />
+                                            </button>
+                                        )}
+                                        <input
+                                            className="flex-1 bg-white border border-gray-200 rounded-xl p-3 text-sm font-bold outline-none"
+                                            placeholder={`گزینه ${oi + 1}`}
+                                            value={option}
+                                            maxLength={25}
+                                            onChange={e => setPollOptions(pollOptions.map((o, j) => j === oi ? e.target.value : o))}
+                                        />
+                                        {pollOptions.length > 2 && (
+                                            <button
+                                                onClick={() => {
+                                                    setPollOptions(pollOptions.filter((_, j) => j !== oi));
+                                                    if (quizCorrect >= oi && quizCorrect > 0) setQuizCorrect(quizCorrect - 1);
+                                                }}
+                                                className="px-2 text-gray-300 hover:text-red-500"
+                                            >
+                                                <X size={16} />
+                                            </button>
+                                        )}
+                                    </div>
+                                ))}
+                                {pollOptions.length < 4 && (
+                                    <button onClick={() => setPollOptions([...pollOptions, ''])} className="text-xs font-bold text-red-600 flex items-center gap-1">
+                                        <Plus size={14} />
+                                        افزودن گزینه
+                                    </button>
+                                )}
+                                <div className="flex gap-2">
+                                    <button onClick={addPoll} className="flex-1 bg-red-600 text-white py-2 rounded-lg text-xs font-bold shadow-md shadow-red-100">{activeTool === 'quiz' ? 'درج مسابقه' : 'درج نظرسنجی'}</button>
+                                    <button onClick={() => setActiveTool(null)} className="px-4 text-xs font-bold text-gray-400">لغو</button>
+                                </div>
+                            </div>
+                        )}
+
+                        {activeTool === 'countdown' && (
+                            <div className="bg-gray-50 p-4 rounded-2xl border border-red-100 animate-in slide-in-from-top-2 duration-200 space-y-3">
+                                <input
+                                    className="w-full bg-white border border-gray-200 rounded-xl p-3 text-sm font-bold outline-none"
+                                    placeholder="عنوان (مثلاً تا پایان حراج)"
+                                    value={countdownLabel}
+                                    maxLength={40}
+                                    onChange={e => setCountdownLabel(e.target.value)}
+                                />
+                                <label className="flex items-center gap-2 text-xs font-bold text-gray-600">
+                                    <input type="checkbox" checked={countdownUntilEnd} onChange={e => setCountdownUntilEnd(e.target.checked)} />
+                                    تا زمان پایان کمپین
+                                </label>
+                                {!countdownUntilEnd && (
+                                    <input
+                                        type="datetime-local"
+                                        className="w-full bg-white border border-gray-200 rounded-xl p-3 text-sm font-bold outline-none dir-ltr"
+                                        value={countdownTarget}
+                                        onChange={e => setCountdownTarget(e.target.value)}
+                                    />
+                                )}
+                                <label className="flex items-center gap-2 text-xs font-bold text-gray-600">
+                                    <input type="checkbox" checked={countdownHideSlide} onChange={e => setCountdownHideSlide(e.target.checked)} />
+                                    پس از پایان، کل اسلاید پنهان شود
+                                </label>
+                                <div className="flex gap-2">
+                                    <button onClick={addCountdown} className="flex-1 bg-red-600 text-white py-2 rounded-lg text-xs font-bold shadow-md shadow-red-100">درج شمارش معکوس</button>
+                                    <button onClick={() => setActiveTool(null)} className="px-4 text-xs font-bold text-gray-400">لغو</button>
+                                </div>
+                            </div>
+                        )}
                     </section>
 
                     {/* Active Elements List */}
@@ -396,10 +550,10 @@ export default function StoryBuilder({ onUpload, initialData }: StoryBuilderProp
                                 <div key={i} className="flex items-center justify-between bg-white border border-gray-100 px-4 py-3 rounded-xl shadow-sm group">
                                     <div className="flex items-center gap-3">
                                         <div className="w-8 h-8 bg-gray-50 rounded-lg flex items-center justify-center text-gray-400">
-                                            {el.type === 'text' ? <Type size={16} /> : el.type === 'link' ? <LinkIcon size={16} /> : <Heart size={16} />}
+                                            {el.type === 'text' ? <Type size={16} /> : el.type === 'link' ? <LinkIcon size={16} /> : el.type === 'poll' ? <BarChart2 size={16} /> : el.type === 'quiz' ? <HelpCircle size={16} /> : el.type === 'countdown' ? <Timer size={16} /> : <Heart size={16} />}
                                         </div>
                                         <span className="text-xs font-bold text-gray-800 line-clamp-1">
-                                            {el.type === 'text' ? el.content : el.type === 'link' ? el.text : 'اسلایدر تعاملی'}
+                                            {el.type === 'text' ? el.content : el.type === 'link' ? el.text : el.type === 'poll' || el.type === 'quiz' ? el.question : el.type === 'countdown' ? (el.label || 'شمارش معکوس') : 'اسلایدر تعاملی'}
                                         </span>
                                     </div>
                                     <button onClick={() => removeElement(i)} className="p-2 text-gray-300 hover:text-red-500 transition-colors opacity-0 group-hover:opacity-100">
@@ -1,16 +1,22 @@
 "use client";
 
-import { useState, useEffect } from "react";
+import { useState, useEffect, useRef } from "react";
 import { X, ExternalLink, ChevronRight, ChevronLeft } from "lucide-react";
+import { mediaUrl } from "@/lib/api";
+import { trackEvent, newSessionId, flushEvents, StoryEventType } from "@/lib/events";
+import { votePoll, PollVote, submitSlider, SliderResponse, answerQuiz, QuizAnswer } from "@/lib/interactions";
 
 interface Slide {
     id: number;
     image_url: string;
+    image_webp_url?: string;
     caption_fa: string;
     elements?: any;
     sort_order: number;
     duration?: number;
     background_color?: string;
+    media_type?: 'image' | 'video' | 'color';
+    video_url?: string | null;
 }
 
 interface Group {
@@ -25,8 +31,6 @@ interface StoryViewerProps {
     onClose: () => void;
 }
 
-const API_BASE_URL = "http://localhost:8080";
-
 export default function StoryViewer({ groups, initialGroupIndex = 0, onClose }: StoryViewerProps) {
     const [currentGroupIndex, setCurrentGroupIndex] = useState(initialGroupIndex);
     const [currentSlideIndex, setCurrentSlideIndex] = useState(0);
@@ -35,6 +39,47 @@ export default function StoryViewer({ groups, initialGroupIndex = 0, onClose }:
     const currentGroup = groups[currentGroupIndex];
     const currentSlide = currentGroup?.slides?.[currentSlideIndex];
 
+    // Analytics: one session per viewer open, watch time measured per slide
+    const sessionId = useRef(newSessionId());
+    const slideStartedAt = useRef(Date.now());
+
+    // Poll votes, slider responses and quiz answers by "slideId:elementId", kept while the viewer is open
+    const [pollVotes, setPollVotes] = useState<Record<string, PollVote>>({});
+    const [sliderValues, setSliderValues] = useState<Record<string, number>>({});
+    const [sliderResponses, setSliderResponses] = useState<Record<string, SliderResponse>>({});
+    const [quizAnswers, setQuizAnswers] = useState<Record<string, QuizAnswer>>({});
+
+    // Countdowns tick once a second and disappear when they reach zero
+    const [now, setNow] = useState(Date.now());
+    useEffect(() => {
+        const timer = setInterval(() => setNow(Date.now()), 1000);
+        return () => clearInterval(timer);
+    }, []);
+
+    const handleVote = async (elementId: string, option: number) => {
+        if (!currentSlide) return;
+        const key = `${currentSlide.id}:${elementId}`;
+        if (pollVotes[key]) return;
+        try {
+            const vote = await votePoll(currentSlide.id, elementId, option);
+            setPollVotes(prev => ({ ...prev, [key]: vote }));
+        } catch (e) {
+            console.error(e);
+        }
+    };
+
+    const track = (type: StoryEventType, extra: { watch?: boolean; meta?: Record<string, unknown> } = {}) => {
+        if (!currentGroup || !currentSlide) return;
+        trackEvent({
+            type,
+            group_id: currentGroup.id,
+            slide_id: currentSlide.id,
+            session_id: sessionId.current,
+            watch_ms: extra.watch ? Date.now() - slideStartedAt.current : undefined,
+            meta: extra.meta,
+        });
+    };
+
     useEffect(() => {
         setProgress(0);
     }, [currentSlideIndex, currentGroupIndex]);
@@ -50,6 +95,7 @@ export default function StoryViewer({ groups, initialGroupIndex = 0, onClose }:
             setProgress(prev => {
                 if (prev >= 100) {
                     clearInterval(timer);
+                    track('slide_complete', { watch: true });
                     handleNext();
                     return 0;
                 }
@@ -62,10 +108,27 @@ export default function StoryViewer({ groups, initialGroupIndex = 0, onClose }:
 
     useEffect(() => {
         if (currentSlide) {
-            fetch(`${API_BASE_URL}/api/public/stories/open/${currentSlide.id}`, { method: 'POST' });
+            slideStartedAt.current = Date.now();
+            track('slide_view');
         }
     }, [currentSlide]);
 
+    const handleClose = () => {
+        track('exit', { watch: true });
+        flushEvents();
+        onClose();
+    };
+
+    const handleTapNext = () => {
+        track('tap_next', { watch: true });
+        handleNext();
+    };
+
+    const handleTapBack = () => {
+        track('tap_back', { watch: true });
+        handlePrev();
+    };
+
     const handleNext = () => {
         if (currentSlideIndex < currentGroup.slides.length - 1) {
             setCurrentSlideIndex(prev => prev + 1);
@@ -73,6 +136,7 @@ export default function StoryViewer({ groups, initialGroupIndex = 0, onClose }:
             setCurrentGroupIndex(prev => prev + 1);
             setCurrentSlideIndex(0);
         } else {
+            flushEvents();
             onClose();
         }
     };
@@ -86,16 +150,43 @@ export default function StoryViewer({ groups, initialGroupIndex = 0, onClose }:
         }
     };
 
+    const handleSlide = async (elementId: string) => {
+        if (!currentSlide) return;
+        const key = `${currentSlide.id}:${elementId}`;
+        if (sliderResponses[key] || sliderValues[key] === undefined) return;
+        try {
+            const response = await submitSlider(currentSlide.id, elementId, sliderValues[key]);
+            setSliderResponses(prev => ({ ...prev, [key]: response }));
+        } catch (e) {
+            console.error(e);
+        }
+    };
+
+    const handleAnswer = async (elementId: string, option: number) => {
+        if (!currentSlide) return;
+        const key = `${currentSlide.id}:${elementId}`;
+        if (quizAnswers[key]) return;
+        try {
+            const answer = await answerQuiz(currentSlide.id, elementId, option);
+            setQuizAnswers(prev => ({ ...prev, [key]: answer }));
+        } catch (e) {
+            console.error(e);
+        }
+    };
+
     if (!currentGroup || !currentSlide) return null;
 
-    const bgStyle = currentSlide.image_url
-        ? { backgroundImage: `url(${API_BASE_URL}${currentSlide.image_url})` }
+    // Image slides with a WebP copy are drawn by a <picture> so the browser
+    // picks the format; everything else uses the JPEG as background
+    const webpUrl = currentSlide.media_type !== 'video' && currentSlide.image_url ? currentSlide.image_webp_url : undefined;
+    const bgStyle = currentSlide.image_url && !webpUrl
+        ? { backgroundImage: `url(${mediaUrl(currentSlide.image_url)})` }
         : { backgroundColor: currentSlide.background_color || '#000000' };
 
     return (
         <div className="fixed inset-0 z-50 bg-black/95 backdrop-blur-md flex items-center justify-center font-sans">
             <button
-                onClick={onClose}
+                onClick={handleClose}
                 className="absolute top-6 right-6 z-50 p-2 bg-white/10 hover:bg-white/20 text-white rounded-full transition-all"
             >
                 <X size={32} />
@@ -105,6 +196,30 @@ export default function StoryViewer({ groups, initialGroupIndex = 0, onClose }:
                 className="relative w-full h-full md:w-[420px] md:h-[85vh] bg-black md:rounded-[40px] overflow-hidden shadow-2xl bg-cover bg-center bg-no-repeat border-4 border-white/5"
                 style={bgStyle}
             >
+                {webpUrl && (
+                    <picture key={currentSlide.id}>
+                        <source srcSet={mediaUrl(webpUrl)} type="image/webp" />
+                        <img
+                            src={mediaUrl(currentSlide.image_url)}
+                            alt=""
+                            className="absolute inset-0 w-full h-full object-cover"
+                        />
+                    </picture>
+                )}
+
+                {/* Video Slide (image_url holds its poster) */}
+                {currentSlide.media_type === 'video' && currentSlide.video_url && (
+                    <video
+                        key={currentSlide.id}
+                        src={mediaUrl(currentSlide.video_url)}
+                        poster={currentSlide.image_url ? mediaUrl(currentSlide.image_url) : undefined}
+                        className="absolute inset-0 w-full h-full object-cover"
+                        autoPlay
+                        muted
+                        playsInline
+                    />
+                )}
+
                 {/* Progress Indicators */}
                 <div className="absolute top-4 left-0 right-0 z-20 flex gap-1.5 px-4 h-1">
                     {currentGroup.slides.map((s, idx) => (
@@ -130,8 +245,8 @@ export default function StoryViewer({ groups, initialGroupIndex = 0, onClose }:
 
                 {/* Navigation Hotspots */}
                 <div className="absolute inset-0 z-10 flex">
-                    <div className="w-1/3 h-full cursor-pointer" onClick={handlePrev} />
-                    <div className="w-2/3 h-full cursor-pointer" onClick={handleNext} />
+                    <div className="w-1/3 h-full cursor-pointer" onClick={handleTapBack} />
+                    <div className="w-2/3 h-full cursor-pointer" onClick={handleTapNext} />
                 </div>
 
                 {/* Elements Layer */}
@@ -159,36 +274,146 @@ export default function StoryViewer({ groups, initialGroupIndex = 0, onClose }:
                                         href={el.url}
                                         target="_blank"
                                         rel="noopener noreferrer"
-                                        onClick={(e) => e.stopPropagation()}
+                                        onClick={(e) => {
+                                            e.stopPropagation();
+                                            track('link_click', { watch: true, meta: { url: el.url } });
+                                        }}
                                         className="bg-white text-black px-6 py-2.5 rounded-full font-black text-sm shadow-[0_8px_30px_rgb(0,0,0,0.2)] whitespace-nowrap flex items-center gap-2 transition-transform hover:scale-110 active:scale-95 border border-gray-100"
                                     >
                                         {el.text}
                                         <ExternalLink size={16} strokeWidth={3} />
                                     </a>
                                 )}
-                                {el.type === 'slider' && (
-                                    <div
-                                        className="bg-white/90 backdrop-blur-md px-5 py-3 rounded-2xl shadow-2xl w-56 border border-white/20"
-                                        onClick={(e) => e.stopPropagation()}
-                                    >
-                                        <div className="flex justify-between items-center mb-1">
-                                            <span className="text-2xl animate-bounce">{el.emoji}</span>
-                                            <div className="flex-1 mx-3">
-                                                <input
-                                                    type="range"
-                                                    disabled
-                                                    className="w-full h-1.5 bg-gray-200 rounded-full appearance-none accent-red-600"
-                                                    style={{ direction: 'ltr' }}
-                                                />
+                                {el.type === 'slider' && (() => {
+                                    const key = `${currentSlide.id}:${el.id}`;
+                                    const response = sliderResponses[key];
+                                    return (
+                                        <div
+                                            className="bg-white/90 backdrop-blur-md px-5 py-3 rounded-2xl shadow-2xl w-56 border border-white/20"
+                                            onClick={(e) => e.stopPropagation()}
+                                        >
+                                            <div className="flex justify-between items-center mb-1">
+                                                <span className="text-2xl animate-bounce">{el.emoji}</span>
+                                                <div className="flex-1 mx-3">
+                                                    <input
+                                                        type="range"
+                                                        min={0}
+                                                        max={100}
+                                                        disabled={!el.id || !!response}
+                                                        value={response?.value ?? sliderValues[key] ?? 0}
+                                                        onChange={(e) => setSliderValues(prev => ({ ...prev, [key]: Number(e.target.value) }))}
+                                                        onPointerUp={() => handleSlide(el.id)}
+                                                        onKeyUp={() => handleSlide(el.id)}
+                                                        className="w-full h-1.5 bg-gray-200 rounded-full appearance-none accent-red-600"
+                                                        style={{ direction: 'ltr' }}
+                                                    />
+                                                </div>
                                             </div>
+                                            {response && (
+                                                <div className="text-[10px] text-gray-500 font-bold text-center">
+                                                    میانگین {response.average.toLocaleString('fa-IR')} از ۱۰۰ · {response.count.toLocaleString('fa-IR')} پاسخ
+                                                </div>
+                                            )}
                                         </div>
-                                    </div>
-                                )}
+                                    );
+                                })()}
                                 {el.type === 'text' && (
                                     <div className="bg-white/95 backdrop-blur-md px-5 py-2.5 rounded-2xl shadow-2xl text-black text-lg font-black whitespace-nowrap border border-white/20 select-none">
                                         {el.content}
                                     </div>
                                 )}
+                                {el.type === 'poll' && (() => {
+                                    const vote = pollVotes[`${currentSlide.id}:${el.id}`];
+                                    return (
+                                        <div
+                                            className="bg-white/95 backdrop-blur-md p-4 rounded-2xl shadow-2xl w-64 border border-white/20 space-y-2"
+                                            onClick={(e) => e.stopPropagation()}
+                                        >
+                                            <div className="text-black text-base font-black text-center mb-1">{el.question}</div>
+                                            {(el.options || []).map((option: string, oi: number) => {
+                                                const result = vote?.results.options[oi];
+                                                return (
+                                                    <button
+                                                        key={oi}
+                                                        disabled={!!vote}
+                                                        onClick={() => handleVote(el.id, oi)}
+                                                        className={`relative w-full overflow-hidden rounded-xl border px-4 py-2 text-sm font-bold text-right transition-all ${vote?.option === oi ? 'border-red-600 text-red-600' : 'border-gray-200 text-gray-800'} ${vote ? '' : 'hover:border-red-300 active:scale-95'}`}
+                                                    >
+                                                        {result && (
+                                                            <div className="absolute inset-y-0 right-0 bg-red-50" style={{ width: `${result.percent}%` }} />
+                                                        )}
+                                                        <span className="relative flex justify-between gap-2">
+                                                            <span>{option}</span>
+                                                            {result && <span>{result.percent.toLocaleString('fa-IR')}٪</span>}
+                                                        </span>
+                                                    </button>
+                                                );
+                                            })}
+                                            {vote && (
+                                                <div className="text-[10px] text-gray-400 font-bold text-center">
+                                                    {vote.results.total.toLocaleString('fa-IR')} رأی
+                                                </div>
+                                            )}
+                                        </div>
+                                    );
+                                })()}
+                                {el.type === 'countdown' && (() => {
+                                    const left = Math.floor((el.target_epoch * 1000 - now) / 1000);
+                                    if (left <= 0) return null;
+                                    const parts = [Math.floor(left / 86400), Math.floor(left / 3600) % 24, Math.floor(left / 60) % 60, left % 60];
+                                    return (
+                                        <div
+                                            className="bg-white/95 backdrop-blur-md px-5 py-3 rounded-2xl shadow-2xl border border-white/20 text-center select-none"
+                                            title={el.target_jalali}
+                                        >
+                                            {el.label && <div className="text-xs font-bold text-gray-500 mb-1">{el.label}</div>}
+                                            <div className="flex gap-3 justify-center text-black" style={{ direction: 'ltr' }}>
+                                                {parts.map((n, pi) => (
+                                                    <div key={pi} className="flex flex-col items-center">
+                                                        <span className="text-2xl font-black tabular-nums">{n.toLocaleString('fa-IR', { minimumIntegerDigits: 2 })}</span>
+                                                        <span className="text-[9px] font-bold text-gray-400">{['روز', 'ساعت', 'دقیقه', 'ثانیه'][pi]}</span>
+                                                    </div>
+                                                ))}
+                                            </div>
+                                        </div>
+                                    );
+                                })()}
+                                {el.type === 'quiz' && (() => {
+                                    const answer = quizAnswers[`${currentSlide.id}:${el.id}`];
+                                    return (
+                                        <div
+                                            className="bg-white/95 backdrop-blur-md p-4 rounded-2xl shadow-2xl w-64 border border-white/20 space-y-2"
+                                            onClick={(e) => e.stopPropagation()}
+                                        >
+                                            <div className="text-black text-base font-black text-center mb-1">{el.question}</div>
+                                            {(el.options || []).map((option: string, oi: number) => {
+                                                const state = !answer ? 'open'
+                                                    : oi === answer.correct_option ? 'correct'
+                                                    : oi === answer.option ? 'wrong' : 'other';
+                                                return (
+                                                    <button
+                                                        key={oi}
+                                                        disabled={!!answer}
+                                                        onClick={() => handleAnswer(el.id, oi)}
+                                                        className={`w-full rounded-xl border px-4 py-2 text-sm font-bold text-right transition-all ${
+                                                            state === 'correct' ? 'border-green-500 bg-green-50 text-green-700'
+                                                            : state === 'wrong' ? 'border-red-500 bg-red-50 text-red-600'
+                                                            : state === 'other' ? 'border-gray-100 text-gray-400'
+                                                            : 'border-gray-200 text-gray-800 hover:border-red-300 active:scale-95'
+                                                        }`}
+                                                    >
+                                                        {option}
+                                                    </button>
+                                                );
+                                            })}
+                                            {answer && (
+                                                <div className={`text-xs font-black text-center ${answer.correct ? 'text-green-600' : 'text-red-600'}`}>
+                                                    {answer.correct ? 'آفرین! درست جواب دادید' : 'پاسخ درست مشخص شد'}
+                                                </div>
+                                            )}
+                                        </div>
+                                    );
+                                })()}
                             </div>
                         ));
                     })()}
@@ -198,13 +423,13 @@ export default function StoryViewer({ groups, initialGroupIndex = 0, onClose }:
             {/* Side Navigation for Desktop */}
             <div className="hidden lg:flex absolute inset-x-0 top-1/2 -translate-y-1/2 justify-between px-20 pointer-events-none">
                 <button
-                    onClick={handlePrev}
+                    onClick={handleTapBack}
                     className="p-4 bg-white/5 hover:bg-white/10 text-white rounded-full transition-all pointer-events-auto"
                 >
                     <ChevronRight size={40} />
                 </button>
                 <button
-                    onClick={handleNext}
+                    onClick={handleTapNext}
                     className="p-4 bg-white/5 hover:bg-white/10 text-white rounded-full transition-all pointer-events-auto"
                 >
                     <ChevronLeft size={40} />
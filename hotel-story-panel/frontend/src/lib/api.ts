@@ -1,6 +1,38 @@
 const API_BASE_URL = "http://localhost:8080/api";
+const MEDIA_BASE_URL = "http://localhost:8080";
 
-export async function apiRequest(endpoint: string, options: RequestInit = {}) {
+// Media may be served by the backend (/uploads/...) or an object store (absolute URL)
+export function mediaUrl(url: string) {
+    return /^https?:\/\//.test(url) ? url : `${MEDIA_BASE_URL}${url}`;
+}
+
+// Access tokens are short-lived; the refresh token lives in an HttpOnly
+// cookie and is exchanged for a new access token when one is rejected.
+let refreshing: Promise<boolean> | null = null;
+
+export function refreshSession(): Promise<boolean> {
+    if (!refreshing) {
+        refreshing = fetch(`${API_BASE_URL}/auth/refresh`, { method: "POST", credentials: "include" })
+            .then(async (res) => {
+                if (!res.ok) return false;
+                const data = await res.json();
+                localStorage.setItem("token", data.token);
+                localStorage.setItem("role", data.role);
+                return true;
+            })
+            .catch(() => false)
+            .finally(() => { refreshing = null; });
+    }
+    return refreshing;
+}
+
+export async function logout() {
+    await fetch(`${API_BASE_URL}/auth/logout`, { method: "POST", credentials: "include" }).catch(() => {});
+    localStorage.removeItem("token");
+    localStorage.removeItem("role");
+}
+
+export async function apiRequest(endpoint: string, options: RequestInit = {}, retry = true): Promise<any> {
     const token = typeof window !== "undefined" ? localStorage.getItem("token") : null;
 
     const headers = {
@@ -12,8 +44,13 @@ export async function apiRequest(endpoint: string, options: RequestInit = {}) {
     const response = await fetch(`${API_BASE_URL}${endpoint}`, {
         ...options,
         headers,
+        credentials: "include",
     });
 
+    if (response.status === 401 && token && retry && await refreshSession()) {
+        return apiRequest(endpoint, options, false);
+    }
+
     if (!response.ok) {
         const error = await response.json().catch(() => ({ error: "Unknown error" }));
         throw new Error(error.error || `HTTP Error ${response.status}`);
@@ -21,3 +58,25 @@ export async function apiRequest(endpoint: string, options: RequestInit = {}) {
 
     return response.json();
 }
+
+// Image types the backend accepts for uploads
+export const UPLOAD_IMAGE_TYPES = ['image/jpeg', 'image/png', 'image/webp'];
+
+// Persian messages for the upload error codes returned by the backend
+const UPLOAD_ERROR_MESSAGES: Record<string, string> = {
+    file_missing: "فایلی انتخاب نشده است",
+    file_too_large: "حجم فایل بیش از حد مجاز است",
+    unsupported_type: "فرمت فایل پشتیبانی نمی‌شود",
+    invalid_image: "فایل تصویر معتبر نیست",
+    image_too_small: "ابعاد تصویر کمتر از حد مجاز است",
+    image_too_large: "ابعاد تصویر بیشتر از حد مجاز است",
+    aspect_ratio_out_of_range: "نسبت ابعاد تصویر مجاز نیست",
+    decompression_bomb: "تعداد پیکسل‌های تصویر بیش از حد مجاز است",
+    invalid_video: "فایل ویدیو معتبر نیست",
+    video_too_long: "مدت ویدیو بیش از حد مجاز است",
+    invalid_elements: "دکمه‌ها، متن‌ها یا اسلایدر اسلاید معتبر نیستند",
+};
+
+export function uploadErrorMessage(data: { error?: string; code?: string }, fallback: string) {
+    return (data.code && UPLOAD_ERROR_MESSAGES[data.code]) || data.error || fallback;
+}
@@ -0,0 +1,84 @@
+const EVENTS_URL = "http://localhost:8080/api/public/events";
+const MAX_BATCH = 50;
+const FLUSH_DELAY_MS = 3000;
+
+export type StoryEventType =
+    | "impression"
+    | "group_open"
+    | "slide_view"
+    | "slide_complete"
+    | "tap_next"
+    | "tap_back"
+    | "exit"
+    | "link_click";
+
+export interface StoryEvent {
+    type: StoryEventType;
+    group_id: number;
+    slide_id?: number;
+    session_id?: string;
+    watch_ms?: number;
+    meta?: Record<string, unknown>;
+}
+
+let queue: (StoryEvent & { viewer_id: string; occurred_at: string })[] = [];
+let timer: ReturnType<typeof setTimeout> | null = null;
+
+function randomId() {
+    return typeof crypto !== "undefined" && "randomUUID" in crypto
+        ? crypto.randomUUID()
+        : `${Date.now().toString(36)}-${Math.random().toString(36).slice(2)}`;
+}
+
+// Anonymous id kept per browser, used to de-duplicate viewers
+export function viewerId() {
+    if (typeof window === "undefined") return "";
+    let id = localStorage.getItem("story_viewer_id");
+    if (!id) {
+        id = randomId();
+        localStorage.setItem("story_viewer_id", id);
+    }
+    return id;
+}
+
+// One id per story viewer session (open -> close)
+export function newSessionId() {
+    return randomId();
+}
+
+export function trackEvent(event: StoryEvent) {
+    if (typeof window === "undefined") return;
+    queue.push({ ...event, viewer_id: viewerId(), occurred_at: new Date().toISOString() });
+
+    if (queue.length >= MAX_BATCH) {
+        flushEvents();
+    } else if (!timer) {
+        timer = setTimeout(() => flushEvents(), FLUSH_DELAY_MS);
+    }
+}
+
+export function flushEvents(beacon = false) {
+    if (timer) {
+        clearTimeout(timer);
+        timer = null;
+    }
+    if (queue.length === 0) return;
+
+    const body = JSON.stringify({ events: queue.splice(0, MAX_BATCH) });
+    if (beacon && navigator.sendBeacon) {
+        navigator.sendBeacon(EVENTS_URL, new Blob([body], { type: "application/json" }));
+    } else {
+        fetch(EVENTS_URL, {
+            method: "POST",
+            headers: { "Content-Type": "application/json" },
+            body,
+            keepalive: true,
+        }).catch(err => console.error("Failed to send story events:", err));
+    }
+
+    if (queue.length > 0) flushEvents(beacon);
+}
+
+if (typeof window !== "undefined") {
+    window.addEventListener("pagehide", () => flushEvents(true));
+}
@@ -0,0 +1,51 @@
+import { apiRequest } from "@/lib/api";
+import { viewerId } from "@/lib/events";
+
+export interface PollResults {
+    total: number;
+    options: { text: string; votes: number; percent: number }[];
+}
+
+export interface PollVote {
+    option: number;
+    already_voted: boolean;
+    results: PollResults;
+}
+
+// Each viewer votes once per poll; repeat votes return the first choice
+export function votePoll(slideId: number, elementId: string, option: number): Promise<PollVote> {
+    return apiRequest(`/public/slides/${slideId}/poll/${encodeURIComponent(elementId)}`, {
+        method: "POST",
+        body: JSON.stringify({ option, viewer_id: viewerId() }),
+    });
+}
+
+export interface SliderResponse {
+    value: number;
+    already_responded: boolean;
+    count: number;
+    average: number;
+}
+
+// Each viewer responds once per slider; repeat responses return the first value
+export function submitSlider(slideId: number, elementId: string, value: number): Promise<SliderResponse> {
+    return apiRequest(`/public/slides/${slideId}/slider/${encodeURIComponent(elementId)}`, {
+        method: "POST",
+        body: JSON.stringify({ value, viewer_id: viewerId() }),
+    });
+}
+
+export interface QuizAnswer {
+    option: number;
+    correct: boolean;
+    correct_option: number;
+    already_answered: boolean;
+}
+
+// Each viewer answers once per quiz; repeat answers return the first one
+export function answerQuiz(slideId: number, elementId: string, option: number): Promise<QuizAnswer> {
+    return apiRequest(`/public/slides/${slideId}/quiz/${encodeURIComponent(elementId)}`, {
+        method: "POST",
+        body: JSON.stringify({ option, viewer_id: viewerId() }),
+    });
+}